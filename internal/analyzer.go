@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer/types"
+)
+
+// AnalyzerPolicy is one policy document to send to Access Analyzer's ValidatePolicy
+type AnalyzerPolicy struct {
+	Source   string // File path (or description) shown with each finding
+	Document string // Stripped, pretty-printed JSON without tracking Sids
+	Type     types.PolicyType
+}
+
+// ValidatePoliciesWithAnalyzer reports Access Analyzer findings for each policy
+// Findings are printed with the line and column of the rendered document they refer to
+// Warnings, security warnings and suggestions are counted as warnings; ERROR findings fail the run
+func ValidatePoliciesWithAnalyzer(ctx context.Context, client PolicyValidator, policies []AnalyzerPolicy) error {
+	errorCount := 0
+	for _, p := range policies {
+		findings, err := validatePolicy(ctx, client, p)
+		if err != nil {
+			return fmt.Errorf("access analyzer validation of %s failed (requires access-analyzer:ValidatePolicy): %v", p.Source, err)
+		}
+		for _, f := range findings {
+			line := fmt.Sprintf("Access Analyzer %s in %s%s: %s: %s\n", f.FindingType, p.Source, findingPosition(f), AwsString(f.IssueCode), AwsString(f.FindingDetails))
+			if f.FindingType == types.ValidatePolicyFindingTypeError {
+				errorCount++
+				fmt.Fprint(Stderr, line)
+				continue
+			}
+			Warn("%s", line)
+		}
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("access analyzer reported %d error finding(s)", errorCount)
+	}
+	return nil
+}
+
+// validatePolicy collects every page of findings for one policy
+func validatePolicy(ctx context.Context, client PolicyValidator, p AnalyzerPolicy) ([]types.ValidatePolicyFinding, error) {
+	var findings []types.ValidatePolicyFinding
+	input := &accessanalyzer.ValidatePolicyInput{PolicyDocument: &p.Document, PolicyType: p.Type}
+	for {
+		out, err := client.ValidatePolicy(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, out.Findings...)
+		if out.NextToken == nil || *out.NextToken == "" {
+			return findings, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// findingPosition formats the start of a finding's first location as " (line L, column C)"
+// Access Analyzer columns are 0-based; they are shown 1-based to match editors
+func findingPosition(f types.ValidatePolicyFinding) string {
+	if len(f.Locations) == 0 || f.Locations[0].Span == nil || f.Locations[0].Span.Start == nil {
+		return ""
+	}
+	start := f.Locations[0].Span.Start
+	if start.Line == nil || start.Column == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (line %d, column %d)", *start.Line, *start.Column+1)
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer/types"
+)
+
+// mockPolicyValidator returns canned pages of findings in order
+type mockPolicyValidator struct {
+	pages  []*accessanalyzer.ValidatePolicyOutput
+	err    error
+	inputs []accessanalyzer.ValidatePolicyInput
+}
+
+func (m *mockPolicyValidator) ValidatePolicy(ctx context.Context, params *accessanalyzer.ValidatePolicyInput, optFns ...func(*accessanalyzer.Options)) (*accessanalyzer.ValidatePolicyOutput, error) {
+	m.inputs = append(m.inputs, *params)
+	if m.err != nil {
+		return nil, m.err
+	}
+	out := m.pages[0]
+	m.pages = m.pages[1:]
+	return out, nil
+}
+
+func analyzerFinding(findingType types.ValidatePolicyFindingType, code string, line, column int32) types.ValidatePolicyFinding {
+	return types.ValidatePolicyFinding{
+		FindingType:    findingType,
+		IssueCode:      aws.String(code),
+		FindingDetails: aws.String("details for " + code),
+		Locations: []types.Location{{Span: &types.Span{
+			Start: &types.Position{Line: aws.Int32(line), Column: aws.Int32(column), Offset: aws.Int32(0)},
+		}}},
+	}
+}
+
+func TestValidatePoliciesWithAnalyzer(t *testing.T) {
+	originalStderr := Stderr
+	defer func() { Stderr = originalStderr }()
+	var stderr bytes.Buffer
+	Stderr = &stderr
+	ResetWarnings()
+
+	client := &mockPolicyValidator{pages: []*accessanalyzer.ValidatePolicyOutput{
+		{Findings: []types.ValidatePolicyFinding{analyzerFinding(types.ValidatePolicyFindingTypeWarning, "MISSING_VERSION", 1, 0)}, NextToken: aws.String("page2")},
+		{Findings: []types.ValidatePolicyFinding{analyzerFinding(types.ValidatePolicyFindingTypeError, "INVALID_ACTION", 6, 16)}},
+		{},
+	}}
+	policies := []AnalyzerPolicy{
+		{Source: "policy.json", Document: `{"Statement":[]}`, Type: types.PolicyTypeIdentityPolicy},
+		{Source: "bucket.json", Document: `{"Statement":[]}`, Type: types.PolicyTypeResourcePolicy},
+	}
+
+	err := ValidatePoliciesWithAnalyzer(context.Background(), client, policies)
+	if err == nil || !strings.Contains(err.Error(), "1 error finding(s)") {
+		t.Fatalf("expected one error finding, got %v", err)
+	}
+	if len(client.inputs) != 3 {
+		t.Fatalf("expected 3 ValidatePolicy calls (two pages + one policy), got %d", len(client.inputs))
+	}
+	if AwsString(client.inputs[1].NextToken) != "page2" {
+		t.Errorf("second call should pass the next token, got %q", AwsString(client.inputs[1].NextToken))
+	}
+	if client.inputs[2].PolicyType != types.PolicyTypeResourcePolicy {
+		t.Errorf("expected RESOURCE_POLICY for the second policy, got %s", client.inputs[2].PolicyType)
+	}
+
+	out := stderr.String()
+	if !strings.Contains(out, "Access Analyzer WARNING in policy.json (line 1, column 1): MISSING_VERSION") {
+		t.Errorf("warning finding not reported with its position:\n%s", out)
+	}
+	if !strings.Contains(out, "Access Analyzer ERROR in policy.json (line 6, column 17): INVALID_ACTION") {
+		t.Errorf("error finding not reported with its position:\n%s", out)
+	}
+	if WarningCount() != 1 {
+		t.Errorf("expected only the non-error finding to count as a warning, got %d", WarningCount())
+	}
+}
+
+func TestValidatePoliciesWithAnalyzerCallError(t *testing.T) {
+	client := &mockPolicyValidator{err: errors.New("AccessDenied")}
+	err := ValidatePoliciesWithAnalyzer(context.Background(), client, []AnalyzerPolicy{{Source: "policy.json", Type: types.PolicyTypeIdentityPolicy}})
+	if err == nil || !strings.Contains(err.Error(), "policy.json") || !strings.Contains(err.Error(), "access-analyzer:ValidatePolicy") {
+		t.Errorf("expected error naming the policy and required permission, got %v", err)
+	}
+}
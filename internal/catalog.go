@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ActionCatalog maps an IAM service prefix (e.g. "iam") to its full action names (e.g. "iam:GetRole")
+// This build does not bundle a catalog, so it is nil and action_prefix tests fail with a
+// catalog-unavailable error; once populated, action_prefix enumerates a whole namespace
+var ActionCatalog map[string][]string
+
+// catalogActions returns the sorted catalog actions under a prefix such as "iam:" or "iam:Get"
+func catalogActions(prefix string) ([]string, error) {
+	if ActionCatalog == nil {
+		return nil, fmt.Errorf("action_prefix %q requires a bundled action catalog, which is not available in this build; list the actions with 'actions:' instead", prefix)
+	}
+
+	service, _, _ := strings.Cut(prefix, ":")
+	if !strings.Contains(prefix, ":") {
+		prefix += ":"
+	}
+	lowerPrefix := strings.ToLower(prefix)
+
+	var actions []string
+	for _, action := range ActionCatalog[strings.ToLower(service)] {
+		if strings.HasPrefix(strings.ToLower(action), lowerPrefix) {
+			actions = append(actions, action)
+		}
+	}
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("action_prefix %q matched no actions in the action catalog", prefix)
+	}
+	sort.Strings(actions)
+	return actions, nil
+}
+
+// printNamespaceSummary reports, per action_prefix, how many actions were allowed vs denied and which were allowed
+func printNamespaceSummary(results []testResult) {
+	allowed := make(map[string][]string)
+	denied := make(map[string]int)
+	var prefixes []string
+	for _, r := range results {
+		if r.ActionPrefix == "" {
+			continue
+		}
+		if _, seen := allowed[r.ActionPrefix]; !seen {
+			allowed[r.ActionPrefix] = []string{}
+			prefixes = append(prefixes, r.ActionPrefix)
+		}
+		if strings.EqualFold(r.Decision, "allowed") {
+			allowed[r.ActionPrefix] = append(allowed[r.ActionPrefix], r.Action)
+		} else {
+			denied[r.ActionPrefix]++
+		}
+	}
+
+	for _, prefix := range prefixes {
+		fmt.Fprintf(Stdout, "Namespace %s (%d allowed, %d denied)\n", prefix, len(allowed[prefix]), denied[prefix])
+		for _, action := range allowed[prefix] {
+			fmt.Fprintf(Stdout, "  - %s\n", action)
+		}
+	}
+}
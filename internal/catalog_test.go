@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestExpandActionPrefixWithoutCatalog(t *testing.T) {
+	original := ActionCatalog
+	defer func() { ActionCatalog = original }()
+	ActionCatalog = nil
+
+	_, err := expandTestsWithActions([]TestCase{{Name: "iam blast radius", ActionPrefix: "iam:"}})
+	var scenErr *ScenarioError
+	if !errors.As(err, &scenErr) {
+		t.Fatalf("Expected ScenarioError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "requires a bundled action catalog") {
+		t.Errorf("Expected catalog error, got: %v", err)
+	}
+}
+
+func TestExpandActionPrefix(t *testing.T) {
+	original := ActionCatalog
+	defer func() { ActionCatalog = original }()
+	ActionCatalog = map[string][]string{
+		"iam": {"iam:PassRole", "iam:GetRole", "iam:GetUser", "iam:CreateRole"},
+	}
+
+	tests, err := expandTestsWithActions([]TestCase{{Name: "gets", ActionPrefix: "iam:Get"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tests) != 2 || tests[0].Action != "iam:GetRole" || tests[1].Action != "iam:GetUser" {
+		t.Errorf("Expected sorted iam:Get* actions, got %+v", tests)
+	}
+
+	tests, err = expandTestsWithActions([]TestCase{{ActionPrefix: "IAM"}})
+	if err != nil || len(tests) != 4 {
+		t.Errorf("Expected whole namespace for bare service prefix, got %d tests, err %v", len(tests), err)
+	}
+
+	if _, err := expandTestsWithActions([]TestCase{{ActionPrefix: "s3:"}}); err == nil {
+		t.Error("Expected error for a prefix with no catalog actions")
+	}
+	if _, err := expandTestsWithActions([]TestCase{{ActionPrefix: "iam:", Action: "iam:GetRole"}}); err == nil {
+		t.Error("Expected error when combining action_prefix with action")
+	}
+}
+
+func TestRunTestsNamespaceSummary(t *testing.T) {
+	original := ActionCatalog
+	originalStdout := Stdout
+	defer func() {
+		ActionCatalog = original
+		Stdout = originalStdout
+	}()
+	ActionCatalog = map[string][]string{"iam": {"iam:GetRole", "iam:PassRole", "iam:DeleteRole"}}
+	var stdout strings.Builder
+	Stdout = &stdout
+
+	mockClient := &mockIAMClient{
+		SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+			action := params.ActionNames[0]
+			decision := types.PolicyEvaluationDecisionTypeImplicitDeny
+			if action == "iam:GetRole" {
+				decision = types.PolicyEvaluationDecisionTypeAllowed
+			}
+			return &iam.SimulateCustomPolicyOutput{
+				EvaluationResults: []types.EvaluationResult{{EvalActionName: &action, EvalDecision: decision}},
+			}, nil
+		},
+	}
+
+	scen := &Scenario{Tests: []TestCase{{Name: "iam namespace", ActionPrefix: "iam:"}}}
+	if err := RunTests(mockClient, scen, SimulatorConfig{Variables: map[string]any{}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "Namespace iam: (1 allowed, 2 denied)") || !strings.Contains(out, "  - iam:GetRole") {
+		t.Errorf("Expected namespace summary, got:\n%s", out)
+	}
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// ComparisonInput is one action and resource simulated against both policies by `politest compare`
+type ComparisonInput struct {
+	Action   string
+	Resource string
+}
+
+// ComparisonResult holds the decision each policy produced for one input
+type ComparisonResult struct {
+	Input     ComparisonInput
+	DecisionA string
+	DecisionB string
+}
+
+// ParseActionsFile reads one "action [resource]" pair per line; the resource defaults to "*"
+// Blank lines and lines starting with # are ignored
+func ParseActionsFile(path string) ([]ComparisonInput, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var inputs []ComparisonInput
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"action [resource]\", got %q", path, lineNum, scanner.Text())
+		}
+		input := ComparisonInput{Action: fields[0], Resource: "*"}
+		if len(fields) == 2 {
+			input.Resource = fields[1]
+		}
+		inputs = append(inputs, input)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("%s: no actions found", path)
+	}
+	return inputs, nil
+}
+
+// ComparePolicies simulates every input against policy A and policy B with otherwise identical requests
+func ComparePolicies(ctx context.Context, client IAMSimulator, policyA, policyB string, inputs []ComparisonInput) ([]ComparisonResult, error) {
+	results := make([]ComparisonResult, 0, len(inputs))
+	for _, in := range inputs {
+		decisionA, err := simulateDecision(ctx, client, policyA, in)
+		if err != nil {
+			return nil, fmt.Errorf("policy A, %s on %s: %v", in.Action, in.Resource, err)
+		}
+		decisionB, err := simulateDecision(ctx, client, policyB, in)
+		if err != nil {
+			return nil, fmt.Errorf("policy B, %s on %s: %v", in.Action, in.Resource, err)
+		}
+		results = append(results, ComparisonResult{Input: in, DecisionA: decisionA, DecisionB: decisionB})
+	}
+	return results, nil
+}
+
+// simulateDecision returns the decision for a single input against one policy
+func simulateDecision(ctx context.Context, client IAMSimulator, policy string, in ComparisonInput) (string, error) {
+	input := buildTestInput(SimulatorConfig{PolicyJSON: policy}, in.Action, []string{in.Resource}, nil, "")
+	resp, err := client.SimulateCustomPolicy(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.EvaluationResults) == 0 {
+		return "", fmt.Errorf("no evaluation results returned")
+	}
+	return string(resp.EvaluationResults[0].EvalDecision), nil
+}
+
+// PrintComparison prints the inputs allowed by only one of the policies and a summary verdict
+// Returns the number of inputs where the policies differ
+func PrintComparison(w io.Writer, nameA, nameB string, results []ComparisonResult) int {
+	allowed := string(types.PolicyEvaluationDecisionTypeAllowed)
+	var onlyA, onlyB []ComparisonResult
+	for _, r := range results {
+		switch {
+		case r.DecisionA == allowed && r.DecisionB != allowed:
+			onlyA = append(onlyA, r)
+		case r.DecisionB == allowed && r.DecisionA != allowed:
+			onlyB = append(onlyB, r)
+		}
+	}
+
+	fmt.Fprintf(w, "Comparing A (%s) with B (%s) over %d action(s)\n\n", nameA, nameB, len(results))
+	for _, group := range []struct {
+		title string
+		rows  []ComparisonResult
+	}{{"Allowed by A only", onlyA}, {"Allowed by B only", onlyB}} {
+		if len(group.rows) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s:\n", group.title)
+		for _, r := range group.rows {
+			fmt.Fprintf(w, "  %s on %s (A: %s, B: %s)\n", r.Input.Action, r.Input.Resource, r.DecisionA, r.DecisionB)
+		}
+		fmt.Fprintln(w)
+	}
+
+	switch {
+	case len(onlyA) == 0 && len(onlyB) == 0:
+		fmt.Fprintf(w, "Equivalent: both policies allow the same %d of %d action(s)\n", countAllowed(results), len(results))
+	case len(onlyB) == 0:
+		fmt.Fprintf(w, "B is strictly less permissive: it denies %d action(s) A allows\n", len(onlyA))
+	case len(onlyA) == 0:
+		fmt.Fprintf(w, "B is strictly more permissive: it allows %d action(s) A denies\n", len(onlyB))
+	default:
+		fmt.Fprintf(w, "Neither is a subset: A alone allows %d action(s), B alone allows %d\n", len(onlyA), len(onlyB))
+	}
+	return len(onlyA) + len(onlyB)
+}
+
+// countAllowed counts inputs allowed by policy A (equal to B's count when the policies are equivalent)
+func countAllowed(results []ComparisonResult) int {
+	n := 0
+	for _, r := range results {
+		if r.DecisionA == string(types.PolicyEvaluationDecisionTypeAllowed) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestParseActionsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "actions.txt")
+	content := "# comment\ns3:GetObject arn:aws:s3:::b/*\n\n  iam:PassRole  \n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	inputs, err := ParseActionsFile(path)
+	if err != nil {
+		t.Fatalf("ParseActionsFile() error = %v", err)
+	}
+	want := []ComparisonInput{
+		{Action: "s3:GetObject", Resource: "arn:aws:s3:::b/*"},
+		{Action: "iam:PassRole", Resource: "*"},
+	}
+	if len(inputs) != len(want) {
+		t.Fatalf("got %d inputs, want %d: %+v", len(inputs), len(want), inputs)
+	}
+	for i := range want {
+		if inputs[i] != want[i] {
+			t.Errorf("inputs[%d] = %+v, want %+v", i, inputs[i], want[i])
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.txt")
+	if err := os.WriteFile(bad, []byte("s3:GetObject a b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseActionsFile(bad); err == nil || !strings.Contains(err.Error(), "bad.txt:1") {
+		t.Errorf("expected line-numbered error, got %v", err)
+	}
+
+	empty := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(empty, []byte("# nothing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseActionsFile(empty); err == nil {
+		t.Error("expected error for a file with no actions")
+	}
+}
+
+func TestComparePolicies(t *testing.T) {
+	// Policy A allows everything; policy B only allows s3:GetObject
+	client := &mockIAMClient{
+		SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+			decision := types.PolicyEvaluationDecisionTypeImplicitDeny
+			if params.PolicyInputList[0] == "A" || params.ActionNames[0] == "s3:GetObject" {
+				decision = types.PolicyEvaluationDecisionTypeAllowed
+			}
+			return &iam.SimulateCustomPolicyOutput{
+				EvaluationResults: []types.EvaluationResult{{EvalDecision: decision}},
+			}, nil
+		},
+	}
+	inputs := []ComparisonInput{
+		{Action: "s3:GetObject", Resource: "*"},
+		{Action: "s3:PutObject", Resource: "arn:aws:s3:::b/*"},
+	}
+
+	results, err := ComparePolicies(context.Background(), client, "A", "B", inputs)
+	if err != nil {
+		t.Fatalf("ComparePolicies() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if diffs := PrintComparison(&buf, "a.json", "b.json", results); diffs != 1 {
+		t.Errorf("PrintComparison() = %d differences, want 1", diffs)
+	}
+	want := `Comparing A (a.json) with B (b.json) over 2 action(s)
+
+Allowed by A only:
+  s3:PutObject on arn:aws:s3:::b/* (A: allowed, B: implicitDeny)
+
+B is strictly less permissive: it denies 1 action(s) A allows
+`
+	if buf.String() != want {
+		t.Errorf("output mismatch\ngot:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if diffs := PrintComparison(&buf, "a.json", "a.json", results[:1]); diffs != 0 {
+		t.Errorf("PrintComparison() = %d differences, want 0", diffs)
+	}
+	if !strings.Contains(buf.String(), "Equivalent: both policies allow the same 1 of 1 action(s)") {
+		t.Errorf("expected equivalent verdict, got:\n%s", buf.String())
+	}
+}
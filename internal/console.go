@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// consoleHeaders mirror the IAM console policy simulator's results table
+var consoleHeaders = []string{"Action", "Resource", "Permission", "Matched statements"}
+
+// printConsoleResults prints one row per test in the layout of the IAM console policy simulator
+// Used by --format console-style, after the run, so stdout carries only the table
+func printConsoleResults(w io.Writer, results []testResult, cfg SimulatorConfig) {
+	rows := make([][]string, 0, len(results))
+	for _, r := range results {
+		rows = append(rows, []string{
+			r.Action,
+			IfEmpty(strings.Join(r.Resources, ", "), "*"),
+			consolePermission(r.Decision),
+			consoleStatements(r, cfg),
+		})
+	}
+	printColumns(w, consoleHeaders, rows)
+}
+
+// consolePermission collapses the decision to the console's Allowed/Denied wording
+func consolePermission(decision string) string {
+	switch {
+	case strings.EqualFold(decision, string(types.PolicyEvaluationDecisionTypeAllowed)):
+		return "Allowed"
+	case strings.EqualFold(decision, string(types.PolicyEvaluationDecisionTypeExplicitDeny)):
+		return "Denied (explicit)"
+	default:
+		return "Denied"
+	}
+}
+
+// consoleStatements lists each matched statement as its SourcePolicyId and, when resolved, its source Sid
+func consoleStatements(r testResult, cfg SimulatorConfig) string {
+	if r.Response == nil || len(r.Response.EvaluationResults) == 0 {
+		return "-"
+	}
+	matched := r.Response.EvaluationResults[0].MatchedStatements
+	if len(matched) == 0 {
+		return "no matching statements"
+	}
+	labels := make([]string, 0, len(matched))
+	for _, stmt := range matched {
+		label := AwsString(stmt.SourcePolicyId)
+		if cfg.SourceMap != nil {
+			if source, ok := resolveStatementSource(stmt, cfg); ok && source != nil && source.Sid != "" {
+				label += " (" + source.Sid + ")"
+			}
+		}
+		labels = append(labels, label)
+	}
+	return strings.Join(labels, ", ")
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestRunTestCollectionConsoleStyle(t *testing.T) {
+	originalExiter := GlobalExiter
+	originalStdout, originalStderr := Stdout, Stderr
+	defer func() {
+		GlobalExiter = originalExiter
+		Stdout, Stderr = originalStdout, originalStderr
+	}()
+	GlobalExiter = &mockExiter{}
+
+	var stdout, stderr strings.Builder
+	Stdout, Stderr = &stdout, &stderr
+
+	mockClient := &mockIAMClient{
+		SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+			action := params.ActionNames[0]
+			result := types.EvaluationResult{EvalActionName: &action, EvalDecision: types.PolicyEvaluationDecisionTypeImplicitDeny}
+			switch action {
+			case "s3:GetObject":
+				result.EvalDecision = types.PolicyEvaluationDecisionTypeAllowed
+				result.MatchedStatements = []types.Statement{{SourcePolicyId: StrPtr("PolicyInputList.1")}}
+			case "s3:DeleteBucket":
+				result.EvalDecision = types.PolicyEvaluationDecisionTypeExplicitDeny
+				result.MatchedStatements = []types.Statement{{SourcePolicyId: StrPtr("PermissionsBoundaryPolicyInputList.1")}}
+			}
+			return &iam.SimulateCustomPolicyOutput{EvaluationResults: []types.EvaluationResult{result}}, nil
+		},
+	}
+
+	scen := &Scenario{Tests: []TestCase{
+		{Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/*", Expect: "allowed"},
+		{Action: "s3:DeleteBucket", Resource: "arn:aws:s3:::bucket", Expect: "explicitDeny"},
+		{Action: "s3:PutObject", Expect: "implicitDeny"},
+	}}
+	RunTestCollection(mockClient, scen, SimulatorConfig{Format: FormatConsole, Variables: map[string]any{}})
+
+	want := `Action           Resource               Permission         Matched statements
+---------------  ---------------------  -----------------  ----------------------------------------
+s3:GetObject     arn:aws:s3:::bucket/*  Allowed            PolicyInputList.1
+s3:DeleteBucket  arn:aws:s3:::bucket    Denied (explicit)  PermissionsBoundaryPolicyInputList.1
+s3:PutObject     *                      Denied             no matching statements
+`
+	if stdout.String() != want {
+		t.Errorf("console table =\n%s\nwant:\n%s", stdout.String(), want)
+	}
+	// Human-readable output is kept off stdout
+	if !strings.Contains(stderr.String(), "Test Results: 3 passed, 0 failed") {
+		t.Errorf("expected summary on stderr, got: %s", stderr.String())
+	}
+}
+
+func TestConsoleStatementsResolvesSid(t *testing.T) {
+	scpPath := filepath.Join(t.TempDir(), "deny-regions.json")
+	if err := os.WriteFile(scpPath, []byte(`{"Version":"2012-10-17","Statement":[{"Sid":"DenyRegions","Effect":"Deny","Action":"*","Resource":"*"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	merged, sources, err := MergeSCPFilesWithSourceMap([]string{scpPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := ToJSONMin(merged)
+	cfg := SimulatorConfig{SourceMap: &PolicySourceMap{PermissionsBoundary: sources, PermissionsBoundaryRaw: raw}}
+
+	stmt := matchedStatementAt(t, "PermissionsBoundaryPolicyInputList.1", raw, "scp:deny-regions.json#stmt:0")
+	r := testResult{Response: &iam.SimulateCustomPolicyOutput{EvaluationResults: []types.EvaluationResult{{MatchedStatements: []types.Statement{stmt}}}}}
+	if got, want := consoleStatements(r, cfg), "PermissionsBoundaryPolicyInputList.1 (DenyRegions)"; got != want {
+		t.Errorf("consoleStatements() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// DoctorResult is the outcome of a single environment check run by `politest doctor`
+type DoctorResult struct {
+	Name     string // Short description of what was checked
+	OK       bool   // Whether the check passed
+	Critical bool   // Whether a failure should cause a non-zero exit
+	Detail   string // What was found (shown for passes and failures)
+	Hint     string // Remediation hint shown on failure
+}
+
+// CheckCredentials verifies that AWS credentials can be resolved from the default chain
+func CheckCredentials(ctx context.Context, cfg aws.Config) DoctorResult {
+	result := DoctorResult{Name: "AWS credentials", Critical: true}
+	if cfg.Credentials == nil {
+		result.Detail = "no credential provider configured"
+		result.Hint = "configure credentials via environment variables, ~/.aws/credentials, SSO or an instance role"
+		return result
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		result.Detail = err.Error()
+		result.Hint = "configure credentials via environment variables, ~/.aws/credentials, SSO or an instance role"
+		return result
+	}
+	result.OK = true
+	result.Detail = "resolved from " + IfEmpty(creds.Source, "default chain")
+	return result
+}
+
+// CheckRegion reports the configured AWS region
+// IAM is a global service, so a missing region is a warning rather than a critical failure
+func CheckRegion(cfg aws.Config) DoctorResult {
+	result := DoctorResult{Name: "AWS region"}
+	if cfg.Region == "" {
+		result.Detail = "no region configured"
+		result.Hint = "set AWS_REGION or a region in ~/.aws/config"
+		return result
+	}
+	result.OK = true
+	result.Detail = cfg.Region
+	return result
+}
+
+// CheckCallerIdentity verifies the credentials are valid by calling sts:GetCallerIdentity
+func CheckCallerIdentity(ctx context.Context, client CallerIdentityGetter) DoctorResult {
+	result := DoctorResult{Name: "sts:GetCallerIdentity", Critical: true}
+	out, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		result.Detail = err.Error()
+		result.Hint = "check the credentials are valid and not expired (e.g. re-run aws sso login)"
+		return result
+	}
+	result.OK = true
+	result.Detail = AwsString(out.Arn)
+	return result
+}
+
+// CheckSimulatePermission verifies iam:SimulateCustomPolicy can be called with a trivial policy
+func CheckSimulatePermission(ctx context.Context, client IAMSimulator) DoctorResult {
+	result := DoctorResult{Name: "iam:SimulateCustomPolicy", Critical: true}
+	_, err := client.SimulateCustomPolicy(ctx, &iam.SimulateCustomPolicyInput{
+		PolicyInputList: []string{`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`},
+		ActionNames:     []string{"s3:GetObject"},
+	})
+	if err != nil {
+		result.Detail = err.Error()
+		result.Hint = "grant iam:SimulateCustomPolicy to the calling principal"
+		return result
+	}
+	result.OK = true
+	result.Detail = "permitted"
+	return result
+}
+
+// PrintDoctorReport prints a ✓/✗ checklist and returns false if any critical check failed
+func PrintDoctorReport(w io.Writer, results []DoctorResult) bool {
+	healthy := printChecklist(w, results)
+	if healthy {
+		fmt.Fprintln(w, "Environment looks good.")
+	} else {
+		fmt.Fprintln(w, "Environment has problems that will prevent politest from running.")
+	}
+	return healthy
+}
+
+// PrintSelfTestReport prints the `politest selftest` checklist and returns false if any check failed
+func PrintSelfTestReport(w io.Writer, results []DoctorResult) bool {
+	passed := printChecklist(w, results)
+	if passed {
+		fmt.Fprintln(w, "Self-test passed.")
+	} else {
+		fmt.Fprintln(w, "Self-test failed: the test engine did not behave as expected.")
+	}
+	return passed
+}
+
+// printChecklist prints one ✓/✗/⚠️ line per result followed by a blank line
+// Returns false if any critical check failed
+func printChecklist(w io.Writer, results []DoctorResult) bool {
+	healthy := true
+	for _, r := range results {
+		switch {
+		case r.OK:
+			fmt.Fprintf(w, "✓ %s: %s\n", r.Name, r.Detail)
+		case r.Critical:
+			healthy = false
+			fmt.Fprintf(w, "✗ %s: %s\n", r.Name, r.Detail)
+		default:
+			fmt.Fprintf(w, "⚠️  %s: %s\n", r.Name, r.Detail)
+		}
+		if !r.OK && r.Hint != "" {
+			fmt.Fprintf(w, "    → %s\n", r.Hint)
+		}
+	}
+	fmt.Fprintln(w)
+	return healthy
+}
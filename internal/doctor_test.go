@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+type mockSTSClient struct {
+	GetCallerIdentityFunc func(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+func (m *mockSTSClient) GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return m.GetCallerIdentityFunc(ctx, params, optFns...)
+}
+
+func TestCheckCredentials(t *testing.T) {
+	ctx := context.Background()
+
+	if r := CheckCredentials(ctx, aws.Config{}); r.OK || !r.Critical {
+		t.Errorf("Expected critical failure with no credential provider, got %+v", r)
+	}
+
+	failing := aws.Config{Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{}, errors.New("no credentials")
+	})}
+	if r := CheckCredentials(ctx, failing); r.OK || !strings.Contains(r.Detail, "no credentials") {
+		t.Errorf("Expected failure with provider error, got %+v", r)
+	}
+
+	working := aws.Config{Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKIA", SecretAccessKey: "secret", Source: "EnvConfigCredentials"}, nil
+	})}
+	if r := CheckCredentials(ctx, working); !r.OK || !strings.Contains(r.Detail, "EnvConfigCredentials") {
+		t.Errorf("Expected success with credential source, got %+v", r)
+	}
+}
+
+func TestCheckRegion(t *testing.T) {
+	if r := CheckRegion(aws.Config{}); r.OK || r.Critical {
+		t.Errorf("Expected non-critical failure with no region, got %+v", r)
+	}
+	if r := CheckRegion(aws.Config{Region: "eu-west-2"}); !r.OK || r.Detail != "eu-west-2" {
+		t.Errorf("Expected region to be reported, got %+v", r)
+	}
+}
+
+func TestCheckCallerIdentity(t *testing.T) {
+	ctx := context.Background()
+	arn := "arn:aws:iam::123456789012:user/alice"
+
+	ok := &mockSTSClient{GetCallerIdentityFunc: func(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+		return &sts.GetCallerIdentityOutput{Arn: &arn}, nil
+	}}
+	if r := CheckCallerIdentity(ctx, ok); !r.OK || r.Detail != arn {
+		t.Errorf("Expected caller ARN in detail, got %+v", r)
+	}
+
+	failing := &mockSTSClient{GetCallerIdentityFunc: func(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+		return nil, errors.New("ExpiredToken")
+	}}
+	if r := CheckCallerIdentity(ctx, failing); r.OK || !r.Critical || r.Hint == "" {
+		t.Errorf("Expected critical failure with hint, got %+v", r)
+	}
+}
+
+func TestCheckSimulatePermission(t *testing.T) {
+	ctx := context.Background()
+
+	ok := &mockIAMClient{SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+		return &iam.SimulateCustomPolicyOutput{}, nil
+	}}
+	if r := CheckSimulatePermission(ctx, ok); !r.OK {
+		t.Errorf("Expected success, got %+v", r)
+	}
+
+	denied := &mockIAMClient{SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+		return nil, errors.New("AccessDenied")
+	}}
+	if r := CheckSimulatePermission(ctx, denied); r.OK || !strings.Contains(r.Hint, "iam:SimulateCustomPolicy") {
+		t.Errorf("Expected failure with permission hint, got %+v", r)
+	}
+}
+
+func TestPrintDoctorReport(t *testing.T) {
+	var buf bytes.Buffer
+	healthy := PrintDoctorReport(&buf, []DoctorResult{
+		{Name: "AWS credentials", OK: true, Critical: true, Detail: "resolved"},
+		{Name: "AWS region", Detail: "no region configured", Hint: "set AWS_REGION"},
+	})
+	if !healthy {
+		t.Error("Expected healthy report when only non-critical checks fail")
+	}
+	output := buf.String()
+	if !strings.Contains(output, "✓ AWS credentials") || !strings.Contains(output, "→ set AWS_REGION") {
+		t.Errorf("Unexpected report output:\n%s", output)
+	}
+
+	buf.Reset()
+	healthy = PrintDoctorReport(&buf, []DoctorResult{
+		{Name: "sts:GetCallerIdentity", Critical: true, Detail: "ExpiredToken"},
+	})
+	if healthy {
+		t.Error("Expected unhealthy report when a critical check fails")
+	}
+	if !strings.Contains(buf.String(), "✗ sts:GetCallerIdentity") {
+		t.Errorf("Expected failure marker in output:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/aws/smithy-go"
+)
+
+// ScenarioError reports an invalid scenario or test definition
+type ScenarioError struct {
+	Msg string
+}
+
+func (e *ScenarioError) Error() string { return e.Msg }
+
+// newScenarioError formats a ScenarioError
+func newScenarioError(f string, a ...any) error {
+	return &ScenarioError{Msg: fmt.Sprintf(f, a...)}
+}
+
+// PolicyValidationError reports a policy document or template that isn't valid JSON
+type PolicyValidationError struct {
+	Kind string // What was being loaded, e.g. "resource policy file" or "template"
+	Path string
+	Err  error
+}
+
+func (e *PolicyValidationError) Error() string {
+	return fmt.Sprintf("invalid JSON in %s %s: %v", e.Kind, e.Path, e.Err)
+}
+
+func (e *PolicyValidationError) Unwrap() error { return e.Err }
+
+// YAMLError reports a scenario, vars or expectations file that isn't valid YAML
+type YAMLError struct {
+	Path string
+	Err  error
+}
+
+func (e *YAMLError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *YAMLError) Unwrap() error { return e.Err }
+
+// yamlErrorLine finds the first "line N:" in a yaml.v3 error message
+var yamlErrorLine = regexp.MustCompile(`line (\d+):`)
+
+// SimulationError wraps a failed SimulateCustomPolicy call
+type SimulationError struct {
+	Test string // Name of the test being simulated
+	Err  error
+}
+
+func (e *SimulationError) Error() string {
+	return fmt.Sprintf("test %s: simulation failed: %v", e.Test, e.Err)
+}
+
+func (e *SimulationError) Unwrap() error { return e.Err }
+
+// ReportedError is an error already classified elsewhere, such as the report a --parallel-scenarios
+// process printed under --error-format json; ClassifyError keeps its kind, code, file and line
+type ReportedError struct {
+	Report ErrorReport
+}
+
+func (e *ReportedError) Error() string { return e.Report.Error }
+
+// TestFailureError is returned by RunTests when expectations were not met
+type TestFailureError struct {
+	Failed int
+}
+
+func (e *TestFailureError) Error() string {
+	return fmt.Sprintf("%d test(s) failed", e.Failed)
+}
+
+// ExitCodeFor maps an error returned by RunTests to the CLI exit code
+func ExitCodeFor(err error) int {
+	var failure *TestFailureError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &failure):
+		return ExitCodeFailure
+	default:
+		return ExitCodeError
+	}
+}
+
+// Formats accepted by --error-format
+const (
+	ErrorFormatText = "text"
+	ErrorFormatJSON = "json"
+)
+
+// ErrorFormat selects how PrintError, Check and Die report errors; set from --error-format
+var ErrorFormat = ErrorFormatText
+
+// Error kinds reported by --error-format json
+const (
+	ErrorKindScenario     = "scenario"       // invalid scenario or test definition
+	ErrorKindYAML         = "yaml"           // a YAML file that doesn't parse
+	ErrorKindPolicy       = "policy"         // a policy document or template that isn't valid JSON
+	ErrorKindFileNotFound = "file_not_found" // a referenced file doesn't exist
+	ErrorKindAWS          = "aws"            // an AWS API call was rejected (see Code)
+	ErrorKindSimulation   = "simulation"     // a simulation failed without an AWS error code
+	ErrorKindOther        = "error"          // anything else
+)
+
+// ErrorReport is the JSON object --error-format json prints for an error
+type ErrorReport struct {
+	Error string `json:"error"`
+	Kind  string `json:"kind"`
+	Code  string `json:"code,omitempty"` // AWS error code for ErrorKindAWS, e.g. AccessDenied
+	File  string `json:"file,omitempty"`
+	Line  int    `json:"line,omitempty"`
+}
+
+// ClassifyError describes err for --error-format json using the structured error types
+func ClassifyError(err error) ErrorReport {
+	report := ErrorReport{Error: err.Error(), Kind: ErrorKindOther}
+	var (
+		scenarioErr   *ScenarioError
+		yamlErr       *YAMLError
+		policyErr     *PolicyValidationError
+		pathErr       *fs.PathError
+		apiErr        smithy.APIError
+		simulationErr *SimulationError
+		reportedErr   *ReportedError
+	)
+	switch {
+	case errors.As(err, &reportedErr):
+		// Keep the outer message, e.g. the scenario file --keep-going prefixes
+		report.Kind, report.Code = reportedErr.Report.Kind, reportedErr.Report.Code
+		report.File, report.Line = reportedErr.Report.File, reportedErr.Report.Line
+	case errors.As(err, &scenarioErr):
+		report.Kind = ErrorKindScenario
+	case errors.As(err, &yamlErr):
+		report.Kind = ErrorKindYAML
+		report.File = yamlErr.Path
+		if m := yamlErrorLine.FindStringSubmatch(yamlErr.Err.Error()); m != nil {
+			report.Line, _ = strconv.Atoi(m[1])
+		}
+	case errors.As(err, &policyErr):
+		report.Kind = ErrorKindPolicy
+		report.File = policyErr.Path
+		report.Line = policyErrorLine(policyErr)
+	case errors.As(err, &pathErr) && errors.Is(err, fs.ErrNotExist):
+		report.Kind = ErrorKindFileNotFound
+		report.File = pathErr.Path
+	case errors.As(err, &apiErr):
+		report.Kind = ErrorKindAWS
+		report.Code = apiErr.ErrorCode()
+	case errors.As(err, &simulationErr):
+		report.Kind = ErrorKindSimulation
+	}
+	return report
+}
+
+// policyErrorLine converts a JSON syntax error's byte offset to a line in the policy file
+// A truncated document is reported at its last line. Templates are skipped: the offset points
+// into the rendered output, not the file
+func policyErrorLine(e *PolicyValidationError) int {
+	var syntaxErr *json.SyntaxError
+	truncated := errors.Is(e.Err, io.ErrUnexpectedEOF)
+	if e.Kind == "template" || (!truncated && !errors.As(e.Err, &syntaxErr)) {
+		return 0
+	}
+	b, err := os.ReadFile(e.Path)
+	if err != nil {
+		return 0
+	}
+	offset := int64(len(bytes.TrimRight(b, " \t\r\n")))
+	if !truncated {
+		offset = syntaxErr.Offset
+	}
+	if offset > int64(len(b)) {
+		return 0
+	}
+	line := 1
+	for _, c := range b[:offset] {
+		if c == '\n' {
+			line++
+		}
+	}
+	return line
+}
+
+// PrintError writes err to w as text, or as an ErrorReport line under --error-format json
+func PrintError(w io.Writer, err error) {
+	if ErrorFormat != ErrorFormatJSON {
+		fmt.Fprintf(w, "%v\n", err)
+		return
+	}
+	b, _ := json.Marshal(ClassifyError(err))
+	fmt.Fprintf(w, "%s\n", b)
+}
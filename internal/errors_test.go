@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestExitCodeFor(t *testing.T) {
+	originalError, originalFailure := ExitCodeError, ExitCodeFailure
+	defer func() { ExitCodeError, ExitCodeFailure = originalError, originalFailure }()
+	ExitCodeError, ExitCodeFailure = 7, 9
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, 0},
+		{"test failure", &TestFailureError{Failed: 2}, 9},
+		{"scenario error", newScenarioError("bad test"), 7},
+		{"simulation error", &SimulationError{Test: "t", Err: errors.New("throttled")}, 7},
+	}
+	for _, tt := range tests {
+		if got := ExitCodeFor(tt.err); got != tt.want {
+			t.Errorf("ExitCodeFor(%s) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tmpDir := t.TempDir()
+	badYAML := filepath.Join(tmpDir, "scenario.yml")
+	if err := os.WriteFile(badYAML, []byte("tests:\n  - action: [\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var s Scenario
+	yamlErr := LoadYAML(badYAML, &s)
+
+	badPolicy := filepath.Join(tmpDir, "policy.json")
+	if err := os.WriteFile(badPolicy, []byte("{\n  \"Version\": \"2012-10-17\",\n  \"Statement\": [,]\n}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var doc any
+	policyErr := &PolicyValidationError{Kind: "resource policy file", Path: badPolicy, Err: json.Unmarshal(mustReadFile(t, badPolicy), &doc)}
+
+	_, notFound := os.ReadFile(filepath.Join(tmpDir, "missing.json"))
+	accessDenied := &SimulationError{Test: "t", Err: &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized"}}
+
+	tests := []struct {
+		name string
+		err  error
+		want ErrorReport
+	}{
+		{"scenario", fmt.Errorf("wrapped: %w", newScenarioError("bad test")), ErrorReport{Kind: ErrorKindScenario}},
+		{"yaml", yamlErr, ErrorReport{Kind: ErrorKindYAML, File: badYAML, Line: 2}},
+		{"policy", policyErr, ErrorReport{Kind: ErrorKindPolicy, File: badPolicy, Line: 3}},
+		{"file not found", notFound, ErrorReport{Kind: ErrorKindFileNotFound, File: filepath.Join(tmpDir, "missing.json")}},
+		{"aws", accessDenied, ErrorReport{Kind: ErrorKindAWS, Code: "AccessDenied"}},
+		{"simulation", &SimulationError{Test: "t", Err: errors.New("timeout")}, ErrorReport{Kind: ErrorKindSimulation}},
+		{"reported", fmt.Errorf("a.yml: %w", &ReportedError{Report: ErrorReport{Error: "bad", Kind: ErrorKindPolicy, File: badPolicy, Line: 3}}), ErrorReport{Kind: ErrorKindPolicy, File: badPolicy, Line: 3}},
+		{"other", errors.New("boom"), ErrorReport{Kind: ErrorKindOther}},
+	}
+	for _, tt := range tests {
+		got := ClassifyError(tt.err)
+		tt.want.Error = tt.err.Error()
+		if got != tt.want {
+			t.Errorf("ClassifyError(%s) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPrintErrorJSON(t *testing.T) {
+	originalFormat := ErrorFormat
+	defer func() { ErrorFormat = originalFormat }()
+
+	var out strings.Builder
+	PrintError(&out, newScenarioError("bad test"))
+	if out.String() != "bad test\n" {
+		t.Errorf("Text format = %q, want the plain message", out.String())
+	}
+
+	ErrorFormat = ErrorFormatJSON
+	out.Reset()
+	PrintError(&out, newScenarioError("bad test"))
+	if out.String() != `{"error":"bad test","kind":"scenario"}`+"\n" {
+		t.Errorf("JSON format = %q", out.String())
+	}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRunTestsReturnsErrorsWithoutExiting(t *testing.T) {
+	originalExiter := GlobalExiter
+	defer func() { GlobalExiter = originalExiter }()
+	mockExit := &mockExiter{}
+	GlobalExiter = mockExit
+
+	decision := types.PolicyEvaluationDecisionTypeImplicitDeny
+	var simErr error
+	mockClient := &mockIAMClient{
+		SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+			if simErr != nil {
+				return nil, simErr
+			}
+			action := params.ActionNames[0]
+			return &iam.SimulateCustomPolicyOutput{
+				EvaluationResults: []types.EvaluationResult{{EvalActionName: &action, EvalDecision: decision}},
+			}, nil
+		},
+	}
+	scen := &Scenario{Tests: []TestCase{{Name: "read", Action: "s3:GetObject", Expect: "allowed"}}}
+	cfg := SimulatorConfig{Variables: map[string]any{}}
+
+	var failure *TestFailureError
+	if err := RunTests(mockClient, scen, cfg); !errors.As(err, &failure) || failure.Failed != 1 {
+		t.Errorf("RunTests() error = %v, want *TestFailureError with 1 failure", err)
+	}
+
+	cfg.NoAssert = true
+	if err := RunTests(mockClient, scen, cfg); err != nil {
+		t.Errorf("RunTests() with NoAssert error = %v, want nil", err)
+	}
+
+	simErr = errors.New("AccessDenied")
+	var simulationErr *SimulationError
+	if err := RunTests(mockClient, scen, cfg); !errors.As(err, &simulationErr) || simulationErr.Test != "read" {
+		t.Errorf("RunTests() error = %v, want *SimulationError for test read", err)
+	}
+
+	var scenErr *ScenarioError
+	if err := RunTests(mockClient, &Scenario{Tests: []TestCase{{Name: "no action"}}}, cfg); !errors.As(err, &scenErr) {
+		t.Errorf("RunTests() error = %v, want *ScenarioError", err)
+	}
+
+	if mockExit.called {
+		t.Error("RunTests() should never call Exit")
+	}
+}
+
+func TestRenderTemplateFileErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	invalid := filepath.Join(tmpDir, "invalid.json.tpl")
+	if err := os.WriteFile(invalid, []byte(`{not json {{.v}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var policyErr *PolicyValidationError
+	if _, err := RenderTemplateFile(invalid, map[string]any{"v": "x"}); !errors.As(err, &policyErr) || policyErr.Kind != "template" {
+		t.Errorf("RenderTemplateFile() error = %v, want *PolicyValidationError", err)
+	}
+
+	badSyntax := filepath.Join(tmpDir, "syntax.json.tpl")
+	if err := os.WriteFile(badSyntax, []byte(`{"a": "{{.v"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RenderTemplateFile(badSyntax, map[string]any{}); err == nil {
+		t.Error("RenderTemplateFile() expected error for template syntax error, got nil")
+	}
+
+	if _, err := RenderTemplateFile(filepath.Join(tmpDir, "missing.tpl"), nil); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("RenderTemplateFile() error = %v, want os.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// exactActionsResult is the outcome of the allowed_actions_exactly check
+type exactActionsResult struct {
+	Checked    int
+	Unexpected []string          // allowed but not in allowed_actions_exactly
+	Missing    map[string]string // in allowed_actions_exactly but not allowed -> decision
+}
+
+// Passed reports whether the policies allow exactly the expected actions
+func (r exactActionsResult) Passed() bool {
+	return len(r.Unexpected) == 0 && len(r.Missing) == 0
+}
+
+// exactActionCandidates returns allowed_actions_exactly plus candidate_actions, rendered and de-duplicated in order
+func exactActionCandidates(scen *Scenario, vars map[string]any) (expected map[string]bool, candidates []string, err error) {
+	expected = map[string]bool{}
+	seen := map[string]bool{}
+	add := func(action string) {
+		if !seen[action] {
+			seen[action] = true
+			candidates = append(candidates, action)
+		}
+	}
+	for _, a := range scen.AllowedActionsExactly {
+		action, err := RenderTemplateText(a, vars)
+		if err != nil {
+			return nil, nil, newScenarioError("allowed_actions_exactly: %v", err)
+		}
+		expected[action] = true
+		add(action)
+	}
+	for _, a := range scen.CandidateActions {
+		action, err := RenderTemplateText(a, vars)
+		if err != nil {
+			return nil, nil, newScenarioError("candidate_actions: %v", err)
+		}
+		add(action)
+	}
+	return expected, candidates, nil
+}
+
+// checkExactActions simulates every candidate action in one batched request (following pagination)
+// with the scenario's identity policies, boundary, caller and context against resource "*"
+func checkExactActions(client IAMSimulator, scen *Scenario, cfg SimulatorConfig) (exactActionsResult, error) {
+	expected, candidates, err := exactActionCandidates(scen, cfg.Variables)
+	if err != nil {
+		return exactActionsResult{}, err
+	}
+	if !cfg.NoWarn {
+		for _, action := range candidates {
+			warnWildcardAction(action)
+		}
+	}
+
+	baseCtx := overlayContextEntries(cfg.GlobalContext, append(servicePrincipalContext(scen, TestCase{}), regionContext(scen, TestCase{})...))
+	ctxEntries, err := mergeContextEntries(overlayContextEntries(baseCtx, scen.Context), nil, cfg.Variables)
+	if err != nil {
+		return exactActionsResult{}, err
+	}
+	input := buildTestInput(cfg, "", []string{"*"}, ctxEntries, "")
+	input.ActionNames = candidates
+	if err := applyTestOverrides(input, scen, TestCase{}, cfg.Variables); err != nil {
+		return exactActionsResult{}, err
+	}
+
+	// With SCPs and a permissions boundary, each layer is its own pass and the stricter decision wins
+	decisions := map[string]types.PolicyEvaluationDecisionType{}
+	passes := boundaryPasses(cfg)
+	if len(passes) == 0 {
+		passes = []boundaryPass{{}}
+	}
+	for _, pass := range passes {
+		passInput := *input
+		if pass.policy != "" {
+			passInput.PermissionsBoundaryPolicyInputList = []string{pass.policy}
+		}
+		passDecisions, err := simulateCandidateActions(client, &passInput)
+		if err != nil {
+			return exactActionsResult{}, err
+		}
+		for action, decision := range passDecisions {
+			if current, ok := decisions[action]; !ok || decisionRank(decision) > decisionRank(current) {
+				decisions[action] = decision
+			}
+		}
+	}
+
+	result := exactActionsResult{Checked: len(candidates), Missing: map[string]string{}}
+	allowed := string(types.PolicyEvaluationDecisionTypeAllowed)
+	for _, action := range candidates {
+		decision := "no result"
+		if d, ok := decisions[action]; ok {
+			decision = string(d)
+		}
+		switch {
+		case expected[action] && decision != allowed:
+			result.Missing[action] = decision
+		case !expected[action] && decision == allowed:
+			result.Unexpected = append(result.Unexpected, action)
+		}
+	}
+	return result, nil
+}
+
+// simulateCandidateActions runs one batched simulation, following pagination, and returns each action's decision
+func simulateCandidateActions(client IAMSimulator, input *iam.SimulateCustomPolicyInput) (map[string]types.PolicyEvaluationDecisionType, error) {
+	decisions := map[string]types.PolicyEvaluationDecisionType{}
+	for {
+		resp, err := client.SimulateCustomPolicy(context.Background(), input)
+		if err != nil {
+			return nil, &SimulationError{Test: "allowed_actions_exactly", Err: err}
+		}
+		for _, r := range resp.EvaluationResults {
+			decisions[AwsString(r.EvalActionName)] = r.EvalDecision
+		}
+		if !resp.IsTruncated || resp.Marker == nil {
+			return decisions, nil
+		}
+		input.Marker = resp.Marker
+	}
+}
+
+// printExactActionsResult prints the allowed_actions_exactly check with extras and missing grants listed separately
+func printExactActionsResult(r exactActionsResult, expectedCount int) {
+	fmt.Fprintf(Stdout, "[allowed_actions_exactly] %d expected action(s) among %d checked\n", expectedCount, r.Checked)
+	if r.Passed() {
+		fmt.Fprintf(Stdout, "  ✓ PASS: exactly the expected action(s) are allowed\n\n")
+		return
+	}
+	fmt.Fprintf(Stdout, "  ✗ FAIL:\n")
+	if len(r.Unexpected) > 0 {
+		fmt.Fprintf(Stdout, "    Unexpectedly allowed (%d):\n", len(r.Unexpected))
+		for _, action := range r.Unexpected {
+			fmt.Fprintf(Stdout, "      - %s\n", action)
+		}
+	}
+	if len(r.Missing) > 0 {
+		missing := make([]string, 0, len(r.Missing))
+		for action := range r.Missing {
+			missing = append(missing, action)
+		}
+		sort.Strings(missing)
+		fmt.Fprintf(Stdout, "    Expected but not allowed (%d):\n", len(missing))
+		for _, action := range missing {
+			fmt.Fprintf(Stdout, "      - %s (%s)\n", action, r.Missing[action])
+		}
+	}
+	fmt.Fprintln(Stdout)
+}
+
+// hasExactActions reports whether the scenario uses allowed_actions_exactly
+func hasExactActions(scen *Scenario) bool {
+	return len(scen.AllowedActionsExactly) > 0 || len(scen.CandidateActions) > 0
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestRunTestsAllowedActionsExactly(t *testing.T) {
+	oldStdout := Stdout
+	defer func() { Stdout = oldStdout }()
+
+	allowed := map[string]bool{"s3:GetObject": true, "s3:ListBucket": true, "s3:DeleteObject": true}
+	calls := 0
+	client := &mockIAMClient{
+		SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+			calls++
+			// Return the batch two results per page to exercise pagination
+			start := 0
+			if params.Marker != nil {
+				start = 2
+			}
+			out := &iam.SimulateCustomPolicyOutput{}
+			for _, action := range params.ActionNames[start:min(start+2, len(params.ActionNames))] {
+				decision := types.PolicyEvaluationDecisionTypeImplicitDeny
+				if allowed[action] {
+					decision = types.PolicyEvaluationDecisionTypeAllowed
+				}
+				out.EvaluationResults = append(out.EvaluationResults, types.EvaluationResult{EvalActionName: aws.String(action), EvalDecision: decision})
+			}
+			if start == 0 && len(params.ActionNames) > 2 {
+				out.IsTruncated, out.Marker = true, aws.String("page2")
+			}
+			return out, nil
+		},
+	}
+	scen := &Scenario{
+		AllowedActionsExactly: []string{"s3:GetObject", "s3:ListBucket", "s3:PutObject"},
+		CandidateActions:      []string{"s3:DeleteObject", "s3:GetObject"},
+	}
+
+	var out strings.Builder
+	Stdout = &out
+	err := RunTests(client, scen, SimulatorConfig{Variables: map[string]any{}})
+
+	var failure *TestFailureError
+	if !errors.As(err, &failure) || failure.Failed != 1 {
+		t.Fatalf("Expected one failed check, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected one batched request over 2 pages, got %d calls", calls)
+	}
+	for _, want := range []string{
+		"[allowed_actions_exactly] 3 expected action(s) among 4 checked",
+		"Unexpectedly allowed (1):\n      - s3:DeleteObject\n",
+		"Expected but not allowed (1):\n      - s3:PutObject (implicitDeny)\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in output:\n%s", want, out.String())
+		}
+	}
+
+	allowed["s3:PutObject"], allowed["s3:DeleteObject"] = true, false
+	out.Reset()
+	if err := RunTests(client, scen, SimulatorConfig{Variables: map[string]any{}}); err != nil {
+		t.Fatalf("Expected exact match to pass, got %v", err)
+	}
+	if !strings.Contains(out.String(), "✓ PASS: exactly the expected action(s) are allowed") {
+		t.Errorf("Expected pass output, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GeneratedTest is a test case derived from an Allow statement in a policy
+type GeneratedTest struct {
+	Action   string
+	Resource string // Set only when the statement has a single Resource
+}
+
+// ActionsFromPolicy collects the actions granted by the policies' Allow statements, in policy order
+// Concrete actions become tests; wildcard actions are returned separately because expanding them
+// requires a service reference (action catalog), which politest does not bundle
+func ActionsFromPolicy(policyJSONs ...string) ([]GeneratedTest, []string, error) {
+	var statements []any
+	for _, policyJSON := range policyJSONs {
+		var policy map[string]any
+		if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
+			return nil, nil, fmt.Errorf("invalid policy JSON: %v", err)
+		}
+		switch st := policy["Statement"].(type) {
+		case []any:
+			statements = append(statements, st...)
+		case map[string]any:
+			statements = append(statements, st)
+		}
+	}
+
+	var tests []GeneratedTest
+	var wildcards []string
+	seen := map[string]bool{}
+	for _, raw := range statements {
+		stmt, ok := raw.(map[string]any)
+		if !ok || stmt["Effect"] != "Allow" {
+			continue
+		}
+		resource, _ := stmt["Resource"].(string)
+		for _, action := range stringOrList(stmt["Action"]) {
+			if seen[action] {
+				continue
+			}
+			seen[action] = true
+			if strings.ContainsAny(action, "*?") {
+				wildcards = append(wildcards, action)
+				continue
+			}
+			tests = append(tests, GeneratedTest{Action: action, Resource: resource})
+		}
+	}
+	return tests, wildcards, nil
+}
+
+// stringOrList normalizes an IAM field that may be a string or a list of strings
+func stringOrList(v any) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []any:
+		out := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// WriteGeneratedTests writes a tests: YAML block with one allowed expectation per action
+// Wildcard actions are listed as comments so they can be expanded by hand
+func WriteGeneratedTests(w io.Writer, source string, tests []GeneratedTest, wildcards []string) {
+	fmt.Fprintf(w, "# Generated by politest --actions-from-policy from %s\n", source)
+	fmt.Fprintf(w, "# Review each expectation before committing\n")
+	fmt.Fprintf(w, "tests:\n")
+	for _, t := range tests {
+		fmt.Fprintf(w, "  - name: %q\n", t.Action)
+		fmt.Fprintf(w, "    action: %q\n", t.Action)
+		if t.Resource != "" {
+			fmt.Fprintf(w, "    resource: %q\n", t.Resource)
+		}
+		fmt.Fprintf(w, "    expect: \"allowed\"\n")
+	}
+	if len(tests) == 0 {
+		fmt.Fprintf(w, "  [] # no concrete actions found in Allow statements\n")
+	}
+	if len(wildcards) > 0 {
+		fmt.Fprintf(w, "# Wildcard actions need a service reference to expand; add concrete actions for:\n")
+		for _, a := range wildcards {
+			fmt.Fprintf(w, "#   - %s\n", a)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestActionsFromPolicy(t *testing.T) {
+	identity := `{"Version":"2012-10-17","Statement":[
+		{"Effect":"Allow","Action":["s3:GetObject","s3:List*"],"Resource":"arn:aws:s3:::bucket/*"},
+		{"Effect":"Deny","Action":"s3:DeleteObject","Resource":"*"},
+		{"Effect":"Allow","Action":"ec2:DescribeInstances","Resource":["*"]}
+	]}`
+	extra := `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}}`
+
+	tests, wildcards, err := ActionsFromPolicy(identity, extra)
+	if err != nil {
+		t.Fatalf("ActionsFromPolicy() error = %v", err)
+	}
+
+	want := []GeneratedTest{
+		{Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/*"},
+		{Action: "ec2:DescribeInstances"},
+	}
+	if len(tests) != len(want) {
+		t.Fatalf("ActionsFromPolicy() = %+v, want %+v", tests, want)
+	}
+	for i := range want {
+		if tests[i] != want[i] {
+			t.Errorf("test %d = %+v, want %+v", i, tests[i], want[i])
+		}
+	}
+	if len(wildcards) != 1 || wildcards[0] != "s3:List*" {
+		t.Errorf("wildcards = %v, want [s3:List*]", wildcards)
+	}
+
+	if _, _, err := ActionsFromPolicy(`{not json`); err == nil {
+		t.Error("ActionsFromPolicy() expected error for invalid JSON")
+	}
+}
+
+func TestWriteGeneratedTests(t *testing.T) {
+	var out strings.Builder
+	WriteGeneratedTests(&out, "scenario.yml", []GeneratedTest{
+		{Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/*"},
+		{Action: "ec2:DescribeInstances"},
+	}, []string{"s3:List*"})
+
+	var parsed Scenario
+	if err := yaml.Unmarshal([]byte(out.String()), &parsed); err != nil {
+		t.Fatalf("generated YAML does not parse: %v\n%s", err, out.String())
+	}
+	if len(parsed.Tests) != 2 {
+		t.Fatalf("expected 2 tests, got %d", len(parsed.Tests))
+	}
+	if parsed.Tests[0].Action != "s3:GetObject" || parsed.Tests[0].Resource != "arn:aws:s3:::bucket/*" || parsed.Tests[0].Expect != "allowed" {
+		t.Errorf("unexpected first test: %+v", parsed.Tests[0])
+	}
+	if !strings.Contains(out.String(), "#   - s3:List*") {
+		t.Errorf("expected wildcard comment, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	WriteGeneratedTests(&out, "scenario.yml", nil, nil)
+	if err := yaml.Unmarshal([]byte(out.String()), &parsed); err != nil {
+		t.Errorf("empty generated YAML does not parse: %v\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Groupings accepted by --group-by
+const (
+	GroupByAction   = "action"
+	GroupByResource = "resource"
+	GroupByDecision = "decision"
+	GroupByTag      = "tag"
+)
+
+// GroupByValues lists the --group-by options in the order shown in help and errors
+var GroupByValues = []string{GroupByAction, GroupByResource, GroupByDecision, GroupByTag}
+
+// groupKeys returns the groups a result belongs to; with --group-by tag a test appears under each of its tags
+func groupKeys(r testResult, groupBy string) []string {
+	switch groupBy {
+	case GroupByAction:
+		return []string{r.Action}
+	case GroupByResource:
+		if len(r.Resources) == 0 {
+			return []string{"*"}
+		}
+		return []string{strings.Join(r.Resources, ", ")}
+	case GroupByDecision:
+		if r.Decision == "" {
+			return []string{"(no result)"}
+		}
+		return []string{r.Decision}
+	case GroupByTag:
+		if len(r.Tags) == 0 {
+			return []string{"(untagged)"}
+		}
+		return r.Tags
+	}
+	return nil
+}
+
+// printGroupedResults replays each test's buffered output under a header per group, sorted by group name
+// Each header carries the group's mini-summary; tests keep their execution order within a group
+func printGroupedResults(results []testResult, groupBy string) {
+	groups := map[string][]testResult{}
+	for _, r := range results {
+		for _, key := range groupKeys(r, groupBy) {
+			groups[key] = append(groups[key], r)
+		}
+	}
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		passed := 0
+		for _, r := range groups[key] {
+			if r.Passed {
+				passed++
+			}
+		}
+		members := groups[key]
+		fmt.Fprintf(Stdout, "=== %s: %s (%d test(s): %d passed, %d failed) ===\n\n", groupBy, key, len(members), passed, len(members)-passed)
+		for _, r := range members {
+			fmt.Fprint(Stdout, r.Output)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestRunTestsGroupBy(t *testing.T) {
+	oldStdout := Stdout
+	defer func() { Stdout = oldStdout }()
+
+	client := &mockIAMClient{
+		SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+			decision := types.PolicyEvaluationDecisionTypeAllowed
+			if strings.HasPrefix(params.ActionNames[0], "iam:") {
+				decision = types.PolicyEvaluationDecisionTypeImplicitDeny
+			}
+			return &iam.SimulateCustomPolicyOutput{
+				EvaluationResults: []types.EvaluationResult{{EvalActionName: &params.ActionNames[0], EvalDecision: decision}},
+			}, nil
+		},
+	}
+	scen := &Scenario{Tests: []TestCase{
+		{Name: "read", Action: "s3:GetObject", Expect: "allowed", Tags: []string{"data"}},
+		{Name: "pass role", Action: "iam:PassRole", Expect: "allowed", Tags: []string{"iam", "data"}},
+		{Name: "create user", Action: "iam:CreateUser", Expect: "implicitDeny"},
+	}}
+
+	var out strings.Builder
+	Stdout = &out
+	_ = RunTests(client, scen, SimulatorConfig{Variables: map[string]any{}, GroupBy: GroupByDecision})
+	got := out.String()
+	allowed := strings.Index(got, "=== decision: allowed (1 test(s): 1 passed, 0 failed) ===")
+	denied := strings.Index(got, "=== decision: implicitDeny (2 test(s): 1 passed, 1 failed) ===")
+	if allowed < 0 || denied < allowed {
+		t.Fatalf("Expected allowed then implicitDeny groups:\n%s", got)
+	}
+	if read := strings.Index(got, "[1/3] read"); read < allowed || read > denied {
+		t.Errorf("Expected the read test under the allowed group:\n%s", got)
+	}
+	if strings.Index(got, "[2/3] pass role") > strings.Index(got, "[3/3] create user") {
+		t.Errorf("Expected execution order within a group:\n%s", got)
+	}
+
+	out.Reset()
+	_ = RunTests(client, scen, SimulatorConfig{Variables: map[string]any{}, GroupBy: GroupByTag})
+	for _, want := range []string{
+		"=== tag: (untagged) (1 test(s): 1 passed, 0 failed) ===",
+		"=== tag: data (2 test(s): 1 passed, 1 failed) ===",
+		"=== tag: iam (1 test(s): 0 passed, 1 failed) ===",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in output:\n%s", want, out.String())
+		}
+	}
+}
@@ -3,14 +3,30 @@ package internal
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 )
 
 // GlobalExiter is the global exiter instance used by helper functions
 var GlobalExiter Exiter = DefaultExiter
 
+// Exit codes for errors (invalid scenario, AWS error, etc.) and expectation failures
+// They default to 1 and 2 and can be remapped via --exit-code-on-error / --exit-code-on-failure
+var (
+	ExitCodeError   = 1
+	ExitCodeFailure = 2
+)
+
+// Stdout and Stderr are the writers used for all user-facing output
+// They can be swapped (e.g. for a RedactingWriter) to filter every print path
+var (
+	Stdout io.Writer = os.Stdout
+	Stderr io.Writer = os.Stderr
+)
+
 // AwsString safely dereferences an AWS string pointer
 func AwsString(p *string) string {
 	if p == nil {
@@ -52,23 +68,43 @@ func MustAbsJoin(base, rel string) string {
 func Check(err error) {
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			Die("file not found: %v", err)
+			err = fmt.Errorf("file not found: %w", err)
 		}
-		Die("%v", err)
+		PrintError(Stderr, err)
+		GlobalExiter.Exit(ExitCodeError)
 	}
 }
 
-// Die prints an error message and exits with code 1
+// Die prints an error message and exits with ExitCodeError
 func Die(f string, a ...any) {
-	fmt.Fprintf(os.Stderr, f+"\n", a...)
-	GlobalExiter.Exit(1)
+	PrintError(Stderr, fmt.Errorf(f, a...))
+	GlobalExiter.Exit(ExitCodeError)
+}
+
+// warningCount counts warnings emitted through Warn so --fail-on-warnings can gate the exit code
+var warningCount atomic.Int64
+
+// Warn prints a warning to Stderr and records it in the warning count
+func Warn(f string, a ...any) {
+	warningCount.Add(1)
+	fmt.Fprintf(Stderr, f, a...)
+}
+
+// WarningCount returns the number of warnings emitted since the last ResetWarnings
+func WarningCount() int {
+	return int(warningCount.Load())
+}
+
+// ResetWarnings clears the warning count at the start of a run
+func ResetWarnings() {
+	warningCount.Store(0)
 }
 
 // WarnSCPSimulation prints a warning that SCP/RCP simulation is an approximation
 func WarnSCPSimulation() {
-	fmt.Fprintf(os.Stderr, "\n⚠️  WARNING: SCP/RCP Simulation Approximation\n")
-	fmt.Fprintf(os.Stderr, "   The AWS SimulateCustomPolicy API was not designed for testing SCPs/RCPs.\n")
-	fmt.Fprintf(os.Stderr, "   politest uses PermissionsBoundaryPolicyInputList as a workaround, which\n")
-	fmt.Fprintf(os.Stderr, "   APPROXIMATES real-world behavior but may not be 100%% accurate.\n")
-	fmt.Fprintf(os.Stderr, "   Always validate with integration tests in actual AWS accounts.\n\n")
+	Warn("\n⚠️  WARNING: SCP/RCP Simulation Approximation\n")
+	fmt.Fprintf(Stderr, "   The AWS SimulateCustomPolicy API was not designed for testing SCPs/RCPs.\n")
+	fmt.Fprintf(Stderr, "   politest uses PermissionsBoundaryPolicyInputList as a workaround, which\n")
+	fmt.Fprintf(Stderr, "   APPROXIMATES real-world behavior but may not be 100%% accurate.\n")
+	fmt.Fprintf(Stderr, "   Always validate with integration tests in actual AWS accounts.\n\n")
 }
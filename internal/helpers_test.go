@@ -3,6 +3,7 @@ package internal
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -173,7 +174,53 @@ func TestWarnSCPSimulation(t *testing.T) {
 	// If we get here without panic, test passes
 }
 
+func TestWarnCountsWarnings(t *testing.T) {
+	originalStderr := Stderr
+	defer func() {
+		Stderr = originalStderr
+		ResetWarnings()
+	}()
+	var stderr strings.Builder
+	Stderr = &stderr
+
+	ResetWarnings()
+	WarnSCPSimulation()
+	warnWildcardAction("s3:Get*")
+	warnWildcardAction("s3:GetObject") // not a warning
+
+	if WarningCount() != 2 {
+		t.Errorf("WarningCount() = %d, want 2", WarningCount())
+	}
+	if !strings.Contains(stderr.String(), "SCP/RCP Simulation Approximation") {
+		t.Errorf("Expected warning text on stderr, got: %q", stderr.String())
+	}
+
+	ResetWarnings()
+	if WarningCount() != 0 {
+		t.Errorf("WarningCount() after reset = %d, want 0", WarningCount())
+	}
+}
+
 // Helper function for tests
 func contains(s, substr string) bool {
 	return len(s) > 0 && len(substr) > 0 && (s == substr || len(s) > len(substr) && (s[0:len(substr)] == substr || contains(s[1:], substr)))
 }
+
+func TestDieUsesConfiguredExitCode(t *testing.T) {
+	originalExiter := GlobalExiter
+	originalCode := ExitCodeError
+	defer func() {
+		GlobalExiter = originalExiter
+		ExitCodeError = originalCode
+	}()
+
+	mockExit := &mockExiter{}
+	GlobalExiter = mockExit
+	ExitCodeError = 42
+
+	Die("boom")
+
+	if mockExit.exitCode != 42 {
+		t.Errorf("Expected Die() to exit with configured code 42, got %d", mockExit.exitCode)
+	}
+}
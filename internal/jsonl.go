@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Output formats accepted by --format
+const (
+	FormatText    = "text"
+	FormatJSONL   = "jsonl"
+	FormatConsole = "console-style"
+)
+
+// jsonlRecord is the JSON object emitted per test by --format jsonl
+type jsonlRecord struct {
+	Index             int               `json:"index"`
+	Name              string            `json:"name"`
+	Action            string            `json:"action"`
+	Resources         []string          `json:"resources"`
+	Expect            string            `json:"expect,omitempty"`
+	ExpectReason      string            `json:"expect_reason,omitempty"` // only set for failed tests
+	Decision          string            `json:"decision"`
+	Passed            bool              `json:"passed"`
+	Severity          string            `json:"severity,omitempty"`
+	MatchedStatements []string          `json:"matched_statements"`
+	Metadata          map[string]string `json:"metadata,omitempty"` // scenario metadata, repeated so each line stands alone
+}
+
+// jsonlWriter streams one JSON object per line as each test completes
+// Writes are serialized so lines never interleave when tests run concurrently
+type jsonlWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	metadata map[string]string
+}
+
+// write encodes a test result as a single line and writes it immediately (no buffering)
+func (j *jsonlWriter) write(r testResult) error {
+	rec := jsonlRecord{
+		Index:             r.Index,
+		Name:              r.Name,
+		Action:            r.Action,
+		Resources:         r.Resources,
+		Expect:            r.Expect,
+		Decision:          r.Decision,
+		Passed:            r.Passed,
+		Severity:          r.Severity,
+		MatchedStatements: []string{},
+		Metadata:          j.metadata,
+	}
+	if !r.Passed {
+		rec.ExpectReason = r.Reason
+	}
+	if rec.Resources == nil {
+		rec.Resources = []string{}
+	}
+	if r.Response != nil && len(r.Response.EvaluationResults) > 0 {
+		for _, m := range r.Response.EvaluationResults[0].MatchedStatements {
+			if m.SourcePolicyId != nil {
+				rec.MatchedStatements = append(rec.MatchedStatements, AwsString(m.SourcePolicyId))
+			}
+		}
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.w.Write(append(b, '\n'))
+	return err
+}
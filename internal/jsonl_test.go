@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestRunTestCollectionJSONL(t *testing.T) {
+	originalExiter := GlobalExiter
+	originalStdout, originalStderr := Stdout, Stderr
+	defer func() {
+		GlobalExiter = originalExiter
+		Stdout, Stderr = originalStdout, originalStderr
+	}()
+	GlobalExiter = &mockExiter{}
+
+	var stdout, stderr strings.Builder
+	Stdout, Stderr = &stdout, &stderr
+
+	mockClient := &mockIAMClient{
+		SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+			action := params.ActionNames[0]
+			decision := types.PolicyEvaluationDecisionTypeAllowed
+			if action == "s3:DeleteObject" {
+				decision = types.PolicyEvaluationDecisionTypeImplicitDeny
+			}
+			return &iam.SimulateCustomPolicyOutput{
+				EvaluationResults: []types.EvaluationResult{{
+					EvalActionName:    &action,
+					EvalDecision:      decision,
+					MatchedStatements: []types.Statement{{SourcePolicyId: StrPtr("PolicyInputList.1")}},
+				}},
+			}, nil
+		},
+	}
+
+	scen := &Scenario{Metadata: ScenarioMetadata{"owner": "platform"}, Tests: []TestCase{
+		{Name: "read", Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/*", Expect: "allowed"},
+		{Action: "s3:DeleteObject", Expect: "allowed", ExpectReason: "cleanup jobs delete objects"},
+	}}
+	RunTestCollection(mockClient, scen, SimulatorConfig{Format: FormatJSONL, Variables: map[string]any{}})
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 JSON lines on stdout, got %d:\n%s", len(lines), stdout.String())
+	}
+
+	var first jsonlRecord
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("line 1 is not valid JSON: %v", err)
+	}
+	if first.Index != 0 || first.Name != "read" || first.Decision != "allowed" || !first.Passed || first.ExpectReason != "" {
+		t.Errorf("unexpected first record: %+v", first)
+	}
+	if first.Metadata["owner"] != "platform" {
+		t.Errorf("expected scenario metadata on each record, got %v", first.Metadata)
+	}
+	if len(first.MatchedStatements) != 1 || first.MatchedStatements[0] != "PolicyInputList.1" {
+		t.Errorf("matched statements = %v, want [PolicyInputList.1]", first.MatchedStatements)
+	}
+
+	var second jsonlRecord
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("line 2 is not valid JSON: %v", err)
+	}
+	if second.Index != 1 || len(second.Resources) != 0 || second.Passed || second.ExpectReason != "cleanup jobs delete objects" {
+		t.Errorf("unexpected second record: %+v", second)
+	}
+
+	// Human-readable output is kept off stdout
+	if !strings.Contains(stderr.String(), "Test Results: 1 passed, 1 failed") {
+		t.Errorf("expected summary on stderr, got: %s", stderr.String())
+	}
+	if Stdout != &stdout {
+		t.Error("Stdout was not restored after the run")
+	}
+}
+
+func TestJSONLWriterConcurrentWrites(t *testing.T) {
+	var out strings.Builder
+	w := &jsonlWriter{w: &out}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := w.write(testResult{Index: i, Action: "s3:GetObject"}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 50 {
+		t.Fatalf("expected 50 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		var rec jsonlRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Errorf("interleaved or invalid line %q: %v", line, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// Boundary layer names, used to label which layer decided a test when SCPs and a permissions boundary are both set
+const (
+	LayerSCP                 = "SCP"
+	LayerPermissionsBoundary = "permissions boundary"
+)
+
+// boundaryPass is one policy sent as PermissionsBoundaryPolicyInputList in its own simulation
+type boundaryPass struct {
+	layer  string
+	policy string
+}
+
+// boundaryPasses returns the boundary policies to simulate, SCPs first
+// SimulateCustomPolicy takes a single boundary, so SCPs and a permissions boundary can't share one request
+func boundaryPasses(cfg SimulatorConfig) []boundaryPass {
+	var passes []boundaryPass
+	if cfg.PermissionsBoundary != "" {
+		passes = append(passes, boundaryPass{layer: LayerSCP, policy: cfg.PermissionsBoundary})
+	}
+	if cfg.IdentityBoundary != "" {
+		passes = append(passes, boundaryPass{layer: LayerPermissionsBoundary, policy: cfg.IdentityBoundary})
+	}
+	return passes
+}
+
+// layered reports whether SCPs and a permissions boundary are simulated as separate passes
+func layered(cfg SimulatorConfig) bool {
+	return len(boundaryPasses(cfg)) > 1
+}
+
+// decisionRank orders decisions from least to most restrictive
+func decisionRank(decision types.PolicyEvaluationDecisionType) int {
+	switch decision {
+	case types.PolicyEvaluationDecisionTypeAllowed:
+		return 0
+	case types.PolicyEvaluationDecisionTypeExplicitDeny:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// simulateLayers runs input once per boundary pass and keeps the most restrictive response, so the
+// effective decision is identity ∩ SCP ∩ permissions boundary. It returns the input of the pass that was
+// kept, so --save-full pairs it with its response, and the layer of that pass (SCP on a tie), or "" when
+// there is at most one boundary and a single request was enough
+func simulateLayers(client IAMSimulator, input *iam.SimulateCustomPolicyInput, expect string, cfg SimulatorConfig) (*iam.SimulateCustomPolicyOutput, *iam.SimulateCustomPolicyInput, string, error) {
+	passes := boundaryPasses(cfg)
+	if len(passes) < 2 {
+		resp, err := simulateWithRetry(client, input, expect, cfg)
+		return resp, input, "", err
+	}
+
+	var kept *iam.SimulateCustomPolicyOutput
+	var keptInput *iam.SimulateCustomPolicyInput
+	var keptLayer string
+	for _, pass := range passes {
+		passInput := *input
+		passInput.PermissionsBoundaryPolicyInputList = []string{pass.policy}
+		resp, err := simulateWithRetry(client, &passInput, expect, cfg)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("%s pass: %w", pass.layer, err)
+		}
+		if kept == nil || moreRestrictive(resp, kept) {
+			kept, keptInput, keptLayer = resp, &passInput, pass.layer
+		}
+	}
+	return kept, keptInput, keptLayer, nil
+}
+
+// moreRestrictive reports whether a's first result is a stricter decision than b's
+func moreRestrictive(a, b *iam.SimulateCustomPolicyOutput) bool {
+	if len(a.EvaluationResults) == 0 || len(b.EvaluationResults) == 0 {
+		return false
+	}
+	return decisionRank(a.EvaluationResults[0].EvalDecision) > decisionRank(b.EvaluationResults[0].EvalDecision)
+}
+
+// withBoundaryLayer points the boundary source map at the layer whose response is being reported, so
+// PermissionsBoundaryPolicyInputList statements resolve to the permissions boundary file rather than the SCPs
+func withBoundaryLayer(cfg SimulatorConfig, layer string) SimulatorConfig {
+	if cfg.SourceMap == nil {
+		return cfg
+	}
+	sourceMap := *cfg.SourceMap
+	sourceMap.BoundaryLayer = layer
+	if layer == "" && cfg.IdentityBoundary != "" && cfg.PermissionsBoundary == "" {
+		sourceMap.BoundaryLayer = LayerPermissionsBoundary
+	}
+	if sourceMap.BoundaryLayer == LayerPermissionsBoundary {
+		sourceMap.PermissionsBoundary = sourceMap.IdentityBoundary
+		sourceMap.PermissionsBoundaryRaw = sourceMap.IdentityBoundaryRaw
+	}
+	cfg.SourceMap = &sourceMap
+	return cfg
+}
+
+// printDecidingLayer notes which layer denied a test when SCPs and a permissions boundary ran as separate passes
+func printDecidingLayer(resp *iam.SimulateCustomPolicyOutput, layer string) {
+	if layer == "" || len(resp.EvaluationResults) == 0 {
+		return
+	}
+	if decision := resp.EvaluationResults[0].EvalDecision; decision != types.PolicyEvaluationDecisionTypeAllowed {
+		fmt.Fprintf(Stdout, "  ↳ %s by the %s layer\n", decision, layer)
+	}
+}
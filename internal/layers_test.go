@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestRunTestsSCPAndPermissionsBoundaryLayers(t *testing.T) {
+	oldStdout := Stdout
+	defer func() { Stdout = oldStdout }()
+
+	// The SCP allows everything; the boundary denies s3:DeleteObject
+	var boundaries []string
+	client := &mockIAMClient{
+		SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+			boundary := params.PermissionsBoundaryPolicyInputList[0]
+			boundaries = append(boundaries, boundary)
+			decision := types.PolicyEvaluationDecisionTypeAllowed
+			if boundary == "boundary" && params.ActionNames[0] == "s3:DeleteObject" {
+				decision = types.PolicyEvaluationDecisionTypeExplicitDeny
+			}
+			return &iam.SimulateCustomPolicyOutput{EvaluationResults: []types.EvaluationResult{{
+				EvalActionName: aws.String(params.ActionNames[0]),
+				EvalDecision:   decision,
+			}}}, nil
+		},
+	}
+	scen := &Scenario{Tests: []TestCase{
+		{Name: "read", Action: "s3:GetObject", Expect: "allowed"},
+		{Name: "delete", Action: "s3:DeleteObject", Expect: "allowed"},
+	}}
+	cfg := SimulatorConfig{
+		PolicyJSON:          `{"Version":"2012-10-17","Statement":[]}`,
+		PermissionsBoundary: "scp",
+		IdentityBoundary:    "boundary",
+		Variables:           map[string]any{},
+	}
+
+	var out strings.Builder
+	Stdout = &out
+	err := RunTests(client, scen, cfg)
+
+	var failure *TestFailureError
+	if !errors.As(err, &failure) || failure.Failed != 1 {
+		t.Fatalf("Expected the delete test to fail, got %v", err)
+	}
+	if got := strings.Join(boundaries, ","); got != "scp,boundary,scp,boundary" {
+		t.Errorf("Expected one SCP and one boundary pass per test, got %s", got)
+	}
+	if !strings.Contains(out.String(), "↳ explicitDeny by the permissions boundary layer") {
+		t.Errorf("Expected the deciding layer to be labelled, got:\n%s", out.String())
+	}
+}
+
+func TestRunTestsSaveFullRecordsKeptPass(t *testing.T) {
+	oldStdout := Stdout
+	defer func() { Stdout = oldStdout }()
+	Stdout = &strings.Builder{}
+
+	// The boundary pass denies, so its input is the one paired with the kept response
+	client := &mockIAMClient{
+		SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+			decision := types.PolicyEvaluationDecisionTypeAllowed
+			if params.PermissionsBoundaryPolicyInputList[0] == "boundary" {
+				decision = types.PolicyEvaluationDecisionTypeImplicitDeny
+			}
+			return &iam.SimulateCustomPolicyOutput{EvaluationResults: []types.EvaluationResult{{
+				EvalActionName: aws.String(params.ActionNames[0]),
+				EvalDecision:   decision,
+			}}}, nil
+		},
+	}
+	saveFile := filepath.Join(t.TempDir(), "full.json")
+	scen := &Scenario{Tests: []TestCase{{Name: "read", Action: "s3:GetObject", Expect: "implicitDeny"}}}
+	cfg := SimulatorConfig{
+		PolicyJSON:          `{"Version":"2012-10-17","Statement":[]}`,
+		PermissionsBoundary: "scp",
+		IdentityBoundary:    "boundary",
+		Variables:           map[string]any{},
+		SaveFullPath:        saveFile,
+	}
+
+	if err := RunTests(client, scen, cfg); err != nil {
+		t.Fatalf("RunTests() error = %v", err)
+	}
+
+	b, err := os.ReadFile(saveFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []struct {
+		Input struct {
+			PermissionsBoundaryPolicyInputList []string
+		} `json:"input"`
+	}
+	if err := json.Unmarshal(b, &records); err != nil {
+		t.Fatalf("save-full file is not valid JSON: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+	if got := records[0].Input.PermissionsBoundaryPolicyInputList; len(got) != 1 || got[0] != "boundary" {
+		t.Errorf("Expected the boundary pass input to be saved, got %v", got)
+	}
+}
+
+func TestWithBoundaryLayer(t *testing.T) {
+	scpSources := map[string]*PolicySource{"scp#stmt:0": {FilePath: "scp.json"}}
+	boundarySources := map[string]*PolicySource{"boundary#stmt:0": {FilePath: "boundary.json"}}
+	cfg := SimulatorConfig{
+		PermissionsBoundary: "scp",
+		IdentityBoundary:    "boundary",
+		SourceMap: &PolicySourceMap{
+			PermissionsBoundary:    scpSources,
+			PermissionsBoundaryRaw: "scp-raw",
+			IdentityBoundary:       boundarySources,
+			IdentityBoundaryRaw:    "boundary-raw",
+		},
+	}
+
+	got := withBoundaryLayer(cfg, LayerPermissionsBoundary)
+	if got.SourceMap.PermissionsBoundaryRaw != "boundary-raw" || got.SourceMap.BoundaryLayer != LayerPermissionsBoundary {
+		t.Errorf("Expected boundary sources for the boundary layer, got %+v", got.SourceMap)
+	}
+	if cfg.SourceMap.PermissionsBoundaryRaw != "scp-raw" {
+		t.Error("withBoundaryLayer must not modify the shared source map")
+	}
+
+	got = withBoundaryLayer(cfg, LayerSCP)
+	if got.SourceMap.PermissionsBoundaryRaw != "scp-raw" || got.SourceMap.BoundaryLayer != LayerSCP {
+		t.Errorf("Expected SCP sources for the SCP layer, got %+v", got.SourceMap)
+	}
+
+	// A boundary without SCPs is sent in a single request but still resolves to the boundary file
+	cfg.PermissionsBoundary = ""
+	got = withBoundaryLayer(cfg, "")
+	if got.SourceMap.PermissionsBoundaryRaw != "boundary-raw" {
+		t.Errorf("Expected boundary sources without SCPs, got %+v", got.SourceMap)
+	}
+}
@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	analyzertypes "github.com/aws/aws-sdk-go-v2/service/accessanalyzer/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// LintRuleAllowDenyConflict flags an Allow and an unconditional Deny in one policy that cover the same
+// action and resource: the Deny always wins, so the Allow is dead or the Deny is broader than intended
+const LintRuleAllowDenyConflict = "allow-deny-conflict"
+
+// LintRuleUnmatchedResource flags a test resource that no statement's Resource pattern covers in the identity
+// or resource policies, so the test can only ever be an implicit deny
+const LintRuleUnmatchedResource = "unmatched-resource"
+
+// LintRules lists every rule --lint runs, by name for --lint-disable
+var LintRules = []string{LintRuleAllowDenyConflict, LintRuleUnmatchedResource}
+
+// policyVariable matches IAM policy variables such as ${aws:username}, which lint treats as wildcards
+var policyVariable = regexp.MustCompile(`\$\{[^}]*\}`)
+
+// LintFinding is one problem found by a lint rule
+type LintFinding struct {
+	Rule    string
+	Message string
+}
+
+// lintStatement is a parsed statement with its position for messages
+type lintStatement struct {
+	index     int
+	sid       string
+	startLine int
+	endLine   int
+	fields    map[string]any
+}
+
+// describe names a statement by Sid (or index) and source lines
+func (s lintStatement) describe() string {
+	name := fmt.Sprintf("statement %d", s.index)
+	if s.sid != "" {
+		name = fmt.Sprintf("statement %q", s.sid)
+	}
+	if s.startLine > 0 && s.endLine > 0 {
+		name += fmt.Sprintf(" (lines %d-%d)", s.startLine, s.endLine)
+	}
+	return name
+}
+
+// LintPolicy runs the lint rules not in disabled over one policy document
+// filePath is the policy's source file, used to report statement line numbers
+func LintPolicy(policyJSON, filePath string, disabled map[string]bool) ([]LintFinding, error) {
+	var policy map[string]any
+	if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy JSON in %s: %v", filePath, err)
+	}
+	var raw []any
+	switch st := policy["Statement"].(type) {
+	case []any:
+		raw = st
+	case map[string]any:
+		raw = []any{st}
+	}
+
+	content, _ := os.ReadFile(filePath)
+	locator := newStatementLocator(string(content))
+	var statements []lintStatement
+	for i, r := range raw {
+		fields, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		start, end := locator.locate(fields)
+		sid, _ := fields["Sid"].(string)
+		statements = append(statements, lintStatement{index: i, sid: sid, startLine: start, endLine: end, fields: fields})
+	}
+
+	var findings []LintFinding
+	if !disabled[LintRuleAllowDenyConflict] {
+		findings = append(findings, allowDenyConflicts(filePath, statements)...)
+	}
+	return findings, nil
+}
+
+// allowDenyConflicts pairs each Allow with each unconditional Deny and reports the first action and
+// resource they both cover. Statements using NotAction/NotResource are skipped, and patterns only
+// overlap when one covers the other (s3:* covers s3:GetObject; s3:Get* and s3:*Object are not compared)
+func allowDenyConflicts(filePath string, statements []lintStatement) []LintFinding {
+	var findings []LintFinding
+	for _, allow := range statements {
+		if allow.fields["Effect"] != "Allow" {
+			continue
+		}
+		for _, deny := range statements {
+			if deny.fields["Effect"] != "Deny" || deny.fields["Condition"] != nil {
+				continue
+			}
+			action, ok := firstOverlap(stringOrList(allow.fields["Action"]), stringOrList(deny.fields["Action"]), true)
+			if !ok {
+				continue
+			}
+			resource, ok := firstOverlap(stringOrList(allow.fields["Resource"]), stringOrList(deny.fields["Resource"]), false)
+			if !ok {
+				continue
+			}
+			findings = append(findings, LintFinding{
+				Rule: LintRuleAllowDenyConflict,
+				Message: fmt.Sprintf("%s: Allow %s and Deny %s both cover %s on %s; the Deny always wins",
+					filePath, allow.describe(), deny.describe(), action, resource),
+			})
+		}
+	}
+	return findings
+}
+
+// firstOverlap returns the more specific of the first pair of patterns where one covers the other
+func firstOverlap(as, bs []string, ignoreCase bool) (string, bool) {
+	for _, a := range as {
+		for _, b := range bs {
+			switch {
+			case wildcardMatch(b, a, ignoreCase):
+				return a, true
+			case wildcardMatch(a, b, ignoreCase):
+				return b, true
+			}
+		}
+	}
+	return "", false
+}
+
+// wildcardMatch reports whether s matches an IAM pattern where * matches any run of characters and ? one character
+func wildcardMatch(pattern, s string, ignoreCase bool) bool {
+	expr := strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(pattern))
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.MustCompile("^" + expr + "$").MatchString(s)
+}
+
+// LintTestResources checks each test's rendered resources against the Resource patterns of the identity and
+// resource policies and reports resources no statement could match. Tests expecting implicitDeny, tests
+// with their own resource policy, wildcard resources and boundary_only scenarios are skipped. Conditions
+// are ignored, so a resource covered only by a condition-gated statement still counts as matched
+func LintTestResources(scen *Scenario, vars map[string]any, policies []AnalyzerPolicy, disabled map[string]bool) ([]LintFinding, error) {
+	if disabled[LintRuleUnmatchedResource] || scen.BoundaryOnly {
+		return nil, nil
+	}
+
+	var patterns []string
+	for _, p := range policies {
+		if p.Type != analyzertypes.PolicyTypeIdentityPolicy && p.Type != analyzertypes.PolicyTypeResourcePolicy {
+			continue
+		}
+		var policy map[string]any
+		if err := json.Unmarshal([]byte(p.Document), &policy); err != nil {
+			return nil, fmt.Errorf("invalid policy JSON in %s: %v", p.Source, err)
+		}
+		statements, ok := policy["Statement"].([]any)
+		if !ok {
+			statements = []any{policy["Statement"]}
+		}
+		for _, st := range statements {
+			fields, _ := st.(map[string]any)
+			if fields["NotResource"] != nil {
+				patterns = append(patterns, "*") // could match almost anything
+			}
+			for _, r := range stringOrList(fields["Resource"]) {
+				patterns = append(patterns, policyVariable.ReplaceAllString(r, "*"))
+			}
+		}
+	}
+
+	tests, err := resolveResourceSets(scen, append(append([]TestCase{}, scen.Tests...), legacyTests(scen)...))
+	if err != nil {
+		return nil, err
+	}
+	var findings []LintFinding
+	for _, test := range tests {
+		if strings.EqualFold(test.Expect, string(types.PolicyEvaluationDecisionTypeImplicitDeny)) ||
+			test.ResourcePolicyJSON != "" || test.ResourcePolicyTemplate != "" {
+			continue
+		}
+		resources, err := prepareTestResources(test, vars)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range resources {
+			if resource == "*" {
+				continue
+			}
+			if _, ok := firstOverlap(patterns, []string{resource}, false); ok {
+				continue
+			}
+			name := IfEmpty(test.Name, IfEmpty(test.Action, strings.Join(test.Actions, ", ")))
+			findings = append(findings, LintFinding{
+				Rule:    LintRuleUnmatchedResource,
+				Message: fmt.Sprintf("test %q: resource %s matches no Resource in the identity or resource policies; it can only be implicitly denied", name, resource),
+			})
+		}
+	}
+	return findings, nil
+}
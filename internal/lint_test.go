@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	analyzertypes "github.com/aws/aws-sdk-go-v2/service/accessanalyzer/types"
+)
+
+func TestLintPolicyAllowDenyConflict(t *testing.T) {
+	policy := `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "AllowS3",
+      "Effect": "Allow",
+      "Action": "s3:*",
+      "Resource": "arn:aws:s3:::bucket/*"
+    },
+    {
+      "Effect": "Deny",
+      "Action": ["s3:DeleteObject"],
+      "Resource": "*"
+    },
+    {
+      "Sid": "DenyOutsideVPC",
+      "Effect": "Deny",
+      "Action": "s3:*",
+      "Resource": "*",
+      "Condition": {"StringNotEquals": {"aws:SourceVpc": "vpc-1"}}
+    },
+    {
+      "Sid": "DenyIAM",
+      "Effect": "Deny",
+      "Action": "iam:*",
+      "Resource": "*"
+    }
+  ]
+}`
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	findings, err := LintPolicy(policy, path, nil)
+	if err != nil {
+		t.Fatalf("LintPolicy() error = %v", err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("Expected 1 finding (conditional and non-overlapping Denies are ignored), got %+v", findings)
+	}
+	want := `Allow statement "AllowS3" (lines 4-9) and Deny statement 1 (lines 10-14) both cover s3:DeleteObject on arn:aws:s3:::bucket/*`
+	if findings[0].Rule != LintRuleAllowDenyConflict || !strings.Contains(findings[0].Message, want) {
+		t.Errorf("Unexpected finding: %+v", findings[0])
+	}
+
+	findings, err = LintPolicy(policy, path, map[string]bool{LintRuleAllowDenyConflict: true})
+	if err != nil || len(findings) != 0 {
+		t.Errorf("Expected no findings with the rule disabled, got %+v (err %v)", findings, err)
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		ignoreCase bool
+		want       bool
+	}{
+		{"s3:*", "s3:GetObject", true, true},
+		{"S3:get*", "s3:GetObject", true, true},
+		{"s3:Get?bject", "s3:GetObject", true, true},
+		{"arn:aws:s3:::a/*", "arn:aws:s3:::A/x", false, false},
+		{"s3:Get*", "s3:PutObject", true, false},
+		{"s3:Get.Object", "s3:GetXObject", true, false},
+	} {
+		if got := wildcardMatch(tc.pattern, tc.s, tc.ignoreCase); got != tc.want {
+			t.Errorf("wildcardMatch(%q, %q) = %v, want %v", tc.pattern, tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestLintTestResources(t *testing.T) {
+	identity := `{"Statement": [
+  {"Effect": "Allow", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::app-bucket/*"},
+  {"Effect": "Allow", "Action": "s3:ListBucket", "Resource": "arn:aws:s3:::home-${aws:username}"}
+]}`
+	resource := `{"Statement": {"Effect": "Allow", "Principal": "*", "Action": "sqs:SendMessage", "Resource": "arn:aws:sqs:us-east-1:123456789012:jobs"}}`
+	policies := []AnalyzerPolicy{
+		{Source: "identity.json", Document: identity, Type: analyzertypes.PolicyTypeIdentityPolicy},
+		{Source: "queue.json", Document: resource, Type: analyzertypes.PolicyTypeResourcePolicy},
+		{Source: "scp", Document: `{"Statement": {"Effect": "Deny", "Action": "*", "Resource": "arn:aws:s3:::typo-bucket/*"}}`, Type: analyzertypes.PolicyTypeServiceControlPolicy},
+	}
+	scen := &Scenario{
+		ResourceSets: map[string][]string{"queues": {"arn:aws:sqs:us-east-1:123456789012:jobs", "arn:aws:sqs:us-east-1:123456789012:other"}},
+		Tests: []TestCase{
+			{Name: "read", Action: "s3:GetObject", Resource: "arn:aws:s3:::{{.bucket}}/key"},
+			{Name: "typo", Action: "s3:GetObject", Resource: "arn:aws:s3:::typo-bucket/key", Expect: "allowed"},
+			{Name: "expected deny", Action: "s3:GetObject", Resource: "arn:aws:s3:::typo-bucket/key", Expect: "implicitDeny"},
+			{Name: "home", Action: "s3:ListBucket", Resource: "arn:aws:s3:::home-alice"},
+			{Name: "queues", Action: "sqs:SendMessage", ResourceSet: "queues"},
+			{Name: "anything", Action: "s3:ListAllMyBuckets"},
+		},
+	}
+	vars := map[string]any{"bucket": "app-bucket"}
+
+	findings, err := LintTestResources(scen, vars, policies, nil)
+	if err != nil {
+		t.Fatalf("LintTestResources() error = %v", err)
+	}
+	var got []string
+	for _, f := range findings {
+		if f.Rule != LintRuleUnmatchedResource {
+			t.Errorf("Unexpected rule %s", f.Rule)
+		}
+		got = append(got, f.Message)
+	}
+	want := []string{
+		`test "typo": resource arn:aws:s3:::typo-bucket/key matches no Resource in the identity or resource policies; it can only be implicitly denied`,
+		`test "queues": resource arn:aws:sqs:us-east-1:123456789012:other matches no Resource in the identity or resource policies; it can only be implicitly denied`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if findings, _ := LintTestResources(scen, vars, policies, map[string]bool{LintRuleUnmatchedResource: true}); len(findings) != 0 {
+		t.Errorf("Expected no findings with the rule disabled, got %v", findings)
+	}
+}
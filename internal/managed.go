@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// IsManagedPolicyARN reports whether a policy reference is an IAM managed policy ARN rather than a file path
+func IsManagedPolicyARN(ref string) bool {
+	return strings.HasPrefix(ref, "arn:") && strings.Contains(ref, ":policy/")
+}
+
+// ManagedPolicyFetcher resolves managed policy ARNs to their default version document
+// Fetched documents are cached so each ARN is only requested once per run
+type ManagedPolicyFetcher struct {
+	Client ManagedPolicyGetter
+	cache  map[string]string
+}
+
+// NewManagedPolicyFetcher creates a fetcher with an empty cache
+func NewManagedPolicyFetcher(client ManagedPolicyGetter) *ManagedPolicyFetcher {
+	return &ManagedPolicyFetcher{Client: client, cache: make(map[string]string)}
+}
+
+// Fetch returns the pretty-printed default version document for a managed policy ARN
+func (f *ManagedPolicyFetcher) Fetch(ctx context.Context, policyArn string) (string, error) {
+	if doc, ok := f.cache[policyArn]; ok {
+		return doc, nil
+	}
+
+	policy, err := f.Client.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: &policyArn})
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve managed policy %s (requires iam:GetPolicy): %v", policyArn, err)
+	}
+	if policy.Policy == nil || policy.Policy.DefaultVersionId == nil {
+		return "", fmt.Errorf("managed policy %s has no default version", policyArn)
+	}
+
+	version, err := f.Client.GetPolicyVersion(ctx, &iam.GetPolicyVersionInput{
+		PolicyArn: &policyArn,
+		VersionId: policy.Policy.DefaultVersionId,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch managed policy %s version %s (requires iam:GetPolicyVersion): %v", policyArn, *policy.Policy.DefaultVersionId, err)
+	}
+	if version.PolicyVersion == nil || version.PolicyVersion.Document == nil {
+		return "", fmt.Errorf("managed policy %s version %s has no document", policyArn, *policy.Policy.DefaultVersionId)
+	}
+
+	// IAM returns policy documents percent-encoded (RFC 3986), so a literal "+" must stay a "+"
+	decoded, err := url.PathUnescape(*version.PolicyVersion.Document)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode managed policy %s document: %v", policyArn, err)
+	}
+	var docData any
+	if err := json.Unmarshal([]byte(decoded), &docData); err != nil {
+		return "", fmt.Errorf("invalid JSON in managed policy %s: %v", policyArn, err)
+	}
+
+	doc := ToJSONPretty(docData)
+	f.cache[policyArn] = doc
+	return doc, nil
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+// mockManagedPolicyGetter serves a single policy document, percent-encoded as IAM returns it
+type mockManagedPolicyGetter struct {
+	document      string
+	getPolicyErr  error
+	getVersionErr error
+	getCalls      int
+}
+
+func (m *mockManagedPolicyGetter) GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+	m.getCalls++
+	if m.getPolicyErr != nil {
+		return nil, m.getPolicyErr
+	}
+	return &iam.GetPolicyOutput{Policy: &types.Policy{Arn: params.PolicyArn, DefaultVersionId: StrPtr("v3")}}, nil
+}
+
+func (m *mockManagedPolicyGetter) GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+	if m.getVersionErr != nil {
+		return nil, m.getVersionErr
+	}
+	if AwsString(params.VersionId) != "v3" {
+		return nil, errors.New("unexpected version " + AwsString(params.VersionId))
+	}
+	doc := url.PathEscape(m.document)
+	return &iam.GetPolicyVersionOutput{PolicyVersion: &types.PolicyVersion{Document: &doc}}, nil
+}
+
+func TestIsManagedPolicyARN(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"arn:aws:iam::aws:policy/ReadOnlyAccess", true},
+		{"arn:aws:iam::123456789012:policy/team/DeployPolicy", true},
+		{"policies/extra.json", false},
+		{"arn:aws:iam::123456789012:role/Deploy", false},
+	}
+	for _, tt := range tests {
+		if got := IsManagedPolicyARN(tt.ref); got != tt.want {
+			t.Errorf("IsManagedPolicyARN(%q) = %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestManagedPolicyFetcherDecodesAndCaches(t *testing.T) {
+	client := &mockManagedPolicyGetter{
+		document: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}`,
+	}
+	fetcher := NewManagedPolicyFetcher(client)
+	arn := "arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess"
+
+	doc, err := fetcher.Fetch(context.Background(), arn)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if !strings.Contains(doc, `"s3:Get*"`) {
+		t.Errorf("Fetch() document missing action, got:\n%s", doc)
+	}
+
+	if _, err := fetcher.Fetch(context.Background(), arn); err != nil {
+		t.Fatalf("second Fetch() error = %v", err)
+	}
+	if client.getCalls != 1 {
+		t.Errorf("GetPolicy called %d times, want 1 (cached)", client.getCalls)
+	}
+}
+
+func TestManagedPolicyFetcherKeepsLiteralPlus(t *testing.T) {
+	client := &mockManagedPolicyGetter{
+		document: `{"Version":"2012-10-17","Statement":[{"Sid":"Tagged user","Effect":"Allow","Action":"s3:GetObject","Resource":"*","Condition":{"StringEquals":{"aws:PrincipalTag/email":"user+tag@example.com"}}}]}`,
+	}
+	doc, err := NewManagedPolicyFetcher(client).Fetch(context.Background(), "arn:aws:iam::123456789012:policy/Tagged")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if !strings.Contains(doc, `"user+tag@example.com"`) || !strings.Contains(doc, `"Tagged user"`) {
+		t.Errorf("Fetch() should keep literal '+' and spaces, got:\n%s", doc)
+	}
+}
+
+func TestManagedPolicyFetcherErrors(t *testing.T) {
+	arn := "arn:aws:iam::aws:policy/ReadOnlyAccess"
+
+	fetcher := NewManagedPolicyFetcher(&mockManagedPolicyGetter{getPolicyErr: errors.New("AccessDenied")})
+	if _, err := fetcher.Fetch(context.Background(), arn); err == nil || !strings.Contains(err.Error(), "iam:GetPolicy") {
+		t.Errorf("expected iam:GetPolicy error, got %v", err)
+	}
+
+	fetcher = NewManagedPolicyFetcher(&mockManagedPolicyGetter{getVersionErr: errors.New("AccessDenied")})
+	if _, err := fetcher.Fetch(context.Background(), arn); err == nil || !strings.Contains(err.Error(), "iam:GetPolicyVersion") {
+		t.Errorf("expected iam:GetPolicyVersion error, got %v", err)
+	}
+
+	fetcher = NewManagedPolicyFetcher(&mockManagedPolicyGetter{document: `{not json`})
+	if _, err := fetcher.Fetch(context.Background(), arn); err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Errorf("expected invalid JSON error, got %v", err)
+	}
+}
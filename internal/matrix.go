@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MatrixValue is one matrix variable's value within a cell
+type MatrixValue struct {
+	Name  string
+	Value any
+}
+
+// MatrixCell is one combination of matrix values, ordered by variable name
+type MatrixCell []MatrixValue
+
+// Vars returns the cell as template variables
+func (c MatrixCell) Vars() map[string]any {
+	vars := make(map[string]any, len(c))
+	for _, v := range c {
+		vars[v.Name] = v.Value
+	}
+	return vars
+}
+
+// Label formats the cell as "name=value, ..." for headers and summaries
+func (c MatrixCell) Label() string {
+	parts := make([]string, len(c))
+	for i, v := range c {
+		parts[i] = fmt.Sprintf("%s=%v", v.Name, v.Value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// MatrixCells expands a matrix into every combination of its values
+// Variables are ordered by name; the last one varies fastest. An empty matrix has no cells
+func MatrixCells(matrix map[string][]any) ([]MatrixCell, error) {
+	if len(matrix) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(matrix))
+	for name, values := range matrix {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("matrix variable %q has no values", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cells := []MatrixCell{nil}
+	for _, name := range names {
+		next := make([]MatrixCell, 0, len(cells)*len(matrix[name]))
+		for _, cell := range cells {
+			for _, value := range matrix[name] {
+				extended := append(append(MatrixCell{}, cell...), MatrixValue{Name: name, Value: value})
+				next = append(next, extended)
+			}
+		}
+		cells = next
+	}
+	return cells, nil
+}
+
+// ParseMatrixFlag parses a --matrix value of the form name=v1,v2,...
+func ParseMatrixFlag(s string) (string, []any, error) {
+	name, list, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.TrimSpace(list) == "" {
+		return "", nil, fmt.Errorf("invalid --matrix %q: expected name=value1,value2", s)
+	}
+	var values []any
+	for _, v := range strings.Split(list, ",") {
+		values = append(values, strings.TrimSpace(v))
+	}
+	return name, values, nil
+}
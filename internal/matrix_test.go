@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatrixCells(t *testing.T) {
+	cells, err := MatrixCells(map[string][]any{
+		"region": {"eu-west-2", "us-east-1"},
+		"env":    {"dev", "prod"},
+	})
+	if err != nil {
+		t.Fatalf("MatrixCells() error = %v", err)
+	}
+	var labels []string
+	for _, c := range cells {
+		labels = append(labels, c.Label())
+	}
+	want := []string{
+		"env=dev, region=eu-west-2",
+		"env=dev, region=us-east-1",
+		"env=prod, region=eu-west-2",
+		"env=prod, region=us-east-1",
+	}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("labels = %v, want %v", labels, want)
+	}
+	if got := cells[1].Vars(); !reflect.DeepEqual(got, map[string]any{"env": "dev", "region": "us-east-1"}) {
+		t.Errorf("Vars() = %v", got)
+	}
+
+	if cells, err := MatrixCells(nil); err != nil || cells != nil {
+		t.Errorf("empty matrix: cells=%v err=%v", cells, err)
+	}
+	if _, err := MatrixCells(map[string][]any{"env": {}}); err == nil {
+		t.Error("expected error for a variable with no values")
+	}
+}
+
+func TestParseMatrixFlag(t *testing.T) {
+	name, values, err := ParseMatrixFlag("region=eu-west-2, us-east-1")
+	if err != nil {
+		t.Fatalf("ParseMatrixFlag() error = %v", err)
+	}
+	if name != "region" || !reflect.DeepEqual(values, []any{"eu-west-2", "us-east-1"}) {
+		t.Errorf("got %q %v", name, values)
+	}
+	for _, bad := range []string{"region", "=a,b", "region="} {
+		if _, _, err := ParseMatrixFlag(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
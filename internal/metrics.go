@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RunMetrics collects per-scenario test counts for --metrics-file across every scenario a run touches
+// (one scenario, each --scenarios-dir file, or each matrix cell summed under its scenario)
+type RunMetrics struct {
+	counts map[string]*scenarioCounts
+}
+
+// scenarioCounts is the pass/fail tally for one scenario
+type scenarioCounts struct {
+	passed, failed int
+}
+
+// NewRunMetrics returns an empty collector
+func NewRunMetrics() *RunMetrics {
+	return &RunMetrics{counts: map[string]*scenarioCounts{}}
+}
+
+// record adds one run's counts to the scenario's tally; a nil collector records nothing
+func (m *RunMetrics) record(scenario string, passed, failed int) {
+	if m == nil {
+		return
+	}
+	c, ok := m.counts[scenario]
+	if !ok {
+		c = &scenarioCounts{}
+		m.counts[scenario] = c
+	}
+	c.passed += passed
+	c.failed += failed
+}
+
+// metricDefinitions are the metrics written to --metrics-file, in output order
+var metricDefinitions = []struct {
+	name  string
+	help  string
+	value func(scenarioCounts) int
+}{
+	{"politest_tests_total", "Tests run in the last politest run.", func(c scenarioCounts) int { return c.passed + c.failed }},
+	{"politest_tests_passed", "Tests that passed in the last politest run.", func(c scenarioCounts) int { return c.passed }},
+	{"politest_tests_failed", "Tests that failed in the last politest run.", func(c scenarioCounts) int { return c.failed }},
+}
+
+// Format renders the counts in the Prometheus text exposition format, one series per scenario
+func (m *RunMetrics) Format() string {
+	var b strings.Builder
+	scenarios := sortedKeys(m.counts)
+	for _, def := range metricDefinitions {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", def.name, def.help, def.name)
+		for _, scenario := range scenarios {
+			fmt.Fprintf(&b, "%s{scenario=\"%s\"} %d\n", def.name, escapeLabelValue(scenario), def.value(*m.counts[scenario]))
+		}
+	}
+	return b.String()
+}
+
+// WriteFile writes the metrics to path via a temporary file and rename, so a textfile collector
+// never reads a half-written file
+func (m *RunMetrics) WriteFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("--metrics-file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(m.Format()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("--metrics-file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("--metrics-file: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("--metrics-file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("--metrics-file: %v", err)
+	}
+	return nil
+}
+
+// MergeFile adds the counts of a metrics file written by WriteFile to m and returns its totals
+// Used to collect the results of scenarios run in separate processes; a nil collector only sums
+func (m *RunMetrics) MergeFile(path string) (passed, failed int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		name, rest, ok := strings.Cut(line, `{scenario="`)
+		if !ok || (name != "politest_tests_passed" && name != "politest_tests_failed") {
+			continue
+		}
+		i := strings.LastIndex(rest, `"} `)
+		if i < 0 {
+			return 0, 0, fmt.Errorf("%s: malformed metric line %q", path, line)
+		}
+		scenario, err := strconv.Unquote(`"` + rest[:i] + `"`)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: malformed scenario label in %q", path, line)
+		}
+		value, err := strconv.Atoi(rest[i+3:])
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: malformed metric value in %q", path, line)
+		}
+		if name == "politest_tests_passed" {
+			m.record(scenario, value, 0)
+			passed += value
+		} else {
+			m.record(scenario, 0, value)
+			failed += value
+		}
+	}
+	return passed, failed, scanner.Err()
+}
+
+// escapeLabelValue escapes a Prometheus label value (backslash, double quote and newline)
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunMetricsWriteFile(t *testing.T) {
+	m := NewRunMetrics()
+	m.record("/tmp/b.yml", 3, 1)
+	m.record("/tmp/a.yml", 2, 0)
+	m.record("/tmp/b.yml", 1, 1) // a second matrix cell of the same scenario
+	m.record(`/tmp/"odd".yml`, 0, 1)
+
+	path := filepath.Join(t.TempDir(), "politest.prom")
+	if err := m.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read metrics file: %v", err)
+	}
+	out := string(data)
+
+	for _, want := range []string{
+		"# TYPE politest_tests_total gauge\n",
+		`politest_tests_total{scenario="/tmp/b.yml"} 6`,
+		`politest_tests_passed{scenario="/tmp/b.yml"} 4`,
+		`politest_tests_failed{scenario="/tmp/b.yml"} 2`,
+		`politest_tests_total{scenario="/tmp/a.yml"} 2`,
+		`politest_tests_failed{scenario="/tmp/\"odd\".yml"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in metrics, got:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, `scenario="/tmp/a.yml"`) > strings.Index(out, `scenario="/tmp/b.yml"`) {
+		t.Errorf("Expected scenarios in sorted order, got:\n%s", out)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the metrics file to remain, got %d entries", len(entries))
+	}
+}
+
+func TestRunMetricsNilRecord(t *testing.T) {
+	var m *RunMetrics
+	m.record("/tmp/a.yml", 1, 0) // must not panic when --metrics-file is off
+}
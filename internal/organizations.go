@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// FetchAccountSCPs returns the SCPs attached to an account and every OU and root above it
+// Policies are ordered root first, then each OU down to the account, and named "org:<target>/<policy name>"
+// so matched statements point at where the policy is attached. A policy attached at several levels is kept once
+func FetchAccountSCPs(ctx context.Context, client OrganizationsPolicyReader, accountID string) ([]SCPDocument, error) {
+	targets, err := orgTargetChain(ctx, client, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []SCPDocument
+	seen := map[string]bool{}
+	for _, target := range targets {
+		summaries, err := listTargetSCPs(ctx, client, target)
+		if err != nil {
+			return nil, err
+		}
+		for _, summary := range summaries {
+			id := aws.ToString(summary.Id)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			out, err := client.DescribePolicy(ctx, &organizations.DescribePolicyInput{PolicyId: summary.Id})
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe SCP %s (requires organizations:DescribePolicy): %v", id, err)
+			}
+			if out.Policy == nil || out.Policy.Content == nil {
+				return nil, fmt.Errorf("SCP %s has no content", id)
+			}
+			doc := SCPDocument{
+				Name:    fmt.Sprintf("org:%s/%s", target, aws.ToString(summary.Name)),
+				Content: []byte(aws.ToString(out.Policy.Content)),
+			}
+			// Reject malformed content here, naming the attachment, rather than when the SCPs are merged
+			if err := decodeSCP(doc.Content, new(any)); err != nil {
+				return nil, &PolicyValidationError{Kind: "SCP", Path: doc.Name, Err: err}
+			}
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+// orgTargetChain walks ListParents from the account up to the root and returns the targets root first
+func orgTargetChain(ctx context.Context, client OrganizationsPolicyReader, accountID string) ([]string, error) {
+	chain := []string{accountID}
+	child := accountID
+	for {
+		out, err := client.ListParents(ctx, &organizations.ListParentsInput{ChildId: aws.String(child)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parents of %s (requires organizations:ListParents from the management or delegated administrator account): %v", child, err)
+		}
+		if len(out.Parents) == 0 {
+			return nil, fmt.Errorf("%s has no parent in the organization", child)
+		}
+		parent := out.Parents[0]
+		child = aws.ToString(parent.Id)
+		chain = append([]string{child}, chain...)
+		if parent.Type == types.ParentTypeRoot {
+			return chain, nil
+		}
+	}
+}
+
+// listTargetSCPs pages through the SCPs directly attached to one target
+func listTargetSCPs(ctx context.Context, client OrganizationsPolicyReader, target string) ([]types.PolicySummary, error) {
+	var summaries []types.PolicySummary
+	input := &organizations.ListPoliciesForTargetInput{
+		TargetId: aws.String(target),
+		Filter:   types.PolicyTypeServiceControlPolicy,
+	}
+	for {
+		out, err := client.ListPoliciesForTarget(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list SCPs for %s (requires organizations:ListPoliciesForTarget): %v", target, err)
+		}
+		summaries = append(summaries, out.Policies...)
+		if out.NextToken == nil {
+			return summaries, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
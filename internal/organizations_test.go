@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// mockOrganizations serves a fixed hierarchy: parents by child ID and policy pages by target ID
+type mockOrganizations struct {
+	parents  map[string]types.Parent
+	attached map[string][][]types.PolicySummary
+	content  map[string]string
+	err      error
+}
+
+func (m *mockOrganizations) ListParents(ctx context.Context, params *organizations.ListParentsInput, optFns ...func(*organizations.Options)) (*organizations.ListParentsOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	parent, ok := m.parents[aws.ToString(params.ChildId)]
+	if !ok {
+		return &organizations.ListParentsOutput{}, nil
+	}
+	return &organizations.ListParentsOutput{Parents: []types.Parent{parent}}, nil
+}
+
+func (m *mockOrganizations) ListPoliciesForTarget(ctx context.Context, params *organizations.ListPoliciesForTargetInput, optFns ...func(*organizations.Options)) (*organizations.ListPoliciesForTargetOutput, error) {
+	pages := m.attached[aws.ToString(params.TargetId)]
+	page := 0
+	if params.NextToken != nil {
+		page = 1
+	}
+	if page >= len(pages) {
+		return &organizations.ListPoliciesForTargetOutput{}, nil
+	}
+	out := &organizations.ListPoliciesForTargetOutput{Policies: pages[page]}
+	if page+1 < len(pages) {
+		out.NextToken = aws.String("next")
+	}
+	return out, nil
+}
+
+func (m *mockOrganizations) DescribePolicy(ctx context.Context, params *organizations.DescribePolicyInput, optFns ...func(*organizations.Options)) (*organizations.DescribePolicyOutput, error) {
+	id := aws.ToString(params.PolicyId)
+	return &organizations.DescribePolicyOutput{Policy: &types.Policy{Content: aws.String(m.content[id])}}, nil
+}
+
+func TestFetchAccountSCPs(t *testing.T) {
+	summary := func(id, name string) types.PolicySummary {
+		return types.PolicySummary{Id: aws.String(id), Name: aws.String(name)}
+	}
+	client := &mockOrganizations{
+		parents: map[string]types.Parent{
+			"111122223333":     {Id: aws.String("ou-ab12-workload"), Type: types.ParentTypeOrganizationalUnit},
+			"ou-ab12-workload": {Id: aws.String("r-ab12"), Type: types.ParentTypeRoot},
+		},
+		attached: map[string][][]types.PolicySummary{
+			"r-ab12":           {{summary("p-FullAWSAccess", "FullAWSAccess")}},
+			"ou-ab12-workload": {{summary("p-regions", "DenyRegions")}, {summary("p-FullAWSAccess", "FullAWSAccess")}},
+			"111122223333":     {{summary("p-iam", "DenyIAMUsers")}},
+		},
+		content: map[string]string{
+			"p-FullAWSAccess": `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`,
+			"p-regions":       `{"Version":"2012-10-17","Statement":[{"Sid":"DenyRegions","Effect":"Deny","Action":"*","Resource":"*"}]}`,
+			"p-iam":           `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"iam:CreateUser","Resource":"*"}]}`,
+		},
+	}
+
+	docs, err := FetchAccountSCPs(context.Background(), client, "111122223333")
+	if err != nil {
+		t.Fatalf("FetchAccountSCPs() error = %v", err)
+	}
+	var names []string
+	for _, d := range docs {
+		names = append(names, d.Name)
+	}
+	want := "org:r-ab12/FullAWSAccess, org:ou-ab12-workload/DenyRegions, org:111122223333/DenyIAMUsers"
+	if got := strings.Join(names, ", "); got != want {
+		t.Errorf("names = %s, want %s", got, want)
+	}
+
+	_, sourceMap, err := MergeSCPDocumentsWithSourceMap(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := sourceMap["scp:DenyRegions#stmt:0"]
+	if source == nil || source.FilePath != "org:ou-ab12-workload/DenyRegions" || source.Sid != "DenyRegions" {
+		t.Errorf("Unexpected source for DenyRegions: %+v", source)
+	}
+}
+
+func TestFetchAccountSCPsErrors(t *testing.T) {
+	client := &mockOrganizations{err: errors.New("AccessDeniedException")}
+	_, err := FetchAccountSCPs(context.Background(), client, "111122223333")
+	if err == nil || !strings.Contains(err.Error(), "organizations:ListParents") {
+		t.Errorf("Expected permission hint, got %v", err)
+	}
+
+	malformed := &mockOrganizations{
+		parents:  map[string]types.Parent{"111122223333": {Id: aws.String("r-ab12"), Type: types.ParentTypeRoot}},
+		attached: map[string][][]types.PolicySummary{"r-ab12": {{{Id: aws.String("p-bad"), Name: aws.String("DenyRegions")}}}},
+		content:  map[string]string{"p-bad": `{"Version":"2012-10-17","Statement":[`},
+	}
+	var policyErr *PolicyValidationError
+	if _, err := FetchAccountSCPs(context.Background(), malformed, "111122223333"); !errors.As(err, &policyErr) || policyErr.Path != "org:r-ab12/DenyRegions" {
+		t.Errorf("Expected a *PolicyValidationError naming org:r-ab12/DenyRegions, got %v", err)
+	}
+	if _, _, err := MergeSCPDocumentsWithSourceMap([]SCPDocument{{Name: "org:r-ab12/DenyRegions", Content: []byte("{")}}); !errors.As(err, &policyErr) || policyErr.Path != "org:r-ab12/DenyRegions" {
+		t.Errorf("Expected the merge to report the synthetic source, got %v", err)
+	}
+
+	orphan := &mockOrganizations{}
+	if _, err := FetchAccountSCPs(context.Background(), orphan, "111122223333"); err == nil || !strings.Contains(err.Error(), "no parent") {
+		t.Errorf("Expected no-parent error, got %v", err)
+	}
+}
@@ -2,28 +2,54 @@ package internal
 
 import (
 	"fmt"
+	"io"
 	"strings"
 )
 
 // PrintTable prints evaluation results in a formatted table
 func PrintTable(rows [][3]string) {
+	PrintTableWithHeaders([3]string{"Action", "Decision", "Matched (details)"}, rows)
+}
+
+// PrintTableWithHeaders prints rows in fixed-width columns under the given headers
+func PrintTableWithHeaders(headers [3]string, rows [][3]string) {
+	columns := make([][]string, len(rows))
+	for i, r := range rows {
+		columns[i] = r[:]
+	}
+	printColumns(Stdout, headers[:], columns)
+}
+
+// printColumns prints rows in fixed-width columns; the last column is left unpadded
+func printColumns(w io.Writer, headers []string, rows [][]string) {
 	if len(rows) == 0 {
-		fmt.Println("No evaluation results.")
+		fmt.Fprintln(w, "No evaluation results.")
 		return
 	}
 	// simple fixed-width columns
-	w1, w2 := 6, 8
-	for _, r := range rows {
-		if len(r[0]) > w1 {
-			w1 = len(r[0])
+	widths := make([]int, len(headers)-1)
+	for i := range widths {
+		widths[i] = len(headers[i])
+		for _, r := range rows {
+			widths[i] = max(widths[i], len(r[i]))
 		}
-		if len(r[1]) > w2 {
-			w2 = len(r[1])
+	}
+	line := func(cells []string) {
+		var b strings.Builder
+		for i, width := range widths {
+			fmt.Fprintf(&b, "%-*s  ", width, cells[i])
 		}
+		b.WriteString(cells[len(widths)])
+		fmt.Fprintln(w, b.String())
+	}
+	line(headers)
+	rules := make([]string, len(headers))
+	for i, width := range widths {
+		rules[i] = strings.Repeat("-", width)
 	}
-	fmt.Printf("%-*s  %-*s  %s\n", w1, "Action", w2, "Decision", "Matched (details)")
-	fmt.Printf("%s  %s  %s\n", strings.Repeat("-", w1), strings.Repeat("-", w2), strings.Repeat("-", 40))
+	rules[len(widths)] = strings.Repeat("-", 40)
+	line(rules)
 	for _, r := range rows {
-		fmt.Printf("%-*s  %-*s  %s\n", w1, r[0], w2, r[1], r[2])
+		line(r)
 	}
 }
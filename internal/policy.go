@@ -11,6 +11,16 @@ import (
 	"strings"
 )
 
+// TrackingSids controls whether statements get a tracking Sid (e.g. identity#stmt:0) injected
+// before submission (disabled by --no-tracking-sids). When off, policies are sent as written and
+// source maps are keyed by statementPositionKey, resolved from AWS's matched-statement positions
+var TrackingSids = true
+
+// statementPositionKey keys a statement source by its index in the submitted policy document
+func statementPositionKey(index int) string {
+	return "#" + strconv.Itoa(index)
+}
+
 // ExpandGlobsRelative expands glob patterns relative to a base directory
 func ExpandGlobsRelative(base string, patterns []string) []string {
 	var files []string
@@ -38,23 +48,65 @@ func ExpandGlobsRelative(base string, patterns []string) []string {
 }
 
 // MergeSCPFiles merges multiple SCP JSON files into a single policy document
-func MergeSCPFiles(files []string) map[string]any {
-	merged, _ := MergeSCPFilesWithSourceMap(files)
-	return merged
+func MergeSCPFiles(files []string) (map[string]any, error) {
+	merged, _, err := MergeSCPFilesWithSourceMap(files)
+	return merged, err
 }
 
 // MergeSCPFilesWithSourceMap merges multiple SCP JSON files and tracks statement origins with line numbers
-func MergeSCPFilesWithSourceMap(files []string) (map[string]any, map[string]*PolicySource) {
-	statements := []any{}
-	sourceMap := make(map[string]*PolicySource)
+func MergeSCPFilesWithSourceMap(files []string) (map[string]any, map[string]*PolicySource, error) {
+	docs, err := LoadSCPDocuments(files)
+	if err != nil {
+		return nil, nil, err
+	}
+	return MergeSCPDocumentsWithSourceMap(docs)
+}
 
+// LoadSCPDocuments reads SCP JSON files for MergeSCPDocumentsWithSourceMap
+// A file that isn't valid JSON is reported as a *PolicyValidationError naming it
+func LoadSCPDocuments(files []string) ([]SCPDocument, error) {
+	docs := make([]SCPDocument, 0, len(files))
 	for _, f := range files {
 		// Read the original file content for line number tracking
 		fileContent, err := os.ReadFile(f)
-		Check(err)
+		if err != nil {
+			return nil, err
+		}
+		if err := decodeSCP(fileContent, new(any)); err != nil {
+			return nil, &PolicyValidationError{Kind: "SCP", Path: f, Err: err}
+		}
+		docs = append(docs, SCPDocument{Name: f, Content: fileContent})
+	}
+	return docs, nil
+}
+
+// decodeSCP decodes an SCP document, keeping numbers as written
+func decodeSCP(content []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// SCPDocument is one SCP/RCP to merge: a file, or a policy fetched from AWS Organizations under a synthetic name
+type SCPDocument struct {
+	Name    string // File path, or synthetic name such as "org:ou-ab12-cd34ef56/DenyRegions"
+	Content []byte
+}
+
+// MergeSCPDocumentsWithSourceMap merges SCP documents in order and tracks statement origins with line numbers
+// A document that isn't valid JSON is reported as a *PolicyValidationError naming its file or synthetic source
+func MergeSCPDocumentsWithSourceMap(docs []SCPDocument) (map[string]any, map[string]*PolicySource, error) {
+	statements := []any{}
+	sourceMap := make(map[string]*PolicySource)
+	basenames := make(map[string]int)
+
+	for fileIdx, d := range docs {
+		f, fileContent := d.Name, d.Content
 
 		var doc any
-		Check(ReadJSONFile(f, &doc))
+		if err := decodeSCP(fileContent, &doc); err != nil {
+			return nil, nil, &PolicyValidationError{Kind: "SCP", Path: f, Err: err}
+		}
 
 		var stmtsToAdd []any
 		switch t := doc.(type) {
@@ -75,12 +127,20 @@ func MergeSCPFilesWithSourceMap(files []string) (map[string]any, map[string]*Pol
 			stmtsToAdd = []any{t}
 		}
 
+		// Use the basename to keep Sids readable; files sharing a basename (e.g. ou-a/deny.json
+		// and ou-b/deny.json) get their position in the merge appended so tracking Sids stay unique
+		sidPrefix := "scp:" + filepath.Base(f)
+		if basenames[filepath.Base(f)] > 0 {
+			sidPrefix += "@" + strconv.Itoa(fileIdx+1)
+		}
+		basenames[filepath.Base(f)]++
+
 		// Inject unique Sid and track source for each statement
+		locator := newStatementLocator(string(fileContent))
 		for idx, stmt := range stmtsToAdd {
 			if stmtMap, ok := stmt.(map[string]any); ok {
 				// Create unique Sid from file path and statement index
-				relPath := filepath.Base(f) // Use basename to keep Sids readable
-				trackingSid := "scp:" + relPath + "#stmt:" + strconv.Itoa(idx)
+				trackingSid := sidPrefix + "#stmt:" + strconv.Itoa(idx)
 
 				// Store original Sid if it exists
 				originalSid := ""
@@ -91,13 +151,18 @@ func MergeSCPFilesWithSourceMap(files []string) (map[string]any, map[string]*Pol
 				}
 
 				// Find line numbers for this statement in the original file
-				startLine, endLine := findStatementLineNumbers(string(fileContent), stmtMap, idx)
+				startLine, endLine := locator.locate(stmtMap)
 
-				// Inject our tracking Sid
-				stmtMap["Sid"] = trackingSid
+				// Inject our tracking Sid, or key by position in the merged document
+				key := trackingSid
+				if TrackingSids {
+					stmtMap["Sid"] = trackingSid
+				} else {
+					key = statementPositionKey(len(statements))
+				}
 
 				// Track source
-				sourceMap[trackingSid] = &PolicySource{
+				sourceMap[key] = &PolicySource{
 					FilePath:  f,
 					Sid:       originalSid,
 					Index:     idx,
@@ -117,20 +182,51 @@ func MergeSCPFilesWithSourceMap(files []string) (map[string]any, map[string]*Pol
 		"Statement": statements,
 	}
 
-	return merged, sourceMap
+	return merged, sourceMap, nil
 }
 
 // ProcessIdentityPolicyWithSourceMap processes an identity policy JSON and returns it with tracking Sids injected
 // and a source map for each statement
-func ProcessIdentityPolicyWithSourceMap(policyJSON string, filePath string) (string, map[string]*PolicySource) {
+func ProcessIdentityPolicyWithSourceMap(policyJSON string, filePath string) (string, map[string]*PolicySource, error) {
+	return processPolicyWithSourceMap(policyJSON, filePath, "identity")
+}
+
+// ProcessResourcePolicyWithSourceMap processes a resource policy JSON and returns it with tracking Sids injected
+// and a source map for each statement, so matched resource policy statements can show their source lines
+func ProcessResourcePolicyWithSourceMap(policyJSON string, filePath string) (string, map[string]*PolicySource, error) {
+	return processPolicyWithSourceMap(policyJSON, filePath, "resource")
+}
+
+// ProcessBoundaryPolicyWithSourceMap processes a permissions boundary policy JSON and returns it with tracking
+// Sids injected and a source map for each statement
+func ProcessBoundaryPolicyWithSourceMap(policyJSON string, filePath string) (string, map[string]*PolicySource, error) {
+	return processPolicyWithSourceMap(policyJSON, filePath, "boundary")
+}
+
+// ProcessBoundaryDocumentWithSourceMap is ProcessBoundaryPolicyWithSourceMap for a boundary with no file,
+// such as a fetched managed policy; line numbers refer to policyJSON itself and sources are attributed to name
+func ProcessBoundaryDocumentWithSourceMap(policyJSON string, name string) (string, map[string]*PolicySource, error) {
+	return processPolicyContentWithSourceMap(policyJSON, name, []byte(policyJSON), "boundary")
+}
+
+// processPolicyWithSourceMap injects "<kind>#stmt:<index>" tracking Sids into each statement
+// and records the original Sid and line numbers from filePath
+func processPolicyWithSourceMap(policyJSON string, filePath string, kind string) (string, map[string]*PolicySource, error) {
 	// Read the original file content for line number tracking
 	fileContent, err := os.ReadFile(filePath)
-	Check(err)
+	if err != nil {
+		return "", nil, err
+	}
+	return processPolicyContentWithSourceMap(policyJSON, filePath, fileContent, kind)
+}
 
+// processPolicyContentWithSourceMap does the work of processPolicyWithSourceMap, locating lines in fileContent
+// A policy that isn't a valid JSON object is reported as a *PolicyValidationError naming filePath
+func processPolicyContentWithSourceMap(policyJSON string, filePath string, fileContent []byte, kind string) (string, map[string]*PolicySource, error) {
 	// Parse the policy JSON
 	var policy map[string]any
 	if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
-		Die("invalid JSON in identity policy: %v", err)
+		return "", nil, &PolicyValidationError{Kind: kind + " policy", Path: filePath, Err: err}
 	}
 
 	sourceMap := make(map[string]*PolicySource)
@@ -145,14 +241,15 @@ func ProcessIdentityPolicyWithSourceMap(policyJSON string, filePath string) (str
 		}
 	} else {
 		// No statements to track
-		return policyJSON, sourceMap
+		return policyJSON, sourceMap, nil
 	}
 
 	// Process each statement to inject tracking Sids
+	locator := newStatementLocator(string(fileContent))
 	for idx, stmt := range statements {
 		if stmtMap, ok := stmt.(map[string]any); ok {
 			// Create tracking Sid
-			trackingSid := "identity#stmt:" + strconv.Itoa(idx)
+			trackingSid := kind + "#stmt:" + strconv.Itoa(idx)
 
 			// Store original Sid if it exists
 			originalSid := ""
@@ -163,13 +260,18 @@ func ProcessIdentityPolicyWithSourceMap(policyJSON string, filePath string) (str
 			}
 
 			// Find line numbers for this statement
-			startLine, endLine := findStatementLineNumbers(string(fileContent), stmtMap, idx)
+			startLine, endLine := locator.locate(stmtMap)
 
-			// Inject tracking Sid
-			stmtMap["Sid"] = trackingSid
+			// Inject tracking Sid, or key by position when the policy is sent unmodified
+			key := trackingSid
+			if TrackingSids {
+				stmtMap["Sid"] = trackingSid
+			} else {
+				key = statementPositionKey(idx)
+			}
 
 			// Track source
-			sourceMap[trackingSid] = &PolicySource{
+			sourceMap[key] = &PolicySource{
 				FilePath:  filePath,
 				Sid:       originalSid,
 				Index:     idx,
@@ -179,39 +281,79 @@ func ProcessIdentityPolicyWithSourceMap(policyJSON string, filePath string) (str
 		}
 	}
 
+	if !TrackingSids {
+		return policyJSON, sourceMap, nil
+	}
+
 	// Re-serialize the modified policy
 	modifiedJSON, err := json.Marshal(policy)
-	Check(err)
+	if err != nil {
+		return "", nil, err
+	}
 
-	return string(modifiedJSON), sourceMap
+	return string(modifiedJSON), sourceMap, nil
 }
 
-// findStatementLineNumbers finds the line numbers where a statement appears in the source file
-func findStatementLineNumbers(fileContent string, stmt map[string]any, stmtIndex int) (int, int) {
-	lines := strings.Split(fileContent, "\n")
+// statementLocator finds the source lines of a file's statements, visited in document order
+// It counts how often each Sid and Effect marker has been seen so that statements sharing a
+// marker (duplicate Sids, or several Sid-less Deny statements) resolve to their own lines
+type statementLocator struct {
+	content string
+	seen    map[string]int
+}
 
-	// Try to find the statement's Sid or Effect as a marker
-	var searchKey, searchValue string
+func newStatementLocator(content string) *statementLocator {
+	return &statementLocator{content: content, seen: make(map[string]int)}
+}
+
+// locate returns the line range of the next statement; call it before injecting tracking Sids
+func (l *statementLocator) locate(stmt map[string]any) (int, int) {
+	key, value := statementMarker(stmt)
+	start, end := findStatementLineNumbers(l.content, stmt, l.seen[key+"="+value])
+
+	// Every statement's Effect line is a potential Effect match, so count them all
+	if effect, ok := stmt["Effect"].(string); ok {
+		l.seen["Effect="+effect]++
+	}
+	if sid, ok := stmt["Sid"].(string); ok && sid != "" {
+		l.seen["Sid="+sid]++
+	}
+	return start, end
+}
+
+// statementMarker picks the field used to find a statement in its source file: Sid, else Effect
+func statementMarker(stmt map[string]any) (string, string) {
 	if sid, ok := stmt["Sid"].(string); ok && sid != "" {
-		searchKey = "Sid"
-		searchValue = sid
-	} else if effect, ok := stmt["Effect"].(string); ok {
-		searchKey = "Effect"
-		searchValue = effect
+		return "Sid", sid
+	}
+	if effect, ok := stmt["Effect"].(string); ok {
+		return "Effect", effect
 	}
+	return "", ""
+}
+
+// findStatementLineNumbers finds the line numbers where a statement appears in the source file
+// occurrence selects which match of the statement's Sid (or Effect) marker to use, 0-based
+func findStatementLineNumbers(fileContent string, stmt map[string]any, occurrence int) (int, int) {
+	lines := strings.Split(fileContent, "\n")
 
+	// Try to find the statement's Sid or Effect as a marker
+	searchKey, searchValue := statementMarker(stmt)
 	if searchKey == "" {
 		return 0, 0
 	}
 
 	// Search for the key-value pair in the file
 	searchPattern := "\"" + searchKey + "\"" + ":" // Look for "Sid": or "Effect":
+	quotedValue := "\"" + searchValue + "\""       // Exact value, so "Deny" does not match "DenyS3"
 	var startLine int
 
 	for i, line := range lines {
-		if strings.Contains(line, searchPattern) && strings.Contains(line, searchValue) {
-			// Found the statement - since Sids are unique in a file, just use the first match
-			// (stmtIndex is only needed when the same Sid appears multiple times, like in merged SCPs)
+		if strings.Contains(line, searchPattern) && strings.Contains(line, quotedValue) {
+			if occurrence > 0 {
+				occurrence--
+				continue
+			}
 
 			// Search backwards for opening brace
 			for j := i; j >= 0; j-- {
@@ -222,6 +364,11 @@ func findStatementLineNumbers(fileContent string, stmt map[string]any, stmtIndex
 				}
 			}
 
+			// Statement isn't on its own lines (e.g. a single-line policy file)
+			if startLine == 0 {
+				break
+			}
+
 			// Search forwards for closing brace
 			braceCount := 0
 			foundOpen := false
@@ -288,18 +435,56 @@ func ToJSONPretty(v any) string {
 	return string(b)
 }
 
+// mergedSCPSource is one entry of the --dump-merged-scp sidecar, keyed by tracking Sid
+type mergedSCPSource struct {
+	File      string `json:"file"`
+	Sid       string `json:"sid,omitempty"` // original Sid, before the tracking Sid replaced it
+	Index     int    `json:"index"`         // statement index in the source file
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+}
+
+// MergedSCPSourcesPath returns the sidecar path written next to a --dump-merged-scp file,
+// e.g. merged.json -> merged.sources.json
+func MergedSCPSourcesPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".sources.json"
+}
+
+// DumpMergedSCP writes the merged SCP document as submitted to AWS (tracking Sids included), pretty-printed,
+// and a sidecar mapping each tracking Sid to the file, line range and original Sid it came from
+func DumpMergedSCP(path, mergedJSON string, sources map[string]*PolicySource) error {
+	var doc any
+	if err := json.Unmarshal([]byte(mergedJSON), &doc); err != nil {
+		return fmt.Errorf("--dump-merged-scp: %v", err)
+	}
+	entries := make(map[string]mergedSCPSource, len(sources))
+	for key, src := range sources {
+		entries[key] = mergedSCPSource{File: src.FilePath, Sid: src.Sid, Index: src.Index, StartLine: src.StartLine, EndLine: src.EndLine}
+	}
+	if err := os.WriteFile(path, []byte(ToJSONPretty(doc)+"\n"), 0o644); err != nil {
+		return fmt.Errorf("--dump-merged-scp: %v", err)
+	}
+	if err := os.WriteFile(MergedSCPSourcesPath(path), []byte(ToJSONPretty(entries)+"\n"), 0o644); err != nil {
+		return fmt.Errorf("--dump-merged-scp: %v", err)
+	}
+	return nil
+}
+
 // StripNonIAMFields removes all fields that are not part of the official IAM policy schema
 // This allows policies with metadata/comments to work with AWS API
-func StripNonIAMFields(policyJSON string) string {
+// The JSON error is returned as-is for the caller to wrap with the policy's kind and path
+func StripNonIAMFields(policyJSON string) (string, error) {
 	var policy map[string]any
 	if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
-		Die("invalid JSON in policy: %v", err)
+		return "", err
 	}
 
 	cleaned := stripPolicyDocument(policy)
 	b, err := json.MarshalIndent(cleaned, "", "  ")
-	Check(err)
-	return string(b)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
 }
 
 // ValidateIAMFields checks if policy contains non-IAM fields and returns error with details
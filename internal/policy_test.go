@@ -2,6 +2,8 @@ package internal
 
 import (
 	"encoding/json"
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -121,7 +123,10 @@ func TestMergeSCPFiles(t *testing.T) {
 	}
 
 	paths := []string{scp1, scp2}
-	result := MergeSCPFiles(paths)
+	result, err := MergeSCPFiles(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	statements := result["Statement"].([]any)
 	if len(statements) != 2 {
@@ -267,7 +272,10 @@ func TestMergeSCPFilesWithEmptyStatements(t *testing.T) {
 	}
 
 	paths := []string{scp}
-	result := MergeSCPFiles(paths)
+	result, err := MergeSCPFiles(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	statements := result["Statement"].([]any)
 	if len(statements) != 0 {
@@ -340,7 +348,10 @@ func TestMergeSCPFilesEdgeCases(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result := MergeSCPFiles([]string{scpSingle})
+	result, err := MergeSCPFiles([]string{scpSingle})
+	if err != nil {
+		t.Fatal(err)
+	}
 	statements := result["Statement"].([]any)
 	if len(statements) != 1 {
 		t.Errorf("MergeSCPFiles() with single Statement object = %v statements, want 1", len(statements))
@@ -353,7 +364,10 @@ func TestMergeSCPFilesEdgeCases(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result2 := MergeSCPFiles([]string{scpArray})
+	result2, err := MergeSCPFiles([]string{scpArray})
+	if err != nil {
+		t.Fatal(err)
+	}
 	statements2 := result2["Statement"].([]any)
 	if len(statements2) != 1 {
 		t.Errorf("MergeSCPFiles() with array document = %v statements, want 1", len(statements2))
@@ -414,7 +428,10 @@ func TestMergeSCPFilesWithMultipleStatements(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	policy := MergeSCPFiles([]string{scp1, scp2})
+	policy, err := MergeSCPFiles([]string{scp1, scp2})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Should merge all statements from both files
 	statements, ok := policy["Statement"].([]any)
@@ -445,7 +462,10 @@ func TestMergeSCPFilesWithSourceMap(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	merged, sourceMap := MergeSCPFilesWithSourceMap([]string{scp1})
+	merged, sourceMap, err := MergeSCPFilesWithSourceMap([]string{scp1})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Verify merged policy structure
 	statements := merged["Statement"].([]any)
@@ -487,6 +507,143 @@ func TestMergeSCPFilesWithSourceMap(t *testing.T) {
 	}
 }
 
+func TestMergeSCPFilesWithSourceMapDisambiguation(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"ou-a", "ou-b"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Same basename in two directories, and a file with two Sid-less Deny statements
+	scpA := filepath.Join(tmpDir, "ou-a", "deny.json")
+	scpB := filepath.Join(tmpDir, "ou-b", "deny.json")
+	files := map[string]string{
+		scpA: `{
+  "Statement": [
+    {
+      "Sid": "DenyAll",
+      "Effect": "Deny",
+      "Action": "*",
+      "Resource": "*"
+    }
+  ]
+}`,
+		scpB: `{
+  "Statement": [
+    {
+      "Effect": "Deny",
+      "Action": "s3:*",
+      "Resource": "*"
+    },
+    {
+      "Effect": "Deny",
+      "Action": "ec2:*",
+      "Resource": "*"
+    }
+  ]
+}`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, sourceMap, err := MergeSCPFilesWithSourceMap([]string{scpA, scpB})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sid       string
+		file      string
+		startLine int
+		endLine   int
+	}{
+		{"scp:deny.json#stmt:0", scpA, 3, 8},
+		{"scp:deny.json@2#stmt:0", scpB, 3, 7},
+		{"scp:deny.json@2#stmt:1", scpB, 8, 12},
+	}
+	if len(sourceMap) != len(tests) {
+		t.Fatalf("Expected %d tracked statements, got %d: %v", len(tests), len(sourceMap), sourceMap)
+	}
+	for _, tt := range tests {
+		src, ok := sourceMap[tt.sid]
+		if !ok {
+			t.Errorf("Missing tracking Sid %s", tt.sid)
+			continue
+		}
+		if src.FilePath != tt.file || src.StartLine != tt.startLine || src.EndLine != tt.endLine {
+			t.Errorf("%s: got %s:%d-%d, want %s:%d-%d", tt.sid, src.FilePath, src.StartLine, src.EndLine, tt.file, tt.startLine, tt.endLine)
+		}
+	}
+}
+
+func TestPolicyLoadersReturnErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	badSCP := filepath.Join(tmpDir, "bad-scp.json")
+	if err := os.WriteFile(badSCP, []byte(`{"Version": "2012-10-17", "Statement": [`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var policyErr *PolicyValidationError
+	if _, err := LoadSCPDocuments([]string{badSCP}); !errors.As(err, &policyErr) || policyErr.Path != badSCP || policyErr.Kind != "SCP" {
+		t.Errorf("LoadSCPDocuments() error = %v, want a *PolicyValidationError for %s", err, badSCP)
+	}
+	if _, _, err := MergeSCPFilesWithSourceMap([]string{filepath.Join(tmpDir, "missing.json")}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("MergeSCPFilesWithSourceMap() error = %v, want a missing file error", err)
+	}
+	if _, _, err := ProcessIdentityPolicyWithSourceMap(`{"Statement": [`, badSCP); !errors.As(err, &policyErr) || policyErr.Kind != "identity policy" {
+		t.Errorf("ProcessIdentityPolicyWithSourceMap() error = %v, want a *PolicyValidationError", err)
+	}
+	if _, _, err := ProcessResourcePolicyWithSourceMap(`{}`, filepath.Join(tmpDir, "missing.json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ProcessResourcePolicyWithSourceMap() error = %v, want a missing file error", err)
+	}
+}
+
+func TestProcessIdentityPolicyWithoutTrackingSids(t *testing.T) {
+	original := TrackingSids
+	defer func() { TrackingSids = original }()
+	TrackingSids = false
+
+	tmpDir := t.TempDir()
+	policyPath := filepath.Join(tmpDir, "policy.json")
+	policyJSON := `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "Read",
+      "Effect": "Allow",
+      "Action": "s3:GetObject",
+      "Resource": "*"
+    },
+    {
+      "Effect": "Deny",
+      "Action": "s3:DeleteObject",
+      "Resource": "*"
+    }
+  ]
+}`
+	if err := os.WriteFile(policyPath, []byte(policyJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	submitted, sourceMap, err := ProcessIdentityPolicyWithSourceMap(policyJSON, policyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if submitted != policyJSON {
+		t.Errorf("Expected policy to be submitted unmodified, got:\n%s", submitted)
+	}
+	if src := sourceMap[statementPositionKey(0)]; src == nil || src.Sid != "Read" || src.StartLine != 4 {
+		t.Errorf("Expected position key #0 for the Read statement, got %+v", src)
+	}
+	if src := sourceMap[statementPositionKey(1)]; src == nil || src.StartLine != 10 {
+		t.Errorf("Expected position key #1 for the Deny statement, got %+v", src)
+	}
+}
+
 func TestFindStatementLineNumbers(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -656,7 +813,10 @@ func TestStripNonIAMFields(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := StripNonIAMFields(tt.input)
+			result, err := StripNonIAMFields(tt.input)
+			if err != nil {
+				t.Fatalf("StripNonIAMFields() error = %v", err)
+			}
 
 			// Verify result is valid JSON
 			var parsed map[string]any
@@ -838,7 +998,10 @@ func TestStripNonIAMFieldsPreservesStructure(t *testing.T) {
 		]
 	}`
 
-	result := StripNonIAMFields(input)
+	result, err := StripNonIAMFields(input)
+	if err != nil {
+		t.Fatalf("StripNonIAMFields() error = %v", err)
+	}
 
 	// Verify structure is preserved
 	var parsed map[string]any
@@ -879,3 +1042,17 @@ func TestStripNonIAMFieldsPreservesStructure(t *testing.T) {
 		t.Error("Condition not preserved")
 	}
 }
+
+func TestStripNonIAMFieldsInvalidJSON(t *testing.T) {
+	originalExiter := GlobalExiter
+	defer func() { GlobalExiter = originalExiter }()
+	mockExit := &mockExiter{}
+	GlobalExiter = mockExit
+
+	if _, err := StripNonIAMFields(`{"Version":`); err == nil {
+		t.Error("StripNonIAMFields() expected an error for invalid JSON")
+	}
+	if mockExit.called {
+		t.Error("StripNonIAMFields() should return an error instead of calling Exit")
+	}
+}
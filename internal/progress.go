@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// progressBarWidth is the number of cells in the --progress bar
+const progressBarWidth = 30
+
+// progressBar redraws a single "[=====>    ] n/total ✓ passed ✗ failed" line in place for --progress
+type progressBar struct {
+	w      io.Writer
+	total  int
+	done   int
+	passed int
+	failed int
+}
+
+func newProgressBar(w io.Writer, total int) *progressBar {
+	p := &progressBar{w: w, total: total}
+	p.draw()
+	return p
+}
+
+// update records one finished test and redraws the bar
+func (p *progressBar) update(passed bool) {
+	p.done++
+	if passed {
+		p.passed++
+	} else {
+		p.failed++
+	}
+	p.draw()
+}
+
+func (p *progressBar) draw() {
+	filled := progressBarWidth
+	if p.total > 0 {
+		filled = p.done * progressBarWidth / p.total
+	}
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+	fmt.Fprintf(p.w, "\r[%s] %d/%d  ✓ %d  ✗ %d", bar, p.done, p.total, p.passed, p.failed)
+}
+
+// finish ends the bar's line so the output that follows starts on a fresh one
+func (p *progressBar) finish() {
+	fmt.Fprint(p.w, "\n\n")
+}
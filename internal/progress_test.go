@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestRunTestsProgress(t *testing.T) {
+	oldStdout, oldStderr := Stdout, Stderr
+	defer func() { Stdout, Stderr = oldStdout, oldStderr }()
+
+	client := &mockIAMClient{
+		SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+			return &iam.SimulateCustomPolicyOutput{
+				EvaluationResults: []types.EvaluationResult{{EvalActionName: &params.ActionNames[0], EvalDecision: types.PolicyEvaluationDecisionTypeAllowed}},
+			}, nil
+		},
+	}
+	scen := &Scenario{Tests: []TestCase{
+		{Name: "passes", Action: "s3:GetObject", Expect: "allowed"},
+		{Name: "fails", Action: "s3:PutObject", Expect: "explicitDeny"},
+	}}
+
+	var out, errOut strings.Builder
+	Stdout, Stderr = &out, &errOut
+	_ = RunTests(client, scen, SimulatorConfig{Variables: map[string]any{}, Progress: true})
+
+	if !strings.HasSuffix(errOut.String(), "\r[==============================] 2/2  ✓ 1  ✗ 1\n\n") {
+		t.Errorf("Unexpected progress output: %q", errOut.String())
+	}
+	if strings.Contains(out.String(), "passes") {
+		t.Errorf("Passing tests should not be printed with --progress:\n%s", out.String())
+	}
+	failure := strings.Index(out.String(), "[2/2] fails")
+	summary := strings.Index(out.String(), "Test Results: 1 passed, 1 failed")
+	if failure < 0 || summary < failure {
+		t.Errorf("Expected the failure before the summary:\n%s", out.String())
+	}
+}
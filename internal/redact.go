@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"io"
+	"regexp"
+)
+
+var (
+	// Pattern for ARNs: captures everything up to and including the account field, then the resource
+	arnPattern = regexp.MustCompile(`(arn:[A-Za-z0-9-]+:[A-Za-z0-9-]*:[A-Za-z0-9-]*:[^:\s"']*:)[^\s"',\])]+`)
+	// Pattern for standalone 12-digit AWS account IDs
+	accountIDPattern = regexp.MustCompile(`\b\d{12}\b`)
+)
+
+// RedactText masks AWS account IDs and the resource portion of ARNs
+func RedactText(s string) string {
+	s = arnPattern.ReplaceAllString(s, "${1}***")
+	return accountIDPattern.ReplaceAllString(s, "************")
+}
+
+// RedactingWriter masks account IDs and ARN resources before writing to the underlying writer
+type RedactingWriter struct {
+	W io.Writer
+}
+
+// Write redacts p and writes it to the underlying writer
+// It reports len(p) on success so callers see their full input as consumed
+func (r RedactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.W, RedactText(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
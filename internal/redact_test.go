@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRedactText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "s3 arn without account",
+			input: "s3:GetObject on arn:aws:s3:::my-bucket/*",
+			want:  "s3:GetObject on arn:aws:s3:::***",
+		},
+		{
+			name:  "iam arn with account",
+			input: "Caller: arn:aws:iam::123456789012:user/alice",
+			want:  "Caller: arn:aws:iam::************:***",
+		},
+		{
+			name:  "arn inside json",
+			input: `"Resource": "arn:aws:sqs:us-east-1:123456789012:queue",`,
+			want:  `"Resource": "arn:aws:sqs:us-east-1:************:***",`,
+		},
+		{
+			name:  "standalone account id",
+			input: "account 210987654321 owns the bucket",
+			want:  "account ************ owns the bucket",
+		},
+		{
+			name:  "other numbers untouched",
+			input: "Test Results: 12 passed, 0 failed (1234567890123 ms)",
+			want:  "Test Results: 12 passed, 0 failed (1234567890123 ms)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactText(tt.input); got != tt.want {
+				t.Errorf("RedactText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := RedactingWriter{W: &buf}
+
+	input := []byte("arn:aws:iam::123456789012:role/admin\n")
+	n, err := w.Write(input)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if n != len(input) {
+		t.Errorf("Write() = %d, want %d", n, len(input))
+	}
+	if buf.String() != "arn:aws:iam::************:***\n" {
+		t.Errorf("Unexpected redacted output: %q", buf.String())
+	}
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// ReportData is the data model passed to a --template-file template
+type ReportData struct {
+	Scenario string            // Absolute path of the scenario file
+	Metadata map[string]string // Scenario metadata (owner, ticket, ...)
+	Tests    []ReportTest      // Tests in the order they ran
+	Summary  ReportSummary
+}
+
+// ReportTest is the outcome of one executed test
+type ReportTest struct {
+	Index     int // 0-based, as in --format jsonl
+	Number    int // 1-based, for numbered formats such as TAP
+	Name      string
+	Action    string   // Rendered action
+	Resources []string // Rendered resources
+	Expect    string   // Expected decision ("" when the test has no expectation)
+	Reason    string   // expect_reason
+	Decision  string   // Decision returned by AWS
+	Passed    bool
+	Severity  string        // severity ("" when the test has none)
+	Matched   []ReportMatch // Matched statements, resolved to their source where possible
+}
+
+// ReportMatch is one matched statement and where it came from
+type ReportMatch struct {
+	SourcePolicyID string // Policy input as reported by AWS, e.g. PolicyInputList.1
+	File           string // Source file ("" when it could not be resolved)
+	Sid            string // Original Sid ("" when the statement has none)
+	StartLine      int
+	EndLine        int
+}
+
+// ReportSummary holds the run's counts
+type ReportSummary struct {
+	Total   int // Tests run (excludes Skipped)
+	Passed  int
+	Failed  int
+	Skipped int // Tests not run because of --max-failures
+}
+
+// reportFuncs are available to --template-file templates in addition to templateFuncs
+var reportFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// loadReportTemplate parses a --template-file before any test runs so mistakes fail fast
+func loadReportTemplate(path string) (*template.Template, error) {
+	tpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Funcs(reportFuncs).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --template-file %s: %v", path, err)
+	}
+	return tpl, nil
+}
+
+// buildReportData converts the run's results into the documented template data model
+func buildReportData(cfg SimulatorConfig, metadata map[string]string, results []testResult, skipped int) ReportData {
+	data := ReportData{
+		Scenario: cfg.ScenarioPath,
+		Metadata: metadata,
+		Tests:    make([]ReportTest, 0, len(results)),
+		Summary:  ReportSummary{Total: len(results), Skipped: skipped},
+	}
+	for _, r := range results {
+		if r.Passed {
+			data.Summary.Passed++
+		} else {
+			data.Summary.Failed++
+		}
+		data.Tests = append(data.Tests, ReportTest{
+			Index:     r.Index,
+			Number:    r.Index + 1,
+			Name:      r.Name,
+			Action:    r.Action,
+			Resources: r.Resources,
+			Expect:    r.Expect,
+			Reason:    r.Reason,
+			Decision:  r.Decision,
+			Passed:    r.Passed,
+			Severity:  r.Severity,
+			Matched:   reportMatches(r, cfg),
+		})
+	}
+	return data
+}
+
+// reportMatches resolves a result's matched statements through the source map
+func reportMatches(r testResult, cfg SimulatorConfig) []ReportMatch {
+	if r.Response == nil || len(r.Response.EvaluationResults) == 0 {
+		return nil
+	}
+	var matches []ReportMatch
+	for _, stmt := range r.Response.EvaluationResults[0].MatchedStatements {
+		m := ReportMatch{SourcePolicyID: AwsString(stmt.SourcePolicyId)}
+		if cfg.SourceMap != nil {
+			if source, ok := resolveStatementSource(stmt, cfg); ok && source != nil {
+				m.File, m.Sid, m.StartLine, m.EndLine = source.FilePath, source.Sid, source.StartLine, source.EndLine
+			}
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
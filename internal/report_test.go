@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestRunTestsTemplateFile(t *testing.T) {
+	originalStdout, originalStderr := Stdout, Stderr
+	defer func() { Stdout, Stderr = originalStdout, originalStderr }()
+	var stdout, stderr strings.Builder
+	Stdout, Stderr = &stdout, &stderr
+
+	tmpDir := t.TempDir()
+	tplPath := filepath.Join(tmpDir, "report.tmpl")
+	tpl := `{{ .Summary.Passed }}/{{ .Summary.Total }}
+{{- range .Tests }}
+{{ .Number }} {{ .Name }} {{ .Decision }} {{ if .Passed }}PASS{{ else }}FAIL{{ end }} [{{ join .Resources "," }}]{{ range .Matched }} {{ .File }}:{{ .Sid }}:{{ .StartLine }}{{ end }}
+{{- end }}
+`
+	if err := os.WriteFile(tplPath, []byte(tpl), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mockClient := &mockIAMClient{
+		SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+			action := params.ActionNames[0]
+			return &iam.SimulateCustomPolicyOutput{
+				EvaluationResults: []types.EvaluationResult{{
+					EvalActionName:    &action,
+					EvalDecision:      types.PolicyEvaluationDecisionTypeAllowed,
+					MatchedStatements: []types.Statement{{SourcePolicyId: StrPtr("ResourcePolicy")}},
+				}},
+			}, nil
+		},
+	}
+
+	scen := &Scenario{Tests: []TestCase{
+		{Name: "read", Action: "s3:GetObject", Resources: []string{"arn:aws:s3:::a/*", "arn:aws:s3:::b/*"}, Expect: "allowed"},
+		{Name: "delete", Action: "s3:DeleteObject", Resource: "arn:aws:s3:::a/*", Expect: "implicitDeny"},
+	}}
+	cfg := SimulatorConfig{
+		TemplateFile: tplPath,
+		Variables:    map[string]any{},
+		// Untracked resource policy statements resolve to the file-level source
+		SourceMap: &PolicySourceMap{ResourcePolicy: &PolicySource{FilePath: "bucket.json", Sid: "AllowRead", StartLine: 3}},
+	}
+
+	err := RunTests(mockClient, scen, cfg)
+	if _, ok := err.(*TestFailureError); !ok {
+		t.Fatalf("Expected a test failure for delete, got %v", err)
+	}
+
+	want := "1/2\n1 read allowed PASS [arn:aws:s3:::a/*,arn:aws:s3:::b/*] bucket.json:AllowRead:3\n2 delete allowed FAIL [arn:aws:s3:::a/*] bucket.json:AllowRead:3\n"
+	if stdout.String() != want {
+		t.Errorf("Unexpected template output:\n%s\nwant:\n%s", stdout.String(), want)
+	}
+	if !strings.Contains(stderr.String(), "Running 2 test(s)") {
+		t.Errorf("Human-readable output should move to stderr, got:\n%s", stderr.String())
+	}
+}
+
+func TestLoadReportTemplateInvalid(t *testing.T) {
+	tplPath := filepath.Join(t.TempDir(), "bad.tmpl")
+	if err := os.WriteFile(tplPath, []byte("{{ .Tests "), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadReportTemplate(tplPath); err == nil || !strings.Contains(err.Error(), "invalid --template-file") {
+		t.Errorf("Expected parse error, got %v", err)
+	}
+}
+
+func TestExampleReportTemplates(t *testing.T) {
+	paths, err := filepath.Glob("../examples/templates/*.tmpl")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("Expected example templates, got %v (err %v)", paths, err)
+	}
+	data := ReportData{
+		Scenario: "scenarios/s3.yml",
+		Tests: []ReportTest{
+			{Number: 1, Name: "read", Action: "s3:GetObject", Resources: []string{"*"}, Expect: "allowed", Decision: "allowed", Passed: true, Matched: []ReportMatch{{Sid: "AllowRead"}}},
+			{Number: 2, Name: "delete", Action: "s3:DeleteObject", Resources: []string{"*"}, Expect: "implicitDeny", Decision: "allowed", Reason: "read-only role"},
+		},
+		Summary: ReportSummary{Total: 2, Passed: 1, Failed: 1},
+	}
+	for _, path := range paths {
+		tpl, err := loadReportTemplate(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		var out strings.Builder
+		if err := tpl.Execute(&out, data); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+		if !strings.Contains(out.String(), "delete") {
+			t.Errorf("%s: expected test names in output, got:\n%s", path, out.String())
+		}
+	}
+}
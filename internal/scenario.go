@@ -1,18 +1,112 @@
 package internal
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
 	"gopkg.in/yaml.v3"
 )
 
+// StrictYAML makes LoadYAML reject keys that don't map to a struct field (set by --strict-yaml)
+// Lenient parsing stays the default so existing scenarios with extra keys keep working
+var StrictYAML bool
+
+// RenderScenarios renders every scenario file through text/template before parsing (set by --render-scenario)
+// Files whose first line is ScenarioTemplateMarker are rendered without the flag
+var RenderScenarios bool
+
+// ScenarioTemplateMarker opts a single scenario file into rendering when it is the file's first line
+const ScenarioTemplateMarker = "# politest:template"
+
+// varsFileLine finds a literal top-level vars_file in a scenario that can't be parsed until it is rendered
+var varsFileLine = regexp.MustCompile(`(?m)^vars_file:[ \t]*["']?([^"'#\r\n]+?)["']?[ \t]*(?:#.*)?$`)
+
+// ScenarioMetadata is a flat map of free-form scenario annotations such as owner or ticket
+type ScenarioMetadata map[string]string
+
+// UnmarshalYAML accepts only scalar values so metadata stays simple to embed in reports
+func (m *ScenarioMetadata) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: metadata must be a map of key: value pairs", value.Line)
+	}
+	out := make(ScenarioMetadata, len(value.Content)/2)
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key, val := value.Content[i], value.Content[i+1]
+		if val.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %d: metadata.%s must be a string, not a nested structure", val.Line, key.Value)
+		}
+		out[key.Value] = val.Value
+	}
+	*m = out
+	return nil
+}
+
+// Values accepted by context_merge
+const (
+	ContextMergeReplace = "replace" // a child's context replaces the parent's (default)
+	ContextMergeAppend  = "append"  // a child's context is overlaid on the parent's by ContextKeyName
+)
+
+// isDecision reports whether s names an IAM simulation decision, ignoring case like expectation checks do
+func isDecision(s string) bool {
+	for _, d := range []types.PolicyEvaluationDecisionType{
+		types.PolicyEvaluationDecisionTypeAllowed,
+		types.PolicyEvaluationDecisionTypeExplicitDeny,
+		types.PolicyEvaluationDecisionTypeImplicitDeny,
+	} {
+		if strings.EqualFold(s, string(d)) {
+			return true
+		}
+	}
+	return false
+}
+
+// scenarioKeys are the top-level keys that make a YAML file a scenario: a tests or legacy actions block,
+// an allowed_actions_exactly check, or extends, which inherits its base's tests
+var scenarioKeys = []string{"tests", "actions", "allowed_actions_exactly", "extends"}
+
+// IsScenarioFile reports whether the YAML file at path is a scenario rather than a vars or policy-fragment file
+// A file that can't be read or parsed counts as a scenario, so running it reports the error instead of skipping it
+func IsScenarioFile(path string) bool {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return true
+	}
+	var top map[string]any
+	if err := yaml.Unmarshal(b, &top); err != nil {
+		return true
+	}
+	for _, key := range scenarioKeys {
+		if _, ok := top[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 // LoadScenarioWithExtends loads a scenario and recursively merges parent scenarios
 func LoadScenarioWithExtends(absPath string) (*Scenario, error) {
 	var s Scenario
-	if err := LoadYAML(absPath, &s); err != nil {
+	if err := loadScenarioFile(absPath, &s); err != nil {
 		return nil, err
 	}
+	if m := s.ContextMerge; m != "" && m != ContextMergeReplace && m != ContextMergeAppend {
+		return nil, fmt.Errorf("%s: context_merge must be %q or %q, got %q", absPath, ContextMergeReplace, ContextMergeAppend, m)
+	}
+	if d := s.DefaultExpect; d != "" && !isDecision(d) {
+		return nil, fmt.Errorf("%s: default_expect must be allowed, explicitDeny or implicitDeny, got %q", absPath, d)
+	}
+	s.origins = scenarioFieldOrigins(&s, absPath)
+	s.chain = []string{absPath}
 	if s.Extends == "" {
 		return &s, nil
 	}
@@ -24,21 +118,159 @@ func LoadScenarioWithExtends(absPath string) (*Scenario, error) {
 		return nil, err
 	}
 	merged := MergeScenario(*ps, s) // child overrides parent
+	merged.chain = append(append([]string{}, ps.chain...), absPath)
 	return &merged, nil
 }
 
+// ExtendsChain returns the absolute paths of the scenario and its extends parents, root parent first
+func (s *Scenario) ExtendsChain() []string {
+	return s.chain
+}
+
+// TestCount returns the number of tests as written, before actions, callers and truth tables are expanded
+// The legacy block counts one test per action and allowed_actions_exactly counts as one test
+func (s *Scenario) TestCount() int {
+	count := len(s.Tests) + len(s.Actions)
+	if hasExactActions(s) {
+		count++
+	}
+	return count
+}
+
 // MergeScenario merges two scenarios with child overriding parent
 func MergeScenario(a, b Scenario) Scenario {
 	// simple field-wise merge: b overrides a; maps deep-merged
 	out := a
+	out.Disabled = b.Disabled // disabled applies to the file that sets it, not to scenarios extending it
 	mergePolicyFields(&out, b)
 	mergeSliceFields(&out, b)
 	mergeMapFields(&out, b)
 	mergeResourcePolicyFields(&out, b)
 	mergeSimulationFields(&out, b)
+	out.origins = mergeOrigins(a.origins, b.origins, &out)
 	return out
 }
 
+// scenarioFieldOrigins attributes every field set in s to path
+// Map fields (vars, expect, metadata) are tracked per key as "<field>.<key>"; extends is not tracked
+func scenarioFieldOrigins(s *Scenario, path string) map[string]string {
+	origins := map[string]string{}
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := yamlFieldName(v.Type().Field(i))
+		field := v.Field(i)
+		if name == "" || name == "extends" || field.IsZero() {
+			continue
+		}
+		if field.Kind() == reflect.Map {
+			for _, k := range field.MapKeys() {
+				origins[name+"."+k.String()] = path
+			}
+			continue
+		}
+		origins[name] = path
+	}
+	return origins
+}
+
+// mergeOrigins attributes each field still set after a merge to the child if it set it, else the parent
+// Fields cleared by the merge (e.g. policy_json replaced by a child's policy_template) drop out
+func mergeOrigins(parent, child map[string]string, merged *Scenario) map[string]string {
+	if parent == nil && child == nil {
+		return nil
+	}
+	present := scenarioFieldOrigins(merged, "")
+	out := make(map[string]string, len(present))
+	for key := range present {
+		if src, ok := child[key]; ok {
+			out[key] = src
+		} else {
+			out[key] = parent[key]
+		}
+	}
+	return out
+}
+
+// yamlFieldName returns the YAML key of a struct field, or "" for unexported fields
+func yamlFieldName(f reflect.StructField) string {
+	tag, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	return tag
+}
+
+// PrintMergeExplanation writes the resolved scenario with the file that set each field (--explain-merge)
+// Paths are shown relative to the scenario's directory
+func PrintMergeExplanation(w io.Writer, s *Scenario) {
+	base := ""
+	if len(s.chain) > 0 {
+		base = filepath.Dir(s.chain[len(s.chain)-1])
+	}
+	rel := func(p string) string {
+		if r, err := filepath.Rel(base, p); err == nil && base != "" {
+			return r
+		}
+		return p
+	}
+
+	chain := make([]string, len(s.chain))
+	for i, p := range s.chain {
+		chain[i] = rel(p)
+	}
+	fmt.Fprintf(w, "Resolved scenario (extends chain: %s)\n", strings.Join(chain, " -> "))
+
+	type line struct{ field, value, origin string }
+	var lines []line
+	width := 0
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := yamlFieldName(v.Type().Field(i))
+		field := v.Field(i)
+		if name == "" || name == "extends" || field.IsZero() {
+			continue
+		}
+		if field.Kind() == reflect.Map {
+			keys := make([]string, 0, field.Len())
+			for _, k := range field.MapKeys() {
+				keys = append(keys, k.String())
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				key := name + "." + k
+				lines = append(lines, line{key, fmt.Sprintf("%v", field.MapIndex(reflect.ValueOf(k)).Interface()), s.origins[key]})
+			}
+			continue
+		}
+		lines = append(lines, line{name, formatMergedValue(field.Interface()), s.origins[name]})
+	}
+
+	for _, l := range lines {
+		if n := len(l.field) + len(l.value); n > width {
+			width = n
+		}
+	}
+	for _, l := range lines {
+		fmt.Fprintf(w, "  %s: %-*s  # %s\n", l.field, width-len(l.field), l.value, IfEmpty(rel(l.origin), "(unknown)"))
+	}
+}
+
+// formatMergedValue renders one resolved field for --explain-merge
+// Lists of tests and context entries are summarised rather than printed in full
+func formatMergedValue(v any) string {
+	switch val := v.(type) {
+	case []string:
+		return "[" + strings.Join(val, ", ") + "]"
+	case []TestCase:
+		return fmt.Sprintf("%d test(s)", len(val))
+	case []ContextEntryYml:
+		keys := make([]string, len(val))
+		for i, c := range val {
+			keys[i] = c.ContextKeyName
+		}
+		return "[" + strings.Join(keys, ", ") + "]"
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
 // mergePolicyFields merges policy-related fields from b into out
 func mergePolicyFields(out *Scenario, b Scenario) {
 	if b.VarsFile != "" {
@@ -52,19 +284,51 @@ func mergePolicyFields(out *Scenario, b Scenario) {
 		out.PolicyJSON = b.PolicyJSON
 		out.PolicyTemplate = ""
 	}
+	if len(b.PolicyPaths) > 0 {
+		out.PolicyPaths = b.PolicyPaths
+	}
 	if len(b.SCPPaths) > 0 {
 		out.SCPPaths = b.SCPPaths
 	}
+	if b.ExpectationsFile != "" {
+		out.ExpectationsFile = b.ExpectationsFile
+	}
+	if b.DefaultExpect != "" {
+		out.DefaultExpect = b.DefaultExpect
+	}
+	if b.PermissionsBoundary != "" {
+		out.PermissionsBoundary = b.PermissionsBoundary
+	}
 }
 
 // mergeSliceFields merges slice-based fields from b into out
+// context_merge is inherited, so setting append on a base applies it to every scenario extending it
 func mergeSliceFields(out *Scenario, b Scenario) {
+	if b.ContextMerge != "" {
+		out.ContextMerge = b.ContextMerge
+	}
 	if len(b.Context) > 0 {
-		out.Context = b.Context
+		if out.ContextMerge == ContextMergeAppend {
+			out.Context = overlayContextEntries(out.Context, b.Context)
+		} else {
+			out.Context = b.Context
+		}
 	}
 	if len(b.Tests) > 0 {
 		out.Tests = b.Tests
 	}
+	if len(b.Actions) > 0 {
+		out.Actions = b.Actions
+	}
+	if len(b.Resources) > 0 {
+		out.Resources = b.Resources
+	}
+	if len(b.AllowedActionsExactly) > 0 {
+		out.AllowedActionsExactly = b.AllowedActionsExactly
+	}
+	if len(b.CandidateActions) > 0 {
+		out.CandidateActions = b.CandidateActions
+	}
 }
 
 // mergeMapFields merges map-based fields from b into out
@@ -75,6 +339,56 @@ func mergeMapFields(out *Scenario, b Scenario) {
 	for k, v := range b.Vars {
 		out.Vars[k] = v
 	}
+	if len(b.ResourceSets) > 0 {
+		merged := make(map[string][]string, len(out.ResourceSets)+len(b.ResourceSets))
+		for k, v := range out.ResourceSets {
+			merged[k] = v
+		}
+		for k, v := range b.ResourceSets {
+			merged[k] = v
+		}
+		out.ResourceSets = merged
+	}
+	if len(b.Groups) > 0 {
+		merged := make(map[string]TestGroup, len(out.Groups)+len(b.Groups))
+		for k, v := range out.Groups {
+			merged[k] = v
+		}
+		for k, v := range b.Groups {
+			merged[k] = v
+		}
+		out.Groups = merged
+	}
+	if len(b.Matrix) > 0 {
+		merged := make(map[string][]any, len(out.Matrix)+len(b.Matrix))
+		for k, v := range out.Matrix {
+			merged[k] = v
+		}
+		for k, v := range b.Matrix {
+			merged[k] = v
+		}
+		out.Matrix = merged
+	}
+	if len(b.Metadata) > 0 {
+		merged := make(ScenarioMetadata, len(out.Metadata)+len(b.Metadata))
+		for k, v := range out.Metadata {
+			merged[k] = v
+		}
+		for k, v := range b.Metadata {
+			merged[k] = v
+		}
+		out.Metadata = merged
+	}
+	if len(b.Expect) > 0 {
+		merged := make(map[string]string, len(out.Expect)+len(b.Expect))
+		for k, v := range out.Expect {
+			merged[k] = v
+		}
+		for k, v := range b.Expect {
+			merged[k] = v
+		}
+		out.Expect = merged
+	}
 }
 
 // mergeResourcePolicyFields merges resource policy fields from b into out
@@ -91,6 +405,9 @@ func mergeResourcePolicyFields(out *Scenario, b Scenario) {
 
 // mergeSimulationFields merges simulation-related fields from b into out
 func mergeSimulationFields(out *Scenario, b Scenario) {
+	if b.BoundaryOnly {
+		out.BoundaryOnly = true
+	}
 	if b.CallerArn != "" {
 		out.CallerArn = b.CallerArn
 	}
@@ -100,6 +417,12 @@ func mergeSimulationFields(out *Scenario, b Scenario) {
 	if b.ResourceHandlingOption != "" {
 		out.ResourceHandlingOption = b.ResourceHandlingOption
 	}
+	if b.ServicePrincipal != "" {
+		out.ServicePrincipal = b.ServicePrincipal
+	}
+	if b.Region != "" {
+		out.Region = b.Region
+	}
 }
 
 // LoadYAML loads and unmarshals a YAML file
@@ -108,5 +431,82 @@ func LoadYAML(path string, v any) error {
 	if err != nil {
 		return err
 	}
-	return yaml.Unmarshal(b, v)
+	return decodeYAML(path, b, v)
+}
+
+// loadScenarioFile reads one scenario file, rendering it first when it is templated
+// Each file in an extends chain is rendered on its own, before parsing and before extends are merged
+func loadScenarioFile(path string, s *Scenario) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if RenderScenarios || bytes.HasPrefix(b, []byte(ScenarioTemplateMarker)) {
+		if b, err = renderScenarioTemplate(path, b); err != nil {
+			return err
+		}
+	}
+	return decodeYAML(path, b, s)
+}
+
+// renderScenarioTemplate renders a scenario file through text/template with the variables of its vars_file
+// vars_file must be a literal top-level line, since the rest of the file isn't valid YAML until rendered;
+// inline vars are not available here, only later when tests run
+func renderScenarioTemplate(path string, content []byte) ([]byte, error) {
+	vars := map[string]any{}
+	if m := varsFileLine.FindSubmatch(content); m != nil {
+		if err := LoadYAML(MustAbsJoin(filepath.Dir(path), string(m[1])), &vars); err != nil {
+			return nil, fmt.Errorf("rendering scenario %s: %v", path, err)
+		}
+	}
+	rendered, err := RenderJSONPlaceholders(path, content, vars)
+	if err != nil {
+		return nil, fmt.Errorf("rendering scenario %s: %v", path, err)
+	}
+	return rendered, nil
+}
+
+// decodeYAML unmarshals YAML content, rejecting unknown keys with StrictYAML
+func decodeYAML(path string, b []byte, v any) error {
+	if !StrictYAML {
+		if err := yaml.Unmarshal(b, v); err != nil {
+			return &YAMLError{Path: path, Err: err}
+		}
+		return nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return &YAMLError{Path: path, Err: err}
+	}
+	return nil
+}
+
+// ApplyExpectationsFile sets expect on each test named in an expectations file (test name -> decision)
+// The file wins over a test's own expect so expectations can be owned apart from the scenario.
+// Names that match no test are an error, to catch typos and renamed tests
+func ApplyExpectationsFile(s *Scenario, path string) error {
+	expectations := map[string]string{}
+	if err := LoadYAML(path, &expectations); err != nil {
+		return fmt.Errorf("expectations_file %s: %v", path, err)
+	}
+	matched := map[string]bool{}
+	for i, test := range s.Tests {
+		if decision, ok := expectations[test.Name]; ok && test.Name != "" {
+			s.Tests[i].Expect = decision
+			s.Tests[i].ExpectIf = nil // the file wins over conditional expectations too
+			matched[test.Name] = true
+		}
+	}
+	var unknown []string
+	for name := range expectations {
+		if !matched[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("expectations_file %s: no test named %s", path, strings.Join(unknown, ", "))
+	}
+	return nil
 }
@@ -1,8 +1,11 @@
 package internal
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -127,6 +130,47 @@ tests:
 			t.Error("LoadYAML() expected error for nonexistent file, got nil")
 		}
 	})
+
+	t.Run("strict mode rejects unknown fields", func(t *testing.T) {
+		original := StrictYAML
+		defer func() { StrictYAML = original }()
+
+		file := filepath.Join(tmpDir, "typo.yml")
+		content := "policy_json: policy.json\ntets:\n  - action: s3:GetObject\n"
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var lenient Scenario
+		if err := LoadYAML(file, &lenient); err != nil {
+			t.Errorf("LoadYAML() lenient error = %v", err)
+		}
+
+		StrictYAML = true
+		var strict Scenario
+		err := LoadYAML(file, &strict)
+		if err == nil {
+			t.Fatal("LoadYAML() expected error for unknown field in strict mode, got nil")
+		}
+		if !strings.Contains(err.Error(), "tets") || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("LoadYAML() error should name the field and line, got: %v", err)
+		}
+	})
+
+	t.Run("strict mode accepts empty file", func(t *testing.T) {
+		original := StrictYAML
+		defer func() { StrictYAML = original }()
+		StrictYAML = true
+
+		file := filepath.Join(tmpDir, "empty.yml")
+		if err := os.WriteFile(file, []byte(""), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var result Scenario
+		if err := LoadYAML(file, &result); err != nil {
+			t.Errorf("LoadYAML() error = %v", err)
+		}
+	})
 }
 
 func TestLoadScenarioWithExtends(t *testing.T) {
@@ -290,6 +334,64 @@ func TestMergeScenarioComprehensive(t *testing.T) {
 	})
 }
 
+func TestPrintMergeExplanation(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"base.yml": `
+policy_json: policy.json
+caller_arn: arn:aws:iam::111111111111:role/base
+vars:
+  env: dev
+  region: us-east-1
+`,
+		"team.yml": `
+extends: base.yml
+caller_arn: arn:aws:iam::111111111111:role/team
+`,
+		"app.yml": `
+extends: team.yml
+policy_template: policy.json.tmpl
+vars:
+  env: prod
+tests:
+  - action: s3:GetObject
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scen, err := LoadScenarioWithExtends(filepath.Join(tmpDir, "app.yml"))
+	if err != nil {
+		t.Fatalf("LoadScenarioWithExtends() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	PrintMergeExplanation(&out, scen)
+	got := out.String()
+
+	if !strings.Contains(got, "extends chain: base.yml -> team.yml -> app.yml") {
+		t.Errorf("Expected the extends chain, got:\n%s", got)
+	}
+	for field, origin := range map[string]string{
+		"caller_arn: arn:aws:iam::111111111111:role/team": "team.yml",
+		"vars.env: prod":                    "app.yml",
+		"vars.region: us-east-1":            "base.yml",
+		"policy_template: policy.json.tmpl": "app.yml",
+		"tests: 1 test(s)":                  "app.yml",
+	} {
+		if !regexp.MustCompile(regexp.QuoteMeta(field) + ` +# ` + regexp.QuoteMeta(origin) + "\n").MatchString(got) {
+			t.Errorf("Expected %q attributed to %s, got:\n%s", field, origin, got)
+		}
+	}
+	// policy_json was replaced by the child's policy_template, so it is no longer part of the result
+	if strings.Contains(got, "policy_json") {
+		t.Errorf("Cleared field should not be listed, got:\n%s", got)
+	}
+}
+
 func TestLoadScenarioWithExtendsMultipleLevels(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -399,6 +501,24 @@ func TestMergeScenarioWithTests(t *testing.T) {
 	}
 }
 
+func TestMergeScenarioWithLegacyBlock(t *testing.T) {
+	parent := Scenario{
+		Actions:   []string{"s3:GetObject"},
+		Resources: []string{"arn:aws:s3:::parent/*"},
+	}
+	child := Scenario{Resources: []string{"arn:aws:s3:::child/*"}}
+
+	result := MergeScenario(parent, child)
+
+	// Each list is inherited unless the child sets it
+	if len(result.Actions) != 1 || result.Actions[0] != "s3:GetObject" {
+		t.Errorf("Expected inherited legacy actions, got %v", result.Actions)
+	}
+	if len(result.Resources) != 1 || result.Resources[0] != "arn:aws:s3:::child/*" {
+		t.Errorf("Expected child legacy resources, got %v", result.Resources)
+	}
+}
+
 func TestMergeScenarioWithCallerArn(t *testing.T) {
 	parent := Scenario{
 		CallerArn: "arn:aws:iam::123456789012:user/parent",
@@ -444,6 +564,21 @@ func TestMergeScenarioWithResourceHandlingOption(t *testing.T) {
 	}
 }
 
+func TestMergeScenarioWithServicePrincipal(t *testing.T) {
+	parent := Scenario{
+		ServicePrincipal: "lambda.amazonaws.com",
+	}
+	child := Scenario{
+		ServicePrincipal: "events.amazonaws.com",
+	}
+
+	result := MergeScenario(parent, child)
+
+	if result.ServicePrincipal != "events.amazonaws.com" {
+		t.Errorf("Expected child ServicePrincipal, got %s", result.ServicePrincipal)
+	}
+}
+
 func TestMergeScenarioWithContext(t *testing.T) {
 	parent := Scenario{
 		Context: []ContextEntryYml{
@@ -467,6 +602,104 @@ func TestMergeScenarioWithContext(t *testing.T) {
 	}
 }
 
+func TestLoadScenarioWithExtendsContextMergeAppend(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"base.yml": `
+context_merge: append
+context:
+  - ContextKeyName: aws:PrincipalTag/team
+    ContextKeyType: string
+    ContextKeyValues: ["platform"]
+  - ContextKeyName: aws:SecureTransport
+    ContextKeyType: boolean
+    ContextKeyValues: ["true"]
+`,
+		"middle.yml": `
+extends: base.yml
+context:
+  - ContextKeyName: aws:PrincipalTag/team
+    ContextKeyType: string
+    ContextKeyValues: ["data"]
+`,
+		"child.yml": `
+extends: middle.yml
+context:
+  - ContextKeyName: aws:RequestedRegion
+    ContextKeyType: string
+    ContextKeyValues: ["eu-west-1"]
+`,
+		"replace.yml": `
+extends: base.yml
+context_merge: replace
+context:
+  - ContextKeyName: aws:RequestedRegion
+    ContextKeyType: string
+    ContextKeyValues: ["eu-west-1"]
+`,
+		"invalid.yml": "context_merge: merge\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	contextSummary := func(s *Scenario) string {
+		var parts []string
+		for _, c := range s.Context {
+			parts = append(parts, c.ContextKeyName+"="+strings.Join(c.ContextKeyValues, ","))
+		}
+		return strings.Join(parts, " ")
+	}
+
+	// The base opts in, so append applies down the chain; same keys are overridden in place of the parent's
+	child, err := LoadScenarioWithExtends(filepath.Join(tmpDir, "child.yml"))
+	if err != nil {
+		t.Fatalf("LoadScenarioWithExtends() error = %v", err)
+	}
+	if got, want := contextSummary(child), "aws:SecureTransport=true aws:PrincipalTag/team=data aws:RequestedRegion=eu-west-1"; got != want {
+		t.Errorf("Merged context = %q, want %q", got, want)
+	}
+
+	replaced, err := LoadScenarioWithExtends(filepath.Join(tmpDir, "replace.yml"))
+	if err != nil {
+		t.Fatalf("LoadScenarioWithExtends() error = %v", err)
+	}
+	if got, want := contextSummary(replaced), "aws:RequestedRegion=eu-west-1"; got != want {
+		t.Errorf("Replaced context = %q, want %q", got, want)
+	}
+
+	if _, err := LoadScenarioWithExtends(filepath.Join(tmpDir, "invalid.yml")); err == nil || !strings.Contains(err.Error(), "context_merge") {
+		t.Errorf("Expected invalid context_merge to be rejected, got %v", err)
+	}
+}
+
+func TestLoadScenarioWithExtendsDefaultExpect(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"base.yml":    "default_expect: allowed\n",
+		"child.yml":   "extends: base.yml\n",
+		"invalid.yml": "default_expect: deny\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	child, err := LoadScenarioWithExtends(filepath.Join(tmpDir, "child.yml"))
+	if err != nil {
+		t.Fatalf("LoadScenarioWithExtends() error = %v", err)
+	}
+	if child.DefaultExpect != "allowed" {
+		t.Errorf("DefaultExpect = %q, want inherited %q", child.DefaultExpect, "allowed")
+	}
+	if _, err := LoadScenarioWithExtends(filepath.Join(tmpDir, "invalid.yml")); err == nil || !strings.Contains(err.Error(), "default_expect") {
+		t.Errorf("Expected invalid default_expect to be rejected, got %v", err)
+	}
+}
+
 func TestMergeScenarioWithResourcePolicyTemplate(t *testing.T) {
 	parent := Scenario{
 		ResourcePolicyJSON: "parent.json",
@@ -540,3 +773,155 @@ func TestMergeScenarioVarsInitialization(t *testing.T) {
 		t.Error("Child var should be present")
 	}
 }
+
+func TestMergeScenarioWithExpectMap(t *testing.T) {
+	parent := Scenario{
+		Expect: map[string]string{"s3:GetObject": "allowed", "s3:PutObject": "allowed"},
+	}
+	child := Scenario{
+		Expect: map[string]string{"s3:PutObject": "implicitDeny"},
+	}
+
+	result := MergeScenario(parent, child)
+
+	if result.Expect["s3:GetObject"] != "allowed" {
+		t.Errorf("Expected parent expectation to be kept, got %s", result.Expect["s3:GetObject"])
+	}
+	if result.Expect["s3:PutObject"] != "implicitDeny" {
+		t.Errorf("Expected child expectation to override, got %s", result.Expect["s3:PutObject"])
+	}
+	if parent.Expect["s3:PutObject"] != "allowed" {
+		t.Errorf("Parent expect map should not be mutated, got %s", parent.Expect["s3:PutObject"])
+	}
+}
+
+func TestMergeScenarioDisabledNotInherited(t *testing.T) {
+	parent := Scenario{Disabled: true}
+	child := Scenario{}
+
+	if result := MergeScenario(parent, child); result.Disabled {
+		t.Error("Expected child of a disabled parent to be enabled")
+	}
+	if result := MergeScenario(Scenario{}, Scenario{Disabled: true}); !result.Disabled {
+		t.Error("Expected disabled child to stay disabled")
+	}
+}
+
+func TestScenarioMetadata(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	parentFile := filepath.Join(tmpDir, "parent.yml")
+	if err := os.WriteFile(parentFile, []byte("metadata:\n  owner: platform\n  compliance: CIS-1.16\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	childFile := filepath.Join(tmpDir, "child.yml")
+	if err := os.WriteFile(childFile, []byte("extends: parent.yml\nmetadata:\n  owner: payments\n  ticket: 1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scen, err := LoadScenarioWithExtends(childFile)
+	if err != nil {
+		t.Fatalf("LoadScenarioWithExtends() error = %v", err)
+	}
+	want := map[string]string{"owner": "payments", "compliance": "CIS-1.16", "ticket": "1234"}
+	if len(scen.Metadata) != len(want) {
+		t.Fatalf("Metadata = %v, want %v", scen.Metadata, want)
+	}
+	for k, v := range want {
+		if scen.Metadata[k] != v {
+			t.Errorf("Metadata[%q] = %q, want %q", k, scen.Metadata[k], v)
+		}
+	}
+
+	nestedFile := filepath.Join(tmpDir, "nested.yml")
+	if err := os.WriteFile(nestedFile, []byte("metadata:\n  owner:\n    team: platform\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var nested Scenario
+	err = LoadYAML(nestedFile, &nested)
+	if err == nil || !strings.Contains(err.Error(), "metadata.owner must be a string") {
+		t.Errorf("Expected nested metadata error, got: %v", err)
+	}
+}
+
+func TestApplyExpectationsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "expectations.yml")
+	if err := os.WriteFile(path, []byte("read objects: allowed\ndelete objects: explicitDeny\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scen := &Scenario{Tests: []TestCase{
+		{Name: "read objects", Action: "s3:GetObject", Expect: "implicitDeny"},
+		{Name: "delete objects", Action: "s3:DeleteObject"},
+		{Name: "list bucket", Action: "s3:ListBucket", Expect: "allowed"},
+	}}
+	if err := ApplyExpectationsFile(scen, path); err != nil {
+		t.Fatalf("ApplyExpectationsFile() error = %v", err)
+	}
+	for i, want := range []string{"allowed", "explicitDeny", "allowed"} {
+		if got := scen.Tests[i].Expect; got != want {
+			t.Errorf("Tests[%d].Expect = %q, want %q", i, got, want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("read objects: allowed\nrenamed test: allowed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := ApplyExpectationsFile(scen, path)
+	if err == nil || !strings.Contains(err.Error(), "no test named renamed test") {
+		t.Errorf("ApplyExpectationsFile() error = %v, want unknown test name error", err)
+	}
+
+	if err := ApplyExpectationsFile(scen, filepath.Join(dir, "missing.yml")); err == nil {
+		t.Error("ApplyExpectationsFile() expected error for missing file")
+	}
+}
+
+func TestLoadScenarioWithExtendsTemplated(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"vars.yml": "buckets: [logs, data]\n",
+		"base.yml": `caller_arn: 'arn:aws:iam::123456789012:role/{{"{{.role}}"}}'` + "\n",
+		"scenario.yml": ScenarioTemplateMarker + `
+vars_file: "vars.yml" # bucket names
+extends: "base.yml"
+tests:
+{{- range .buckets}}
+  - name: "read {{.}}"
+    resource: "arn:aws:s3:::{{.}}/*"
+{{- end}}
+`,
+		"missing.yml": ScenarioTemplateMarker + "\ntests:\n  - name: \"{{.nope}}\"\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scen, err := LoadScenarioWithExtends(filepath.Join(dir, "scenario.yml"))
+	if err != nil {
+		t.Fatalf("LoadScenarioWithExtends() error = %v", err)
+	}
+	if len(scen.Tests) != 2 || scen.Tests[1].Resource != "arn:aws:s3:::data/*" {
+		t.Errorf("Expected one test per bucket, got %+v", scen.Tests)
+	}
+	// The parent has no marker, so its placeholder (escaped or not) is left as written
+	if scen.CallerArn != `arn:aws:iam::123456789012:role/{{"{{.role}}"}}` {
+		t.Errorf("Unmarked parent should not be rendered, got %q", scen.CallerArn)
+	}
+
+	RenderScenarios = true
+	defer func() { RenderScenarios = false }()
+	scen, err = LoadScenarioWithExtends(filepath.Join(dir, "scenario.yml"))
+	if err != nil {
+		t.Fatalf("LoadScenarioWithExtends() with RenderScenarios error = %v", err)
+	}
+	if scen.CallerArn != "arn:aws:iam::123456789012:role/{{.role}}" {
+		t.Errorf("Escaped placeholder should survive rendering, got %q", scen.CallerArn)
+	}
+
+	if _, err := LoadScenarioWithExtends(filepath.Join(dir, "missing.yml")); err == nil || !strings.Contains(err.Error(), "rendering scenario") {
+		t.Errorf("Expected a render error for an unknown variable, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+//go:embed selftest/*
+var selfTestFiles embed.FS
+
+// SelfTestScenario is the file name of the embedded example scenario run by `politest selftest`
+const SelfTestScenario = "scenario.yml"
+
+// WriteSelfTestFiles copies the embedded example scenario and its policy into dir
+// They go through the normal loader from disk so source tracking sees real file lines
+func WriteSelfTestFiles(dir string) error {
+	entries, err := selfTestFiles.ReadDir("selftest")
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		b, err := selfTestFiles.ReadFile("selftest/" + e.Name())
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, e.Name()), b, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SelfTestSimulator is a fake IAMSimulator that evaluates identity policies locally for `politest selftest`
+// It understands Allow/Deny with Action/Resource wildcards and Bool/StringEquals conditions, which is
+// enough for the embedded example; it is not a general policy evaluator
+type SelfTestSimulator struct {
+	Calls []*iam.SimulateCustomPolicyInput // every request, in order
+}
+
+// SimulateCustomPolicy evaluates each requested action against the first resource
+func (s *SelfTestSimulator) SimulateCustomPolicy(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+	s.Calls = append(s.Calls, params)
+	resource := "*"
+	if len(params.ResourceArns) > 0 {
+		resource = params.ResourceArns[0]
+	}
+
+	out := &iam.SimulateCustomPolicyOutput{}
+	for _, action := range params.ActionNames {
+		result := types.EvaluationResult{
+			EvalActionName:   aws.String(action),
+			EvalResourceName: aws.String(resource),
+			EvalDecision:     types.PolicyEvaluationDecisionTypeImplicitDeny,
+		}
+		// Like AWS, an explicit deny reports only the Deny statements that matched
+		matched := map[string][]types.Statement{}
+		for i, doc := range params.PolicyInputList {
+			for _, stmt := range selfTestStatements(doc) {
+				if !stmt.matches(action, resource, params.ContextEntries) {
+					continue
+				}
+				effect, _ := stmt.fields["Effect"].(string)
+				matched[effect] = append(matched[effect], types.Statement{
+					SourcePolicyId:   aws.String(fmt.Sprintf("PolicyInputList.%d", i+1)),
+					SourcePolicyType: types.PolicySourceTypeUser,
+					StartPosition:    stmt.start,
+					EndPosition:      stmt.end,
+				})
+			}
+		}
+		switch {
+		case len(matched["Deny"]) > 0:
+			result.EvalDecision = types.PolicyEvaluationDecisionTypeExplicitDeny
+			result.MatchedStatements = matched["Deny"]
+		case len(matched["Allow"]) > 0:
+			result.EvalDecision = types.PolicyEvaluationDecisionTypeAllowed
+			result.MatchedStatements = matched["Allow"]
+		}
+		out.EvaluationResults = append(out.EvaluationResults, result)
+	}
+	return out, nil
+}
+
+// selfTestStatement is one statement of a submitted policy with its position in the document
+type selfTestStatement struct {
+	fields     map[string]any
+	start, end *types.Position
+}
+
+// selfTestStatements parses a policy's Statement array, recording where each element starts and ends
+// the way SimulateCustomPolicy reports positions (1-based line and column)
+func selfTestStatements(policyJSON string) []selfTestStatement {
+	dec := json.NewDecoder(strings.NewReader(policyJSON))
+	if !seekStatementArray(dec) {
+		return nil
+	}
+	var statements []selfTestStatement
+	for dec.More() {
+		begin := int(dec.InputOffset())
+		var fields map[string]any
+		if err := dec.Decode(&fields); err != nil {
+			return statements
+		}
+		statements = append(statements, selfTestStatement{
+			fields: fields,
+			start:  offsetPosition(policyJSON, begin),
+			end:    offsetPosition(policyJSON, int(dec.InputOffset())),
+		})
+	}
+	return statements
+}
+
+// offsetPosition converts a byte offset into a 1-based line and column
+func offsetPosition(s string, offset int) *types.Position {
+	lineStart := strings.LastIndex(s[:offset], "\n") + 1
+	return &types.Position{Line: int32(strings.Count(s[:offset], "\n") + 1), Column: int32(offset - lineStart + 1)}
+}
+
+// matches reports whether the statement covers the action and resource and its conditions hold
+func (s selfTestStatement) matches(action, resource string, ctxEntries []types.ContextEntry) bool {
+	if !anyWildcardMatch(stringOrList(s.fields["Action"]), action, true) || !anyWildcardMatch(stringOrList(s.fields["Resource"]), resource, false) {
+		return false
+	}
+	conditions, _ := s.fields["Condition"].(map[string]any)
+	for operator, block := range conditions {
+		if operator != "Bool" && operator != "StringEquals" {
+			return false
+		}
+		keys, _ := block.(map[string]any)
+		for key, want := range keys {
+			if !contextHasValue(ctxEntries, key, stringOrList(want)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// anyWildcardMatch reports whether any of the IAM patterns matches s
+func anyWildcardMatch(patterns []string, s string, ignoreCase bool) bool {
+	for _, p := range patterns {
+		if wildcardMatch(p, s, ignoreCase) {
+			return true
+		}
+	}
+	return false
+}
+
+// contextHasValue reports whether the context key is present with any of the wanted values
+func contextHasValue(ctxEntries []types.ContextEntry, key string, want []string) bool {
+	for _, e := range ctxEntries {
+		if !strings.EqualFold(AwsString(e.ContextKeyName), key) {
+			continue
+		}
+		for _, v := range e.ContextKeyValues {
+			for _, w := range want {
+				if strings.EqualFold(v, w) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// SelfTestChecks turns a selftest run of the embedded scenario into report lines covering test expansion,
+// context merge, expectation evaluation and source mapping. output is what RunTests printed
+func SelfTestChecks(sim *SelfTestSimulator, output string, runErr error) []DoctorResult {
+	expansion := DoctorResult{Name: "Test expansion", Critical: true}
+	if len(sim.Calls) == 4 {
+		expansion.OK = true
+		expansion.Detail = "3 test definitions expanded to 4 simulations"
+	} else {
+		expansion.Detail = fmt.Sprintf("expected 4 simulations from 3 test definitions, got %d", len(sim.Calls))
+	}
+
+	merge := DoctorResult{Name: "Context merge", Critical: true}
+	insecure := 0
+	for _, call := range sim.Calls {
+		if contextHasValue(call.ContextEntries, "aws:SecureTransport", []string{"false"}) {
+			insecure++
+		}
+	}
+	if insecure == 1 && len(sim.Calls) > 1 {
+		merge.OK = true
+		merge.Detail = "scenario context applied, overridden by a test's secure_transport shortcut"
+	} else {
+		merge.Detail = fmt.Sprintf("expected 1 simulation with aws:SecureTransport=false, got %d", insecure)
+	}
+
+	expectations := DoctorResult{Name: "Expectation evaluation", Critical: true}
+	if runErr == nil {
+		expectations.OK = true
+		expectations.Detail = "allowed, explicitDeny and implicitDeny expectations all passed"
+	} else {
+		expectations.Detail = runErr.Error()
+	}
+
+	sources := DoctorResult{Name: "Source map", Critical: true}
+	if strings.Contains(output, "(Sid: DenyInsecureTransport)") && strings.Contains(output, "policy.json:10-20") {
+		sources.OK = true
+		sources.Detail = "matched statement resolved to policy.json:10-20 (Sid DenyInsecureTransport)"
+	} else {
+		sources.Detail = "matched statement did not resolve to DenyInsecureTransport at policy.json:10-20"
+	}
+
+	return []DoctorResult{expansion, merge, expectations, sources}
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestSelfTestSimulator(t *testing.T) {
+	policy := `{
+  "Statement": [
+    {"Effect": "Allow", "Action": "s3:Get*", "Resource": "*"},
+    {"Effect": "Deny", "Action": "s3:GetObject", "Resource": "*", "Condition": {"StringEquals": {"aws:PrincipalTag/team": "blue"}}}
+  ]
+}`
+	sim := &SelfTestSimulator{}
+	simulate := func(action, team string) types.EvaluationResult {
+		t.Helper()
+		input := &iam.SimulateCustomPolicyInput{PolicyInputList: []string{policy}, ActionNames: []string{action}}
+		if team != "" {
+			input.ContextEntries = []types.ContextEntry{{ContextKeyName: aws.String("aws:PrincipalTag/team"), ContextKeyValues: []string{team}}}
+		}
+		out, err := sim.SimulateCustomPolicy(context.Background(), input)
+		if err != nil || len(out.EvaluationResults) != 1 {
+			t.Fatalf("SimulateCustomPolicy() = %v, %v", out, err)
+		}
+		return out.EvaluationResults[0]
+	}
+
+	if r := simulate("s3:GetObject", "red"); r.EvalDecision != types.PolicyEvaluationDecisionTypeAllowed {
+		t.Errorf("Expected allowed when the deny condition doesn't hold, got %s", r.EvalDecision)
+	}
+	r := simulate("s3:GetObject", "blue")
+	if r.EvalDecision != types.PolicyEvaluationDecisionTypeExplicitDeny || len(r.MatchedStatements) != 1 {
+		t.Fatalf("Expected explicitDeny with only the Deny statement matched, got %s %+v", r.EvalDecision, r.MatchedStatements)
+	}
+	stmt := extractStatementFromPolicy(policy, r.MatchedStatements[0].StartPosition, r.MatchedStatements[0].EndPosition)
+	if !strings.HasPrefix(stmt, `{"Effect": "Deny"`) || !strings.HasSuffix(stmt, "}}}") {
+		t.Errorf("Positions should span the Deny statement, got %q", stmt)
+	}
+	if r := simulate("s3:PutObject", ""); r.EvalDecision != types.PolicyEvaluationDecisionTypeImplicitDeny || len(r.MatchedStatements) != 0 {
+		t.Errorf("Expected implicitDeny with no matches, got %s %+v", r.EvalDecision, r.MatchedStatements)
+	}
+}
+
+func TestSelfTestChecksReportFailures(t *testing.T) {
+	results := SelfTestChecks(&SelfTestSimulator{}, "", errors.New("1 test(s) failed"))
+	for _, r := range results {
+		if r.OK {
+			t.Errorf("Expected %s to fail for an empty run", r.Name)
+		}
+	}
+	var out strings.Builder
+	if PrintSelfTestReport(&out, results) || !strings.Contains(out.String(), "Self-test failed") {
+		t.Errorf("Expected a failed report, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Severities accepted by a test's severity field and --fail-on-severity, most severe first
+var Severities = []string{"critical", "high", "medium", "low"}
+
+// validateSeverity checks a test's severity; empty is allowed and gates like critical
+func validateSeverity(severity string) error {
+	if severity != "" && !slices.Contains(Severities, severity) {
+		return fmt.Errorf("severity must be one of %s, got %q", strings.Join(Severities, ", "), severity)
+	}
+	return nil
+}
+
+// meetsSeverity reports whether a failure of the given severity fails the run under threshold
+// An empty threshold gates every failure, and a test without a severity always meets the threshold,
+// so gating never silently drops tests nobody has classified
+func meetsSeverity(severity, threshold string) bool {
+	if threshold == "" || severity == "" {
+		return true
+	}
+	return slices.Index(Severities, severity) <= slices.Index(Severities, threshold)
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+)
+
+func TestMeetsSeverity(t *testing.T) {
+	tests := []struct {
+		severity, threshold string
+		want                bool
+	}{
+		{"low", "", true},
+		{"critical", "high", true},
+		{"high", "high", true},
+		{"medium", "high", false},
+		{"low", "critical", false},
+		{"", "critical", true}, // unclassified tests always gate
+	}
+	for _, tt := range tests {
+		if got := meetsSeverity(tt.severity, tt.threshold); got != tt.want {
+			t.Errorf("meetsSeverity(%q, %q) = %v, want %v", tt.severity, tt.threshold, got, tt.want)
+		}
+	}
+}
+
+func TestRunTestsFailOnSeverity(t *testing.T) {
+	originalStdout := Stdout
+	defer func() { Stdout = originalStdout }()
+
+	mockClient := &mockIAMClient{
+		SimulateCustomPolicyFunc: func(ctx context.Context, params *iam.SimulateCustomPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulateCustomPolicyOutput, error) {
+			action := params.ActionNames[0]
+			return &iam.SimulateCustomPolicyOutput{
+				EvaluationResults: []types.EvaluationResult{{EvalActionName: &action, EvalDecision: types.PolicyEvaluationDecisionTypeImplicitDeny}},
+			}, nil
+		},
+	}
+	scen := &Scenario{Tests: []TestCase{
+		{Name: "audit log read", Action: "logs:GetLogEvents", Expect: "allowed", Severity: "low"},
+		{Name: "tag read", Action: "s3:GetObjectTagging", Expect: "allowed", Severity: "medium"},
+	}}
+
+	var stdout strings.Builder
+	Stdout = &stdout
+	if err := RunTests(mockClient, scen, SimulatorConfig{FailOnSeverity: "high", Variables: map[string]any{}}); err != nil {
+		t.Errorf("Expected failures below the threshold not to fail the run, got %v", err)
+	}
+	for _, want := range []string{"Severity: low", "Test Results: 0 passed, 2 failed", "2 failure(s) below --fail-on-severity high don't fail the run"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("Expected %q in output:\n%s", want, stdout.String())
+		}
+	}
+
+	scen.Tests = append(scen.Tests, TestCase{Name: "admin deny", Action: "iam:CreateUser", Expect: "allowed", Severity: "critical"})
+	stdout.Reset()
+	err := RunTests(mockClient, scen, SimulatorConfig{FailOnSeverity: "high", Variables: map[string]any{}})
+	var failure *TestFailureError
+	if !errors.As(err, &failure) || failure.Failed != 1 {
+		t.Errorf("Expected only the critical failure to fail the run, got %v", err)
+	}
+}
+
+func TestExpandTestsWithActionsInvalidSeverity(t *testing.T) {
+	_, err := expandTestsWithActions([]TestCase{{Name: "bad", Action: "s3:GetObject", Severity: "urgent"}})
+	if err == nil || !strings.Contains(err.Error(), "severity must be one of critical, high, medium, low") {
+		t.Errorf("Expected a severity validation error, got %v", err)
+	}
+}
@@ -1,12 +1,21 @@
 package internal
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/iam/types"
@@ -32,72 +41,366 @@ func extractMatchedStatements(matched []types.Statement) string {
 // saveResponseIfRequested saves the API response to a file if savePath is provided
 // Uses 0600 permissions to restrict access to the current user only, as the response
 // may contain internal resource names or account IDs
-func saveResponseIfRequested(savePath string, resp any) {
+func saveResponseIfRequested(savePath string, resp any) error {
 	if savePath != "" {
 		b, _ := json.MarshalIndent(resp, "", "  ")
-		Check(os.WriteFile(savePath, b, 0o600))
-		fmt.Printf("\nSaved raw response → %s (permissions: 0600)\n", savePath)
+		if err := os.WriteFile(savePath, b, 0o600); err != nil {
+			return err
+		}
+		fmt.Fprintf(Stdout, "\nSaved raw response → %s (permissions: 0600)\n", savePath)
+	}
+	return nil
+}
+
+// simulationRecord pairs a simulation input with its output for --save-full
+type simulationRecord struct {
+	Input  *iam.SimulateCustomPolicyInput  `json:"input"`
+	Output *iam.SimulateCustomPolicyOutput `json:"output"`
+}
+
+// saveFullIfRequested saves each test's simulation input and output to a file if savePath is provided
+// Uses 0600 permissions as inputs contain full policies, ARNs and context values
+func saveFullIfRequested(savePath string, results []testResult) error {
+	if savePath == "" {
+		return nil
+	}
+	records := make([]simulationRecord, 0, len(results))
+	for _, r := range results {
+		records = append(records, simulationRecord{Input: r.Input, Output: r.Response})
+	}
+	b, _ := json.MarshalIndent(records, "", "  ")
+	if err := os.WriteFile(savePath, b, 0o600); err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, "\nSaved simulation inputs and responses → %s (permissions: 0600)\n", savePath)
+	return nil
+}
+
+// saveTestResponseIfRequested writes one test's raw response to <saveDir>/<NNN>-<name>.json (--save-dir)
+// The number matches the [n/total] progress line; files use 0600 permissions like --save
+func saveTestResponseIfRequested(saveDir string, index int, testName string, resp *iam.SimulateCustomPolicyOutput) error {
+	if saveDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(saveDir, 0o700); err != nil {
+		return err
+	}
+	b, _ := json.MarshalIndent(resp, "", "  ")
+	name := fmt.Sprintf("%03d-%s.json", index+1, sanitizeFileName(testName))
+	return os.WriteFile(filepath.Join(saveDir, name), b, 0o600)
+}
+
+// sanitizeFileName reduces a test name to letters, digits, '.', '_' and '-', with other runs collapsed to '-'
+func sanitizeFileName(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	s := strings.Trim(b.String(), "-.")
+	if len(s) > 80 {
+		s = strings.TrimRight(s[:80], "-.")
+	}
+	if s == "" {
+		return "test"
 	}
+	return s
 }
 
+// BoundaryOnlyIdentityPolicy is the identity policy used with boundary_only: true
+const BoundaryOnlyIdentityPolicy = `{"Version":"2012-10-17","Statement":[{"Sid":"BoundaryOnlyAllowAll","Effect":"Allow","Action":"*","Resource":"*"}]}`
+
 // RunTestCollection executes policy simulation in test collection format
+// It exits via GlobalExiter on errors or failed expectations; use RunTests to handle them instead
 func RunTestCollection(client IAMSimulator, scen *Scenario, cfg SimulatorConfig) {
+	err := RunTests(client, scen, cfg)
+	if err == nil {
+		return
+	}
+	var failure *TestFailureError
+	if !errors.As(err, &failure) {
+		fmt.Fprintf(Stderr, "%v\n", err)
+	}
+	GlobalExiter.Exit(ExitCodeFor(err))
+}
+
+// RunTests executes policy simulation in test collection format and returns an error instead of exiting
+// Returns a *TestFailureError when expectations fail (unless NoAssert), or the error that stopped the run
+func RunTests(client IAMSimulator, scen *Scenario, cfg SimulatorConfig) error {
 	passCount := 0
 	failCount := 0
 	var allResponses []*iam.SimulateCustomPolicyOutput
 
-	// Expand tests with actions array into individual tests
-	expandedTests := expandTestsWithActions(scen.Tests)
+	var report *template.Template
+	if cfg.TemplateFile != "" {
+		tpl, err := loadReportTemplate(cfg.TemplateFile)
+		if err != nil {
+			return err
+		}
+		report = tpl
+	}
+
+	// In JSON Lines, console-style and template mode stdout carries only results; human-readable output moves to stderr
+	var stream *jsonlWriter
+	resultsOut := Stdout
+	if cfg.Format == FormatJSONL || cfg.Format == FormatConsole || report != nil {
+		if cfg.Format == FormatJSONL {
+			stream = &jsonlWriter{w: Stdout, metadata: scen.Metadata}
+		}
+		Stdout = Stderr
+		defer func() { Stdout = resultsOut }()
+	}
+
+	printScenarioMetadata(scen.Metadata)
+	if scen.BoundaryOnly {
+		fmt.Fprintf(Stdout, "Boundary-only mode: identity policy is a synthetic Allow *; results reflect the SCPs/boundary alone\n\n")
+	}
+
+	if !cfg.DedupeNames {
+		if err := checkUniqueTestNames(scen.Tests); err != nil {
+			return err
+		}
+	}
+
+	// Expand tests with actions array into individual tests; the legacy block runs first
+	allTests, err := expandTestsWithActions(append(legacyTests(scen), scen.Tests...))
+	if err != nil {
+		return err
+	}
+	if allTests, err = resolveResourceSets(scen, allTests); err != nil {
+		return err
+	}
+	if allTests, err = resolveTestGroups(scen, allTests); err != nil {
+		return err
+	}
+	expandedTests := allTests
 
 	// Filter tests if --test flag provided
 	if cfg.TestFilter != "" {
 		expandedTests = filterTestsByName(expandedTests, cfg.TestFilter, cfg.Variables)
 		if len(expandedTests) == 0 {
-			fmt.Fprintf(os.Stderr, "Error: No tests matched filter: %s\n\n", cfg.TestFilter)
-			fmt.Fprintf(os.Stderr, "Available named tests:\n")
-			allTests := expandTestsWithActions(scen.Tests)
+			var msg strings.Builder
+			fmt.Fprintf(&msg, "Error: No tests matched filter: %s\n\n", cfg.TestFilter)
+			fmt.Fprintf(&msg, "Available named tests:")
 			for _, test := range allTests {
 				if test.Name != "" {
-					fmt.Fprintf(os.Stderr, "  - %s\n", test.Name)
+					fmt.Fprintf(&msg, "\n  - %s", test.Name)
 				}
 			}
-			GlobalExiter.Exit(1)
+			return &ScenarioError{Msg: msg.String()}
 		}
-		fmt.Printf("Running %d of %d test(s) (filtered)\n\n", len(expandedTests), len(scen.Tests))
+		fmt.Fprintf(Stdout, "Running %d of %d test(s) (filtered)\n\n", len(expandedTests), len(scen.Tests))
 	} else {
-		fmt.Printf("Running %d test(s)...\n\n", len(expandedTests))
+		fmt.Fprintf(Stdout, "Running %d test(s)...\n\n", len(expandedTests))
+	}
+
+	// After filtering, so --test still selects by the names as written
+	if cfg.DedupeNames {
+		if expandedTests, err = dedupeTestNames(expandedTests, cfg.Variables); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Shuffle {
+		shuffleTests(expandedTests, cfg.ShuffleSeed)
+	}
+
+	var progress *progressBar
+	if cfg.Progress {
+		progress = newProgressBar(Stderr, len(expandedTests))
 	}
 
+	var results []testResult
+	skipped, belowSeverity := 0, 0
 	for i, test := range expandedTests {
-		pass, resp := runSingleTest(client, scen, cfg, test, i, len(expandedTests))
-		allResponses = append(allResponses, resp)
-		if pass {
+		if cfg.MaxFailures > 0 && failCount >= cfg.MaxFailures {
+			skipped = len(expandedTests) - i
+			break
+		}
+		result, err := runTestBuffered(client, scen, cfg, test, i, len(expandedTests))
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+		allResponses = append(allResponses, result.Response)
+		if stream != nil {
+			if err := stream.write(result); err != nil {
+				return err
+			}
+		}
+		if result.Passed {
 			passCount++
 		} else {
 			failCount++
+			if !meetsSeverity(result.Severity, cfg.FailOnSeverity) {
+				belowSeverity++
+			}
+		}
+		if progress != nil {
+			progress.update(result.Passed)
 		}
 	}
 
-	printTestSummary(passCount, failCount)
-	saveResponseIfRequested(cfg.SavePath, allResponses)
+	if progress != nil {
+		progress.finish()
+		// Only failures are shown after the bar (--group-by replays every test below)
+		if cfg.GroupBy == "" {
+			for _, r := range results {
+				if !r.Passed {
+					fmt.Fprint(Stdout, r.Output)
+				}
+			}
+		}
+	}
 
-	if failCount > 0 && !cfg.NoAssert {
-		GlobalExiter.Exit(2)
+	if cfg.GroupBy != "" {
+		printGroupedResults(results, cfg.GroupBy)
 	}
+
+	// allowed_actions_exactly counts as one more test; filtered and stopped runs skip it
+	if hasExactActions(scen) && cfg.TestFilter == "" && skipped == 0 {
+		exact, err := checkExactActions(client, scen, cfg)
+		if err != nil {
+			return err
+		}
+		printExactActionsResult(exact, len(scen.AllowedActionsExactly))
+		if exact.Passed() {
+			passCount++
+		} else {
+			failCount++
+		}
+	}
+
+	if !cfg.NoSummary {
+		summaryOut := Stdout
+		if cfg.SummaryStderr {
+			summaryOut = Stderr
+		}
+		printTestSummary(summaryOut, passCount, failCount, skipped)
+		if belowSeverity > 0 {
+			fmt.Fprintf(summaryOut, "%d failure(s) below --fail-on-severity %s don't fail the run\n", belowSeverity, cfg.FailOnSeverity)
+		}
+	}
+	if cfg.Coverage {
+		printCoverageSummary(results)
+	}
+	printNamespaceSummary(results)
+	printTruthTables(results)
+	if cfg.Format == FormatConsole {
+		printConsoleResults(resultsOut, results, cfg)
+	}
+	if report != nil {
+		if err := report.Execute(resultsOut, buildReportData(cfg, scen.Metadata, results, skipped)); err != nil {
+			return fmt.Errorf("--template-file %s: %v", cfg.TemplateFile, err)
+		}
+	}
+	notifyWebhookIfRequested(cfg, scen.Metadata, results, skipped)
+	cfg.Metrics.record(cfg.ScenarioPath, passCount, failCount)
+	if err := saveResponseIfRequested(cfg.SavePath, allResponses); err != nil {
+		return err
+	}
+	if err := saveFullIfRequested(cfg.SaveFullPath, results); err != nil {
+		return err
+	}
+	if cfg.SaveDir != "" {
+		fmt.Fprintf(Stdout, "\nSaved %d per-test response(s) → %s (permissions: 0600)\n", len(results), cfg.SaveDir)
+	}
+
+	// Failures below --fail-on-severity are reported but don't fail the run
+	if failCount > belowSeverity && !cfg.NoAssert {
+		return &TestFailureError{Failed: failCount - belowSeverity}
+	}
+	return nil
+}
+
+// printScenarioMetadata echoes scenario metadata in the run header, sorted by key
+func printScenarioMetadata(metadata map[string]string) {
+	if len(metadata) == 0 {
+		return
+	}
+	pairs := make([]string, 0, len(metadata))
+	for _, k := range sortedKeys(metadata) {
+		pairs = append(pairs, k+"="+metadata[k])
+	}
+	fmt.Fprintf(Stdout, "Metadata: %s\n", strings.Join(pairs, ", "))
+}
+
+// shuffleTests randomizes test order in place and prints the seed needed to reproduce it
+func shuffleTests(tests []TestCase, seed int64) {
+	rng := rand.New(rand.NewSource(seed))
+	rng.Shuffle(len(tests), func(i, j int) { tests[i], tests[j] = tests[j], tests[i] })
+	fmt.Fprintf(Stdout, "Shuffled test order with seed %d (reproduce with --shuffle=%d)\n\n", seed, seed)
+}
+
+// legacyTests converts the legacy actions/resources block into one test per action
+// Their expectations come from the scenario expect map via resolveExpectation
+func legacyTests(scen *Scenario) []TestCase {
+	tests := make([]TestCase, 0, len(scen.Actions))
+	for _, action := range scen.Actions {
+		tests = append(tests, TestCase{Action: action, Resources: scen.Resources})
+	}
+	return tests
 }
 
 // expandTestsWithActions expands tests that use actions array into individual tests
-func expandTestsWithActions(tests []TestCase) []TestCase {
+func expandTestsWithActions(tests []TestCase) ([]TestCase, error) {
 	var expanded []TestCase
 
 	for _, test := range tests {
 		// Validation: cannot have both action and actions
 		if test.Action != "" && len(test.Actions) > 0 {
-			Die("test '%s': cannot specify both 'action' and 'actions'", test.Name)
+			return nil, newScenarioError("test '%s': cannot specify both 'action' and 'actions'", test.Name)
+		}
+		if test.ActionPrefix != "" && (test.Action != "" || len(test.Actions) > 0) {
+			return nil, newScenarioError("test '%s': cannot combine 'action_prefix' with 'action' or 'actions'", test.Name)
+		}
+		if test.CallerArn != "" && len(test.CallerArns) > 0 {
+			return nil, newScenarioError("test '%s': cannot specify both 'caller_arn' and 'caller_arns'", test.Name)
+		}
+		if test.CrossAccount != nil && test.ResourceOwner != "" {
+			return nil, newScenarioError("test '%s': cannot combine 'cross_account' with 'resource_owner' (cross_account sets the resource owner)", test.Name)
+		}
+		if len(test.ExpectIf) > 0 && len(test.TruthTable) > 0 {
+			return nil, newScenarioError("test '%s': cannot combine 'expect_if' with 'truth_table' (rows set their own expect)", test.Name)
+		}
+		for i, cond := range test.ExpectIf {
+			if len(cond.Vars) == 0 || cond.Expect == "" {
+				return nil, newScenarioError("test '%s': expect_if entry %d needs both 'vars' and 'expect'", test.Name, i+1)
+			}
+		}
+		if test.MFAAge != nil && *test.MFAAge < 0 {
+			return nil, newScenarioError("test '%s': mfa_age must be zero or more seconds, got %d", test.Name, *test.MFAAge)
+		}
+		if test.MFAAge != nil && test.MFA != nil && !*test.MFA {
+			return nil, newScenarioError("test '%s': cannot combine 'mfa_age' with 'mfa: false' (AWS only sets aws:MultiFactorAuthAge for MFA sessions)", test.Name)
+		}
+		if err := validateSeverity(test.Severity); err != nil {
+			return nil, newScenarioError("test '%s': %v", test.Name, err)
+		}
+		if test.FailureMessage != "" {
+			if _, err := parseFailureMessage(test.FailureMessage); err != nil {
+				return nil, newScenarioError("test '%s': failure_message: %v", test.Name, err)
+			}
 		}
 
-		// If actions array is provided, expand into multiple tests
-		if len(test.Actions) > 0 {
+		if test.ActionPrefix != "" {
+			actions, err := catalogActions(test.ActionPrefix)
+			if err != nil {
+				return nil, newScenarioError("test '%s': %v", test.Name, err)
+			}
+			for _, action := range actions {
+				expandedTest := test
+				expandedTest.Action = action
+				expanded = append(expanded, expandedTest)
+			}
+		} else if len(test.Actions) > 0 {
+			// If actions array is provided, expand into multiple tests
 			for _, action := range test.Actions {
 				expandedTest := test
 				expandedTest.Action = action
@@ -109,10 +412,88 @@ func expandTestsWithActions(tests []TestCase) []TestCase {
 			expanded = append(expanded, test)
 		} else {
 			// No action specified
-			Die("test '%s': must specify either 'action' or 'actions'", test.Name)
+			return nil, newScenarioError("test '%s': must specify either 'action' or 'actions'", test.Name)
 		}
 	}
 
+	return expandTestsWithTruthTable(expandTestsWithCallers(expanded))
+}
+
+// expandTestsWithTruthTable expands tests with a truth_table into one test per row
+// Expanded tests keep their name (so --test still selects them); results show the row's context
+// Row context overrides the test's own context entries with the same key
+func expandTestsWithTruthTable(tests []TestCase) ([]TestCase, error) {
+	var expanded []TestCase
+	for _, test := range tests {
+		if len(test.TruthTable) == 0 {
+			expanded = append(expanded, test)
+			continue
+		}
+		table := IfEmpty(test.Name, test.Action)
+		for i, row := range test.TruthTable {
+			var rowCtx []ContextEntryYml
+			var cells []string
+			for _, key := range sortedKeys(row.Context) {
+				entry, err := ParseContextFlag(key + "=" + row.Context[key])
+				if err != nil {
+					return nil, newScenarioError("test '%s': truth_table row %d: %v", table, i+1, err)
+				}
+				rowCtx = append(rowCtx, entry)
+				cells = append(cells, key+"="+strings.Join(entry.ContextKeyValues, ","))
+			}
+
+			expandedTest := test
+			expandedTest.TruthTable = nil
+			expandedTest.Context = overlayContextEntries(test.Context, rowCtx)
+			expandedTest.Expect = IfEmpty(row.Expect, test.Expect)
+			expandedTest.truthTable = table
+			expandedTest.truthTableRow = IfEmpty(strings.Join(cells, ", "), "(no context)")
+			expanded = append(expanded, expandedTest)
+		}
+	}
+	return expanded, nil
+}
+
+// printTruthTables prints a PASS/FAIL table for each truth_table test that ran
+func printTruthTables(results []testResult) {
+	var tables []string
+	rows := make(map[string][][3]string)
+	for _, r := range results {
+		if r.TruthTable == "" {
+			continue
+		}
+		if _, seen := rows[r.TruthTable]; !seen {
+			tables = append(tables, r.TruthTable)
+		}
+		outcome := "PASS"
+		if !r.Passed {
+			outcome = "FAIL (expected " + IfEmpty(r.Expect, "any") + ")"
+		}
+		rows[r.TruthTable] = append(rows[r.TruthTable], [3]string{r.TruthTableRow, r.Decision, outcome})
+	}
+
+	for _, table := range tables {
+		fmt.Fprintf(Stdout, "\nTruth table: %s\n", table)
+		PrintTableWithHeaders([3]string{"Context", "Decision", "Result"}, rows[table])
+	}
+}
+
+// expandTestsWithCallers expands tests with a caller_arns list into one test per caller ARN
+// Each expanded test keeps a single-element CallerArns so its result name shows the caller
+func expandTestsWithCallers(tests []TestCase) []TestCase {
+	var expanded []TestCase
+	for _, test := range tests {
+		if len(test.CallerArns) == 0 {
+			expanded = append(expanded, test)
+			continue
+		}
+		for _, callerArn := range test.CallerArns {
+			expandedTest := test
+			expandedTest.CallerArn = callerArn
+			expandedTest.CallerArns = []string{callerArn}
+			expanded = append(expanded, expandedTest)
+		}
+	}
 	return expanded
 }
 
@@ -140,39 +521,358 @@ func filterTestsByName(tests []TestCase, filterNames string, vars map[string]any
 	return filtered
 }
 
-// runSingleTest executes a single test case and returns pass/fail status and response
-func runSingleTest(client IAMSimulator, scen *Scenario, cfg SimulatorConfig, test TestCase, index int, totalTests int) (bool, *iam.SimulateCustomPolicyOutput) {
-	resources := prepareTestResources(test, cfg.Variables)
-	action := RenderString(test.Action, cfg.Variables)
+// checkUniqueTestNames rejects two tests declared with the same name
+// A single test's actions, caller_arns and truth_table rows share its name by design and are not duplicates
+func checkUniqueTestNames(tests []TestCase) error {
+	counts := map[string]int{}
+	for _, test := range tests {
+		if test.Name != "" {
+			counts[test.Name]++
+		}
+	}
+	var duplicates []string
+	for _, name := range sortedKeys(counts) {
+		if counts[name] > 1 {
+			duplicates = append(duplicates, fmt.Sprintf("%q (%d tests)", name, counts[name]))
+		}
+	}
+	if len(duplicates) > 0 {
+		return newScenarioError("duplicate test names: %s; names must be unique for --test, expectations_file and reports (or use --dedupe-names)", strings.Join(duplicates, ", "))
+	}
+	return nil
+}
+
+// dedupeTestNames makes expanded test names unique for --dedupe-names
+// Names shared by several tests get the rendered action appended ("name [s3:GetObject]"), then "#n" if still shared;
+// caller_arns and truth_table expansions are already told apart by their own suffix and are left alone
+func dedupeTestNames(tests []TestCase, vars map[string]any) ([]TestCase, error) {
+	key := func(t TestCase) string {
+		caller := ""
+		if len(t.CallerArns) > 0 {
+			caller = t.CallerArn
+		}
+		return t.Name + "\x00" + caller + "\x00" + t.truthTableRow
+	}
+	shared := func(tests []TestCase) map[string]int {
+		counts := map[string]int{}
+		for _, t := range tests {
+			if t.Name != "" {
+				counts[key(t)]++
+			}
+		}
+		return counts
+	}
+
+	out := slices.Clone(tests)
+	counts := shared(out)
+	for i := range out {
+		if out[i].Name != "" && counts[key(out[i])] > 1 {
+			action, err := renderTestField(out[i], "action", out[i].Action, vars)
+			if err != nil {
+				return nil, err
+			}
+			out[i].Name = fmt.Sprintf("%s [%s]", out[i].Name, action)
+		}
+	}
+	counts = shared(out)
+	seen := map[string]int{}
+	for i := range out {
+		if k := key(out[i]); out[i].Name != "" && counts[k] > 1 {
+			seen[k]++
+			out[i].Name = fmt.Sprintf("%s #%d", out[i].Name, seen[k])
+		}
+	}
+	return out, nil
+}
+
+// testResult captures the outcome of a single executed test
+type testResult struct {
+	Index         int
+	Name          string
+	Action        string   // rendered action
+	Resources     []string // rendered resources
+	Expect        string
+	Reason        string // expect_reason, explaining the intent of the expectation
+	ActionPrefix  string // action_prefix the test was expanded from, if any
+	TruthTable    string // truth_table name the test was expanded from, if any
+	TruthTableRow string // context values of the truth_table row
+	Tags          []string
+	Severity      string
+	Output        string // per-test output, buffered for --group-by
+	Decision      string
+	Passed        bool
+	Input         *iam.SimulateCustomPolicyInput
+	Response      *iam.SimulateCustomPolicyOutput
+}
+
+// runSingleTest executes a single test case and returns its result
+func runSingleTest(client IAMSimulator, scen *Scenario, cfg SimulatorConfig, test TestCase, index int, totalTests int) (testResult, error) {
+	resources, err := prepareTestResources(test, cfg.Variables)
+	if err != nil {
+		return testResult{}, err
+	}
+	action, err := renderTestField(test, "action", test.Action, cfg.Variables)
+	if err != nil {
+		return testResult{}, err
+	}
 	testName := getTestName(test, action, resources)
+	if len(test.CallerArns) > 0 {
+		callerArn, err := renderTestField(test, "caller_arn", test.CallerArn, cfg.Variables)
+		if err != nil {
+			return testResult{}, err
+		}
+		testName += fmt.Sprintf(" [caller=%s]", callerArn)
+	}
+	if test.truthTableRow != "" {
+		testName += fmt.Sprintf(" [%s]", test.truthTableRow)
+	}
+
+	if !cfg.CompactOutput {
+		fmt.Fprintf(Stdout, "[%d/%d] %s\n", index+1, totalTests, testName)
+	}
+	if !cfg.NoWarn {
+		warnWildcardAction(action)
+	}
+
+	// A matching expect_if entry replaces expect; then fall back to the scenario-level expect map
+	if decision, ok := matchExpectIf(test.ExpectIf, cfg.Variables); ok {
+		test.Expect = decision
+	}
+	test.Expect = resolveExpectation(scen, test, action)
+
+	test, err = applyCrossAccount(scen, test, cfg.Variables)
+	if err != nil {
+		return testResult{}, err
+	}
 
-	fmt.Printf("[%d/%d] %s\n", index+1, totalTests, testName)
+	if err := validateSessionShortcuts(test, cfg.Variables); err != nil {
+		return testResult{}, err
+	}
 
 	// Build test input
-	ctxEntries, err := mergeContextEntries(scen.Context, test.Context, cfg.Variables)
-	Check(err)
-	testResourcePolicy := resolveResourcePolicy(test, cfg, index)
+	baseCtx := overlayContextEntries(cfg.GlobalContext, append(servicePrincipalContext(scen, test), regionContext(scen, test)...))
+	scenCtx := overlayContextEntries(overlayContextEntries(baseCtx, scen.Context), scen.Groups[test.Group].Context)
+	testCtx := overlayContextEntries(append(tagContextEntries(test), conditionShortcutEntries(test)...), test.Context)
+	ctxEntries, err := mergeContextEntries(scenCtx, testCtx, cfg.Variables)
+	if err != nil {
+		return testResult{}, err
+	}
+	testResourcePolicy, err := resolveResourcePolicy(test, cfg, index)
+	if err != nil {
+		return testResult{}, err
+	}
+	testResourcePolicy, cfg, err = trackTestResourcePolicy(test, cfg, testResourcePolicy)
+	if err != nil {
+		return testResult{}, err
+	}
 	input := buildTestInput(cfg, action, resources, ctxEntries, testResourcePolicy)
-	applyTestOverrides(input, scen, test, cfg.Variables)
+	if err := applyTestOverrides(input, scen, test, cfg.Variables); err != nil {
+		return testResult{}, err
+	}
 
 	// Execute test
-	resp, err := client.SimulateCustomPolicy(context.Background(), input)
-	Check(err)
+	resp, input, layer, err := simulateLayers(client, input, test.Expect, cfg)
+	if err != nil {
+		return testResult{}, &SimulationError{Test: testName, Err: err}
+	}
+	printDecidingLayer(resp, layer)
+	cfg = withBoundaryLayer(cfg, layer)
+	if err := saveTestResponseIfRequested(cfg.SaveDir, index, testName, resp); err != nil {
+		return testResult{}, err
+	}
 
 	// Evaluate result
 	pass := evaluateTestResult(resp, test, action, resources, cfg)
-	return pass, resp
+	result := testResult{
+		Index:         index,
+		Name:          testName,
+		Action:        action,
+		Resources:     resources,
+		Expect:        test.Expect,
+		Reason:        test.ExpectReason,
+		ActionPrefix:  test.ActionPrefix,
+		TruthTable:    test.truthTable,
+		TruthTableRow: test.truthTableRow,
+		Tags:          test.Tags,
+		Severity:      test.Severity,
+		Passed:        pass,
+		Input:         input,
+		Response:      resp,
+	}
+	if len(resp.EvaluationResults) > 0 {
+		result.Decision = string(resp.EvaluationResults[0].EvalDecision)
+	}
+	return result, nil
+}
+
+// runTestBuffered runs one test, holding back its output in result.Output when --group-by or --progress
+// prints it after the run; --compact-output also buffers, to replace the output with one line
+func runTestBuffered(client IAMSimulator, scen *Scenario, cfg SimulatorConfig, test TestCase, index int, totalTests int) (testResult, error) {
+	if cfg.GroupBy == "" && !cfg.Progress && !cfg.CompactOutput {
+		return runSingleTest(client, scen, cfg, test, index, totalTests)
+	}
+	out := Stdout
+	var buf strings.Builder
+	Stdout = &buf
+	result, err := runSingleTest(client, scen, cfg, test, index, totalTests)
+	Stdout = out
+	if err != nil {
+		// Show what the test printed before failing, below the progress bar if there is one
+		if cfg.Progress {
+			fmt.Fprint(Stderr, "\n")
+		}
+		fmt.Fprint(Stdout, buf.String())
+		return testResult{}, err
+	}
+	result.Output = buf.String()
+	if cfg.CompactOutput {
+		result.Output = compactTestOutput(result, test, index, totalTests, cfg)
+		if cfg.GroupBy == "" && !cfg.Progress {
+			fmt.Fprint(Stdout, result.Output)
+			result.Output = ""
+		}
+	}
+	return result, nil
+}
+
+// compactTestOutput is a test's --compact-output line, e.g. "[3/9] FAIL read logs: expected allowed got implicitDeny"
+// The full output follows for failures, and for passes whose matched statements were asked for
+func compactTestOutput(result testResult, test TestCase, index, totalTests int, cfg SimulatorConfig) string {
+	test.Expect = result.Expect
+	position := fmt.Sprintf("[%d/%d]", index+1, totalTests)
+	switch {
+	case !result.Passed && result.Expect != "":
+		return fmt.Sprintf("%s FAIL %s: expected %s got %s\n%s", position, result.Name, result.Expect, IfEmpty(result.Decision, "no result"), result.Output)
+	case !result.Passed:
+		return fmt.Sprintf("%s FAIL %s: got %s\n%s", position, result.Name, IfEmpty(result.Decision, "no result"), result.Output)
+	case !hasExpectation(test):
+		return fmt.Sprintf("%s RESULT %s: %s\n", position, result.Name, result.Decision)
+	case showMatchedDetail(cfg, result.Decision):
+		return fmt.Sprintf("%s PASS %s\n%s", position, result.Name, result.Output)
+	default:
+		return fmt.Sprintf("%s PASS %s\n", position, result.Name)
+	}
+}
+
+// retrySleep waits between --retry-on-deny attempts; replaceable for testing
+var retrySleep = time.Sleep
+
+// simulateWithRetry re-runs a simulation expected to be allowed that came back denied (--retry-on-deny)
+// This only rides out IAM propagation lag after a change; it can hide a deny that never resolves
+func simulateWithRetry(client IAMSimulator, input *iam.SimulateCustomPolicyInput, expect string, cfg SimulatorConfig) (*iam.SimulateCustomPolicyOutput, error) {
+	resp, err := client.SimulateCustomPolicy(context.Background(), input)
+	if !strings.EqualFold(expect, string(types.PolicyEvaluationDecisionTypeAllowed)) {
+		return resp, err
+	}
+	for attempt := 1; attempt <= cfg.RetryOnDenyAttempts && err == nil && len(resp.EvaluationResults) > 0; attempt++ {
+		decision := resp.EvaluationResults[0].EvalDecision
+		if decision == types.PolicyEvaluationDecisionTypeAllowed {
+			break
+		}
+		fmt.Fprintf(Stdout, "  ↻ Got %s, retrying in %s (%d/%d, --retry-on-deny)\n", decision, cfg.RetryOnDenyDelay, attempt, cfg.RetryOnDenyAttempts)
+		retrySleep(cfg.RetryOnDenyDelay)
+		resp, err = client.SimulateCustomPolicy(context.Background(), input)
+	}
+	return resp, err
+}
+
+// warnWildcardAction warns that SimulateCustomPolicy does not expand wildcards in the action name
+// A test for "s3:Get*" simulates one literal action, so an allowed result says nothing about s3:GetObject
+func warnWildcardAction(action string) {
+	if !strings.ContainsAny(action, "*?") {
+		return
+	}
+	Warn("  ⚠️  WARNING: action %q contains a wildcard; AWS simulates it as one literal action name, not every matching action\n", action)
+	fmt.Fprintf(Stderr, "     Use 'actions:' to list the concrete actions to test\n")
+}
+
+// resolveResourceSets replaces each test's resource_set with the named list from the scenario's resource_sets
+// The ARNs are rendered later with the test's other resources
+func resolveResourceSets(scen *Scenario, tests []TestCase) ([]TestCase, error) {
+	for i, test := range tests {
+		if test.ResourceSet == "" {
+			continue
+		}
+		if test.Resource != "" || len(test.Resources) > 0 {
+			return nil, newScenarioError("test '%s': cannot combine 'resource_set' with 'resource' or 'resources'", test.Name)
+		}
+		set, ok := scen.ResourceSets[test.ResourceSet]
+		if !ok {
+			return nil, newScenarioError("test '%s': unknown resource_set %q (defined: %s)", test.Name, test.ResourceSet, strings.Join(sortedKeys(scen.ResourceSets), ", "))
+		}
+		tests[i].Resources = set
+	}
+	return tests, nil
+}
+
+// resolveTestGroups applies each test's group caller_arn and resource_owner where the test sets none
+// The group's context is layered between scenario and test context in runSingleTest
+func resolveTestGroups(scen *Scenario, tests []TestCase) ([]TestCase, error) {
+	for i, test := range tests {
+		if test.Group == "" {
+			continue
+		}
+		group, ok := scen.Groups[test.Group]
+		if !ok {
+			return nil, newScenarioError("test '%s': unknown group %q (defined: %s)", test.Name, test.Group, strings.Join(sortedKeys(scen.Groups), ", "))
+		}
+		tests[i].CallerArn = IfEmpty(test.CallerArn, group.CallerArn)
+		tests[i].ResourceOwner = IfEmpty(test.ResourceOwner, group.ResourceOwner)
+	}
+	return tests, nil
 }
 
 // prepareTestResources determines and renders resources for a test
-func prepareTestResources(test TestCase, vars map[string]any) []string {
+// List-valued variables referenced in a resource expand into one resource per element
+func prepareTestResources(test TestCase, vars map[string]any) ([]string, error) {
+	resources := test.Resources
 	if test.Resource != "" {
-		return []string{RenderString(test.Resource, vars)}
+		resources = []string{test.Resource}
 	}
-	if len(test.Resources) > 0 {
-		return RenderStringSlice(test.Resources, vars)
+	var out []string
+	for _, r := range resources {
+		expanded, err := ExpandTemplateText(r, vars)
+		if err != nil {
+			return nil, newScenarioError("test '%s': resource: %v", test.Name, err)
+		}
+		out = append(out, expanded...)
 	}
-	return nil
+	return out, nil
+}
+
+// resolveExpectation returns the expected decision for a test
+// Test-level expect wins; otherwise the scenario expect map is consulted by rendered action,
+// then default_expect. With none of them set the test stays unasserted and always passes
+func resolveExpectation(scen *Scenario, test TestCase, action string) string {
+	if test.Expect != "" {
+		return test.Expect
+	}
+	if decision, ok := scen.Expect[action]; ok {
+		return decision
+	}
+	if decision, ok := scen.Expect[test.Action]; ok {
+		return decision
+	}
+	return scen.DefaultExpect
+}
+
+// matchExpectIf returns the expect of the first expect_if entry whose vars all equal the active vars
+// Values are compared as text, so `count: "2"` matches a var of 2; an unset var never matches
+func matchExpectIf(conditions []ExpectIf, vars map[string]any) (string, bool) {
+	for _, cond := range conditions {
+		matched := true
+		for name, want := range cond.Vars {
+			got, ok := vars[name]
+			if !ok || fmt.Sprint(got) != want {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return cond.Expect, true
+		}
+	}
+	return "", false
 }
 
 // getTestName generates a test name if not provided
@@ -232,46 +932,256 @@ func mergeContextEntries(scenCtx, testCtx []ContextEntryYml, vars map[string]any
 	return result, nil
 }
 
+// servicePrincipalContext returns the context entries injected for a service principal caller
+// The test-level service_principal overrides the scenario-level value
+func servicePrincipalContext(scen *Scenario, test TestCase) []ContextEntryYml {
+	principal := scen.ServicePrincipal
+	if test.ServicePrincipal != "" {
+		principal = test.ServicePrincipal
+	}
+	if principal == "" {
+		return nil
+	}
+	return []ContextEntryYml{
+		{ContextKeyName: "aws:PrincipalServiceName", ContextKeyType: "string", ContextKeyValues: []string{principal}},
+		{ContextKeyName: "aws:PrincipalIsAWSService", ContextKeyType: "boolean", ContextKeyValues: []string{"true"}},
+	}
+}
+
+// regionContext returns the aws:RequestedRegion entry for the region the request is made in
+// The test-level region overrides the scenario-level value
+func regionContext(scen *Scenario, test TestCase) []ContextEntryYml {
+	region := scen.Region
+	if test.Region != "" {
+		region = test.Region
+	}
+	if region == "" {
+		return nil
+	}
+	return []ContextEntryYml{{ContextKeyName: "aws:RequestedRegion", ContextKeyType: "string", ContextKeyValues: []string{region}}}
+}
+
+// applyCrossAccount expands a test's cross_account block into the settings a cross-account simulation needs:
+// the resource owner and aws:PrincipalAccount/aws:ResourceAccount context, which the test's own context
+// entries can override. caller_arn stays user-provided (AWS only accepts IAM user/role ARNs) but must be in caller_account
+func applyCrossAccount(scen *Scenario, test TestCase, vars map[string]any) (TestCase, error) {
+	if test.CrossAccount == nil {
+		return test, nil
+	}
+	resourceAccount, err := renderTestField(test, "cross_account.resource_account", test.CrossAccount.ResourceAccount, vars)
+	if err != nil {
+		return test, err
+	}
+	callerAccount, err := renderTestField(test, "cross_account.caller_account", test.CrossAccount.CallerAccount, vars)
+	if err != nil {
+		return test, err
+	}
+	for _, f := range []struct{ field, account string }{{"resource_account", resourceAccount}, {"caller_account", callerAccount}} {
+		if len(f.account) != 12 || strings.Trim(f.account, "0123456789") != "" {
+			return test, newScenarioError("test '%s': cross_account.%s must be a 12-digit account ID, got %q", test.Name, f.field, f.account)
+		}
+	}
+
+	callerArn, err := renderTestField(test, "caller_arn", IfEmpty(test.CallerArn, scen.CallerArn), vars)
+	if err != nil {
+		return test, err
+	}
+	if callerArn != "" {
+		if parts := strings.Split(callerArn, ":"); len(parts) < 5 || parts[4] != callerAccount {
+			return test, newScenarioError("test '%s': caller_arn %s is not in cross_account.caller_account %s", test.Name, callerArn, callerAccount)
+		}
+	}
+
+	test.ResourceOwner = fmt.Sprintf("arn:aws:iam::%s:root", resourceAccount)
+	test.Context = overlayContextEntries([]ContextEntryYml{
+		{ContextKeyName: "aws:PrincipalAccount", ContextKeyType: "string", ContextKeyValues: []string{callerAccount}},
+		{ContextKeyName: "aws:ResourceAccount", ContextKeyType: "string", ContextKeyValues: []string{resourceAccount}},
+	}, test.Context)
+	return test, nil
+}
+
+// tagContextEntries expands request_tags/resource_tags into aws:RequestTag/<key> and
+// aws:ResourceTag/<key> string context entries, sorted by key for stable output
+// Request tags also set aws:TagKeys, which tag-on-create conditions commonly check
+func tagContextEntries(test TestCase) []ContextEntryYml {
+	var entries []ContextEntryYml
+	requestKeys := sortedKeys(test.RequestTags)
+	for _, k := range requestKeys {
+		entries = append(entries, ContextEntryYml{ContextKeyName: "aws:RequestTag/" + k, ContextKeyType: "string", ContextKeyValues: []string{test.RequestTags[k]}})
+	}
+	if len(requestKeys) > 0 {
+		entries = append(entries, ContextEntryYml{ContextKeyName: "aws:TagKeys", ContextKeyType: "stringList", ContextKeyValues: requestKeys})
+	}
+	for _, k := range sortedKeys(test.ResourceTags) {
+		entries = append(entries, ContextEntryYml{ContextKeyName: "aws:ResourceTag/" + k, ContextKeyType: "string", ContextKeyValues: []string{test.ResourceTags[k]}})
+	}
+	return entries
+}
+
+// conditionShortcutEntries expands secure_transport, mfa and source_ip into aws:SecureTransport,
+// aws:MultiFactorAuthPresent (boolean) and aws:SourceIp (ip) context entries, and the session
+// shortcuts mfa_age and token_issue_time into aws:MultiFactorAuthAge (numeric) and aws:TokenIssueTime (date)
+// mfa_age implies aws:MultiFactorAuthPresent=true unless mfa is set, as AWS only reports an age for MFA sessions
+func conditionShortcutEntries(test TestCase) []ContextEntryYml {
+	var entries []ContextEntryYml
+	if test.SecureTransport != nil {
+		entries = append(entries, ContextEntryYml{ContextKeyName: "aws:SecureTransport", ContextKeyType: "boolean", ContextKeyValues: []string{strconv.FormatBool(*test.SecureTransport)}})
+	}
+	if test.MFA != nil {
+		entries = append(entries, ContextEntryYml{ContextKeyName: "aws:MultiFactorAuthPresent", ContextKeyType: "boolean", ContextKeyValues: []string{strconv.FormatBool(*test.MFA)}})
+	} else if test.MFAAge != nil {
+		entries = append(entries, ContextEntryYml{ContextKeyName: "aws:MultiFactorAuthPresent", ContextKeyType: "boolean", ContextKeyValues: []string{"true"}})
+	}
+	if test.MFAAge != nil {
+		entries = append(entries, ContextEntryYml{ContextKeyName: "aws:MultiFactorAuthAge", ContextKeyType: "numeric", ContextKeyValues: []string{strconv.Itoa(*test.MFAAge)}})
+	}
+	if test.SourceIP != "" {
+		entries = append(entries, ContextEntryYml{ContextKeyName: "aws:SourceIp", ContextKeyType: "ip", ContextKeyValues: []string{test.SourceIP}})
+	}
+	if test.TokenIssueTime != "" {
+		entries = append(entries, ContextEntryYml{ContextKeyName: "aws:TokenIssueTime", ContextKeyType: "date", ContextKeyValues: []string{test.TokenIssueTime}})
+	}
+	return entries
+}
+
+// validateSessionShortcuts checks the rendered token_issue_time is an RFC 3339 timestamp,
+// so a typo fails the test instead of silently never matching a Date condition
+func validateSessionShortcuts(test TestCase, vars map[string]any) error {
+	if test.TokenIssueTime == "" {
+		return nil
+	}
+	rendered, err := renderTestField(test, "token_issue_time", test.TokenIssueTime, vars)
+	if err != nil {
+		return err
+	}
+	if _, err := time.Parse(time.RFC3339, rendered); err != nil {
+		return newScenarioError("test '%s': token_issue_time %q is not an RFC 3339 timestamp (e.g. 2024-01-01T00:00:00Z)", test.Name, rendered)
+	}
+	return nil
+}
+
+// renderTestField renders one templated field of a test, reporting a template error as a ScenarioError
+// naming the test and field rather than exiting
+func renderTestField(test TestCase, field, s string, vars map[string]any) (string, error) {
+	rendered, err := RenderTemplateText(s, vars)
+	if err != nil {
+		return "", newScenarioError("test '%s': %s: %v", test.Name, field, err)
+	}
+	return rendered, nil
+}
+
+// sortedKeys returns the keys of a string map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// overlayContextEntries returns base entries overlaid with overrides
+// Entries in overrides replace base entries with the same ContextKeyName
+func overlayContextEntries(base, overrides []ContextEntryYml) []ContextEntryYml {
+	if len(base) == 0 {
+		return overrides
+	}
+	overridden := make(map[string]bool, len(overrides))
+	for _, e := range overrides {
+		overridden[e.ContextKeyName] = true
+	}
+	result := make([]ContextEntryYml, 0, len(base)+len(overrides))
+	for _, e := range base {
+		if !overridden[e.ContextKeyName] {
+			result = append(result, e)
+		}
+	}
+	return append(result, overrides...)
+}
+
 // resolveResourcePolicy determines the resource policy for a test
-func resolveResourcePolicy(test TestCase, cfg SimulatorConfig, testIndex int) string {
+func resolveResourcePolicy(test TestCase, cfg SimulatorConfig, testIndex int) (string, error) {
 	testResourcePolicy := cfg.ResourcePolicyJSON
 	switch {
 	case test.ResourcePolicyJSON != "" && test.ResourcePolicyTemplate != "":
-		Die("test %d: provide only one of 'resource_policy_json' or 'resource_policy_template'", testIndex+1)
+		return "", newScenarioError("test %d: provide only one of 'resource_policy_json' or 'resource_policy_template'", testIndex+1)
 	case test.ResourcePolicyJSON != "":
 		base := filepath.Dir(cfg.ScenarioPath)
 		p := MustAbsJoin(base, test.ResourcePolicyJSON)
 		b, err := os.ReadFile(p)
-		Check(err)
+		if err != nil {
+			return "", err
+		}
+		if b, err = RenderJSONPlaceholders(p, b, cfg.Variables); err != nil {
+			return "", err
+		}
 		var resourceData any
 		if err := json.Unmarshal(b, &resourceData); err != nil {
-			Die("invalid JSON in resource policy file %s: %v", p, err)
+			return "", &PolicyValidationError{Kind: "resource policy file", Path: p, Err: err}
 		}
 		testResourcePolicy = ToJSONPretty(resourceData)
 	case test.ResourcePolicyTemplate != "":
 		base := filepath.Dir(cfg.ScenarioPath)
 		tplPath := MustAbsJoin(base, test.ResourcePolicyTemplate)
-		testResourcePolicy = RenderTemplateFileJSON(tplPath, cfg.Variables)
+		rendered, err := RenderTemplateFile(tplPath, cfg.Variables)
+		if err != nil {
+			return "", err
+		}
+		testResourcePolicy = rendered
 	}
 
 	// Always strip non-IAM fields from test-level resource policies
 	if testResourcePolicy != "" {
-		testResourcePolicy = StripNonIAMFields(testResourcePolicy)
+		stripped, err := StripNonIAMFields(testResourcePolicy)
+		if err != nil {
+			return "", &PolicyValidationError{Kind: "resource policy", Path: IfEmpty(test.ResourcePolicyJSON, IfEmpty(test.ResourcePolicyTemplate, "resource_policy")), Err: err}
+		}
+		testResourcePolicy = stripped
+	}
+
+	return testResourcePolicy, nil
+}
+
+// trackTestResourcePolicy injects tracking Sids into a test-level resource policy and returns
+// a config whose source map resolves matched statements to the test's own policy file
+// Tests using the scenario-level resource policy are returned unchanged
+func trackTestResourcePolicy(test TestCase, cfg SimulatorConfig, policy string) (string, SimulatorConfig, error) {
+	path := test.ResourcePolicyJSON
+	if path == "" {
+		path = test.ResourcePolicyTemplate
+	}
+	if path == "" || policy == "" || cfg.SourceMap == nil {
+		return policy, cfg, nil
 	}
+	path = MustAbsJoin(filepath.Dir(cfg.ScenarioPath), path)
 
-	return testResourcePolicy
+	tracked, sources, err := ProcessResourcePolicyWithSourceMap(policy, path)
+	if err != nil {
+		return "", cfg, err
+	}
+	sourceMap := *cfg.SourceMap
+	sourceMap.Resource = sources
+	sourceMap.ResourcePolicy = &PolicySource{FilePath: path}
+	sourceMap.ResourcePolicyRaw = tracked
+	cfg.SourceMap = &sourceMap
+	return tracked, cfg, nil
 }
 
 // buildTestInput creates the IAM simulation input for a single test
 func buildTestInput(cfg SimulatorConfig, action string, resources []string, ctxEntries []types.ContextEntry, resourcePolicy string) *iam.SimulateCustomPolicyInput {
+	var policies []string
+	if cfg.PolicyJSON != "" {
+		policies = append(policies, cfg.PolicyJSON)
+	}
+	policies = append(policies, cfg.AdditionalPolicies...)
 	input := &iam.SimulateCustomPolicyInput{
-		PolicyInputList: []string{cfg.PolicyJSON},
+		PolicyInputList: policies,
 		ActionNames:     []string{action},
 		ResourceArns:    resources,
 		ContextEntries:  ctxEntries,
 	}
-	if cfg.PermissionsBoundary != "" {
-		input.PermissionsBoundaryPolicyInputList = []string{cfg.PermissionsBoundary}
+	if passes := boundaryPasses(cfg); len(passes) > 0 {
+		input.PermissionsBoundaryPolicyInputList = []string{passes[0].policy}
 	}
 	if resourcePolicy != "" {
 		input.ResourcePolicy = &resourcePolicy
@@ -280,14 +1190,17 @@ func buildTestInput(cfg SimulatorConfig, action string, resources []string, ctxE
 }
 
 // applyTestOverrides applies test-level overrides to the simulation input
-func applyTestOverrides(input *iam.SimulateCustomPolicyInput, scen *Scenario, test TestCase, vars map[string]any) {
+func applyTestOverrides(input *iam.SimulateCustomPolicyInput, scen *Scenario, test TestCase, vars map[string]any) error {
 	// Caller ARN
 	callerArn := scen.CallerArn
 	if test.CallerArn != "" {
 		callerArn = test.CallerArn
 	}
 	if callerArn != "" {
-		rendered := RenderString(callerArn, vars)
+		rendered, err := renderTestField(test, "caller_arn", callerArn, vars)
+		if err != nil {
+			return err
+		}
 		input.CallerArn = &rendered
 	}
 
@@ -297,7 +1210,10 @@ func applyTestOverrides(input *iam.SimulateCustomPolicyInput, scen *Scenario, te
 		resourceOwner = test.ResourceOwner
 	}
 	if resourceOwner != "" {
-		rendered := RenderString(resourceOwner, vars)
+		rendered, err := renderTestField(test, "resource_owner", resourceOwner, vars)
+		if err != nil {
+			return err
+		}
 		input.ResourceOwner = &rendered
 	}
 
@@ -309,12 +1225,13 @@ func applyTestOverrides(input *iam.SimulateCustomPolicyInput, scen *Scenario, te
 	if resourceHandlingOption != "" {
 		input.ResourceHandlingOption = &resourceHandlingOption
 	}
+	return nil
 }
 
 // evaluateTestResult checks the API response against expectations and prints result
 func evaluateTestResult(resp *iam.SimulateCustomPolicyOutput, test TestCase, action string, resources []string, cfg SimulatorConfig) bool {
 	if len(resp.EvaluationResults) == 0 {
-		fmt.Printf("  ✗ FAIL: no evaluation results returned\n\n")
+		fmt.Fprintf(Stdout, "  ✗ FAIL: no evaluation results returned\n\n")
 		return false
 	}
 
@@ -322,143 +1239,681 @@ func evaluateTestResult(resp *iam.SimulateCustomPolicyOutput, test TestCase, act
 	decision := string(result.EvalDecision)
 	detail := extractMatchedStatements(result.MatchedStatements)
 
-	if test.Expect == "" {
-		fmt.Printf("  → Result: %s (matched: %s)\n\n", decision, detail)
+	if note := checkStrictMatches(cfg, result); note != "" {
+		printTestFailure(test, action, resources, decision, detail, result.MatchedStatements, cfg, note)
+		return false
+	}
+
+	if !hasExpectation(test) {
+		fmt.Fprintf(Stdout, "  → Result: %s (matched: %s)\n\n", decision, detail)
 		return true
 	}
 
-	if strings.EqualFold(decision, test.Expect) {
-		if cfg.ShowMatchedSuccess {
+	decisionMatches := test.Expect == "" || strings.EqualFold(decision, test.Expect)
+	detailMismatches := checkDecisionDetails(test.ExpectDetails, result)
+	detailMismatches = append(detailMismatches, checkMatchedSids(test, result.MatchedStatements, cfg)...)
+
+	if decisionMatches && len(detailMismatches) == 0 {
+		if showMatchedDetail(cfg, decision) {
 			printTestSuccess(test, action, resources, decision, detail, result.MatchedStatements, cfg)
 		} else {
-			fmt.Printf("  ✓ PASS: %s (matched: %s)\n\n", decision, detail)
+			fmt.Fprintf(Stdout, "  ✓ PASS: %s (matched: %s)\n\n", decision, detail)
 		}
 		return true
 	}
 
-	printTestFailure(test, action, resources, decision, detail, result.MatchedStatements, cfg)
+	printTestFailure(test, action, resources, decision, detail, result.MatchedStatements, cfg, detailMismatches...)
 	return false
 }
 
+// hasExpectation reports whether a test asserts anything; tests without one only report the decision
+func hasExpectation(test TestCase) bool {
+	return test.Expect != "" || len(test.ExpectDetails) > 0 || test.ExpectMatchedSid != "" || test.ExpectMatchedSidContains != "" || test.ExpectMatchedSourceFile != ""
+}
+
+// checkStrictMatches returns a failure note for an allowed result that no statement was credited with (--strict-matches)
+// It applies with or without an expectation, since the allow itself is what can't be explained
+func checkStrictMatches(cfg SimulatorConfig, result types.EvaluationResult) string {
+	if !cfg.StrictMatches || result.EvalDecision != types.PolicyEvaluationDecisionTypeAllowed || len(result.MatchedStatements) > 0 {
+		return ""
+	}
+	return "Strict matches: allowed, but AWS reported no matched statement to attribute the allow to"
+}
+
+// showMatchedDetail reports whether a passing test prints its matched statements in full
+// --explain-denies-only limits the detail to denies (explicit or implicit) and keeps allows terse
+func showMatchedDetail(cfg SimulatorConfig, decision string) bool {
+	if cfg.ExplainDeniesOnly {
+		return decision != string(types.PolicyEvaluationDecisionTypeAllowed)
+	}
+	return cfg.ShowMatchedSuccess
+}
+
+// decisionDetailAliases maps normalized expect_details keys to the EvalDecisionDetails keys they match
+var decisionDetailAliases = map[string][]string{
+	"identitypolicy":      {"identitypolicy", "iampolicy"},
+	"permissionsboundary": {"permissionsboundary", "permissionsboundarypolicy"},
+	"resourcepolicy":      {"resourcepolicy"},
+}
+
+// normalizeDetailKey lowercases a source type and strips separators so "IAM Policy" matches "iampolicy"
+func normalizeDetailKey(key string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(key) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// actualDecisionDetail returns the per-source decision AWS reported for a source type
+// The permissions boundary falls back to PermissionsBoundaryDecisionDetail, which only reports allowed/denied
+func actualDecisionDetail(sourceType string, result types.EvaluationResult) (string, bool) {
+	key := normalizeDetailKey(sourceType)
+	candidates := decisionDetailAliases[key]
+	if candidates == nil {
+		candidates = []string{key}
+	}
+	for name, decision := range result.EvalDecisionDetails {
+		for _, c := range candidates {
+			if normalizeDetailKey(name) == c {
+				return string(decision), true
+			}
+		}
+	}
+	if key == "permissionsboundary" && result.PermissionsBoundaryDecisionDetail != nil {
+		if result.PermissionsBoundaryDecisionDetail.AllowedByPermissionsBoundary {
+			return "allowed", true
+		}
+		return "denied", true
+	}
+	return "", false
+}
+
+// checkDecisionDetails compares expected per-source decisions with EvalDecisionDetails
+// Returns a description of each mismatch, sorted by source type
+func checkDecisionDetails(expected map[string]string, result types.EvaluationResult) []string {
+	sourceTypes := make([]string, 0, len(expected))
+	for sourceType := range expected {
+		sourceTypes = append(sourceTypes, sourceType)
+	}
+	sort.Strings(sourceTypes)
+
+	var mismatches []string
+	for _, sourceType := range sourceTypes {
+		want := expected[sourceType]
+		got, ok := actualDecisionDetail(sourceType, result)
+		switch {
+		case !ok:
+			mismatches = append(mismatches, fmt.Sprintf("Decision detail %s: expected %s, but none was returned", sourceType, want))
+		case strings.EqualFold(got, want):
+		case got == "denied" && strings.HasSuffix(strings.ToLower(want), "deny"):
+			// PermissionsBoundaryDecisionDetail cannot distinguish explicit from implicit denies
+		default:
+			mismatches = append(mismatches, fmt.Sprintf("Decision detail %s: expected %s, got %s", sourceType, want, got))
+		}
+	}
+	return mismatches
+}
+
+// checkMatchedSids compares the source Sids of the matched statements against expect_matched_sid
+// (exactly that Sid, and nothing else) and expect_matched_sid_contains (that Sid among the matches),
+// and their source files against expect_matched_source_file (that file among the matches)
+func checkMatchedSids(test TestCase, matched []types.Statement, cfg SimulatorConfig) []string {
+	var mismatches []string
+	if test.ExpectMatchedSid != "" || test.ExpectMatchedSidContains != "" {
+		sids := matchedSourceSids(matched, cfg)
+		if want := test.ExpectMatchedSid; want != "" && (len(sids) != 1 || sids[0] != want) {
+			mismatches = append(mismatches, fmt.Sprintf("Matched Sid: expected exactly %s, got %s", want, formatSids(sids)))
+		}
+		if want := test.ExpectMatchedSidContains; want != "" && !slices.Contains(sids, want) {
+			mismatches = append(mismatches, fmt.Sprintf("Matched Sid: expected %s among matches, got %s", want, formatSids(sids)))
+		}
+	}
+	if want := test.ExpectMatchedSourceFile; want != "" {
+		files := matchedSourceFiles(matched, cfg)
+		if !slices.Contains(files, filepath.Base(want)) {
+			mismatches = append(mismatches, fmt.Sprintf("Matched file: expected %s among matches, got %s", filepath.Base(want), formatSourceFiles(files)))
+		}
+	}
+	return mismatches
+}
+
+// matchedSourceFiles returns the distinct base names of the matched statements' source files, in match order
+// Statements whose source can't be resolved contribute an empty name
+func matchedSourceFiles(matched []types.Statement, cfg SimulatorConfig) []string {
+	var files []string
+	for _, stmt := range matched {
+		file := ""
+		if cfg.SourceMap != nil {
+			if source, ok := resolveStatementSource(stmt, cfg); ok && source != nil && source.FilePath != "" {
+				file = filepath.Base(source.FilePath)
+			}
+		}
+		if !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// formatSourceFiles renders matched source files for failure notes, marking unresolved ones
+func formatSourceFiles(files []string) string {
+	if len(files) == 0 {
+		return "no matched statements"
+	}
+	out := make([]string, len(files))
+	for i, file := range files {
+		out[i] = IfEmpty(file, "(unknown source)")
+	}
+	return strings.Join(out, ", ")
+}
+
+// matchedSourceSids returns the distinct original Sids of the matched statements, in match order
+// Statements whose source or Sid can't be resolved contribute an empty Sid
+func matchedSourceSids(matched []types.Statement, cfg SimulatorConfig) []string {
+	var sids []string
+	for _, stmt := range matched {
+		sid := ""
+		if cfg.SourceMap != nil {
+			if source, ok := resolveStatementSource(stmt, cfg); ok && source != nil {
+				sid = source.Sid
+			}
+		}
+		if !slices.Contains(sids, sid) {
+			sids = append(sids, sid)
+		}
+	}
+	return sids
+}
+
+// formatSids renders resolved Sids for failure notes, marking unresolved ones
+func formatSids(sids []string) string {
+	if len(sids) == 0 {
+		return "no matched statements"
+	}
+	out := make([]string, len(sids))
+	for i, sid := range sids {
+		out[i] = IfEmpty(sid, "(no Sid)")
+	}
+	return strings.Join(out, ", ")
+}
+
 // printTestSuccess prints a formatted success message with matched statement details
 func printTestSuccess(test TestCase, action string, resources []string, decision, detail string, matchedStatements []types.Statement, cfg SimulatorConfig) {
-	fmt.Printf("  ✓ PASS:\n")
+	fmt.Fprintf(Stdout, "  ✓ PASS:\n")
 	printTestDetails(test, action, resources, decision, matchedStatements, cfg)
 }
 
 // printTestFailure prints a formatted failure message with matched statement details
-func printTestFailure(test TestCase, action string, resources []string, decision, detail string, matchedStatements []types.Statement, cfg SimulatorConfig) {
-	fmt.Printf("  ✗ FAIL:\n")
+// Optional notes explain why the test failed beyond the final decision
+func printTestFailure(test TestCase, action string, resources []string, decision, detail string, matchedStatements []types.Statement, cfg SimulatorConfig, notes ...string) {
+	fmt.Fprintf(Stdout, "  ✗ FAIL:\n")
+	if test.Severity != "" {
+		fmt.Fprintf(Stdout, "    Severity: %s\n", test.Severity)
+	}
+	if test.ExpectReason != "" {
+		fmt.Fprintf(Stdout, "    Reason:   %s\n", test.ExpectReason)
+	}
+	for _, note := range notes {
+		fmt.Fprintf(Stdout, "    %s\n", note)
+	}
+	if test.FailureMessage != "" {
+		message, err := renderFailureMessage(test, action, resources, decision, matchedStatements, cfg)
+		if err == nil {
+			fmt.Fprintf(Stdout, "    %s\n\n", strings.ReplaceAll(strings.TrimSpace(message), "\n", "\n    "))
+			return
+		}
+		fmt.Fprintf(Stdout, "    (failure_message could not be rendered: %v)\n", err)
+	}
 	printTestDetails(test, action, resources, decision, matchedStatements, cfg)
 }
 
+// parseFailureMessage parses a test's failure_message template
+func parseFailureMessage(text string) (*template.Template, error) {
+	return template.New("failure_message").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// renderFailureMessage renders a test's failure_message with failureMessageData
+func renderFailureMessage(test TestCase, action string, resources []string, decision string, matchedStatements []types.Statement, cfg SimulatorConfig) (string, error) {
+	tpl, err := parseFailureMessage(test.FailureMessage)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	if err := tpl.Execute(&buf, failureMessageData(test, action, resources, decision, matchedStatements, cfg)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// failureMessageData is the data a failure_message template sees:
+// name, action, resource (comma-separated, "*" when unset), resources, expected, decision, reason,
+// matched_sid (comma-separated source Sids), matched_sids and matched_file (the first matched statement's file)
+func failureMessageData(test TestCase, action string, resources []string, decision string, matchedStatements []types.Statement, cfg SimulatorConfig) map[string]any {
+	var sids []string
+	for _, sid := range matchedSourceSids(matchedStatements, cfg) {
+		if sid != "" {
+			sids = append(sids, sid)
+		}
+	}
+	matchedFile := ""
+	if cfg.SourceMap != nil {
+		for _, stmt := range matchedStatements {
+			if source, ok := resolveStatementSource(stmt, cfg); ok && source != nil && source.FilePath != "" {
+				matchedFile = source.FilePath
+				break
+			}
+		}
+	}
+	return map[string]any{
+		"name":         test.Name,
+		"action":       action,
+		"resource":     IfEmpty(strings.Join(resources, ", "), "*"),
+		"resources":    resources,
+		"expected":     test.Expect,
+		"decision":     decision,
+		"reason":       test.ExpectReason,
+		"matched_sid":  strings.Join(sids, ", "),
+		"matched_sids": sids,
+		"matched_file": matchedFile,
+	}
+}
+
 // printTestDetails prints the common details for both success and failure cases
 func printTestDetails(test TestCase, action string, resources []string, decision string, matchedStatements []types.Statement, cfg SimulatorConfig) {
-	fmt.Printf("    Expected: %s\n", test.Expect)
-	fmt.Printf("    Action:   %s\n", action)
+	fmt.Fprintf(Stdout, "    Expected: %s\n", test.Expect)
+	fmt.Fprintf(Stdout, "    Action:   %s\n", action)
 
 	// Display resources
 	if len(resources) == 0 {
-		fmt.Printf("    Resource: *\n")
+		fmt.Fprintf(Stdout, "    Resource: *\n")
 	} else if len(resources) == 1 {
-		fmt.Printf("    Resource: %s\n", resources[0])
+		fmt.Fprintf(Stdout, "    Resource: %s\n", resources[0])
 	} else {
-		fmt.Printf("    Resources:\n")
+		fmt.Fprintf(Stdout, "    Resources:\n")
 		for _, res := range resources {
-			fmt.Printf("      - %s\n", res)
+			fmt.Fprintf(Stdout, "      - %s\n", res)
 		}
 	}
 
 	// Display context keys if present
 	if len(test.Context) > 0 {
-		fmt.Printf("    Context:\n")
+		fmt.Fprintf(Stdout, "    Context:\n")
 		for _, ctx := range test.Context {
 			if len(ctx.ContextKeyValues) == 1 {
-				fmt.Printf("      %s = %s\n", ctx.ContextKeyName, ctx.ContextKeyValues[0])
+				fmt.Fprintf(Stdout, "      %s = %s\n", ctx.ContextKeyName, ctx.ContextKeyValues[0])
 			} else {
-				fmt.Printf("      %s = [%s]\n", ctx.ContextKeyName, strings.Join(ctx.ContextKeyValues, ", "))
+				fmt.Fprintf(Stdout, "      %s = [%s]\n", ctx.ContextKeyName, strings.Join(ctx.ContextKeyValues, ", "))
 			}
 		}
 	}
 
-	fmt.Printf("    Got:      %s\n", decision)
+	fmt.Fprintf(Stdout, "    Got:      %s\n", decision)
 
 	// Display matched statements with source information
 	displayMatchedStatements(matchedStatements, cfg)
-	fmt.Println()
+	fmt.Fprintln(Stdout)
 }
 
 // displayMatchedStatements shows detailed information about matched policy statements
+// Statements are sorted by source file, start line and Sid unless RawMatchOrder is set
 func displayMatchedStatements(matchedStatements []types.Statement, cfg SimulatorConfig) {
 	if len(matchedStatements) == 0 || cfg.SourceMap == nil {
 		return
 	}
 
-	fmt.Println("  Matched statements:")
+	resolved := make([]resolvedStatement, 0, len(matchedStatements))
 	for _, stmt := range matchedStatements {
-		displaySingleStatement(stmt, cfg)
+		if stmt.SourcePolicyId == nil {
+			continue
+		}
+		resolved = append(resolved, resolveStatement(stmt, cfg))
+	}
+
+	if !cfg.RawMatchOrder {
+		sortResolvedStatements(resolved)
+	}
+	if cfg.DedupeMatches {
+		resolved = dedupeResolvedStatements(resolved)
+	}
+
+	fmt.Fprintln(Stdout, "  Matched statements:")
+	for _, r := range resolved {
+		printResolvedStatement(r)
+	}
+}
+
+// resolvedStatement pairs a matched statement with the policy source it was resolved to
+type resolvedStatement struct {
+	stmt   types.Statement
+	source *PolicySource
+	known  bool   // false when the SourcePolicyId is not a recognised policy input
+	layer  string // boundary layer (SCP or permissions boundary) when both are set, else ""
+
+	showJSON bool   // print the statement as submitted (--show-statement-json)
+	json     string // pretty statement JSON, "" when it couldn't be extracted
+}
+
+// resolveStatement resolves a matched statement's source, layer and (with ShowStatementJSON) its JSON
+func resolveStatement(stmt types.Statement, cfg SimulatorConfig) resolvedStatement {
+	source, known := resolveStatementSource(stmt, cfg)
+	r := resolvedStatement{stmt: stmt, source: source, known: known, layer: statementLayer(stmt, cfg), showJSON: cfg.ShowStatementJSON}
+	if r.showJSON && known {
+		r.json = statementJSON(stmt, submittedPolicy(stmt, cfg), source)
+	}
+	return r
+}
+
+// submittedPolicy returns the policy document, as sent to AWS, that a matched statement's SourcePolicyId refers to
+func submittedPolicy(stmt types.Statement, cfg SimulatorConfig) string {
+	sourcePolicyID := AwsString(stmt.SourcePolicyId)
+	switch {
+	case strings.HasPrefix(sourcePolicyID, "PolicyInputList"):
+		if additional, ok := additionalPolicySource(sourcePolicyID, cfg.SourceMap); ok {
+			return additional.Raw
+		}
+		return cfg.SourceMap.IdentityPolicyRaw
+	case strings.HasPrefix(sourcePolicyID, "PermissionsBoundaryPolicyInputList"):
+		return cfg.SourceMap.PermissionsBoundaryRaw
+	case strings.HasPrefix(sourcePolicyID, "ResourcePolicy"):
+		return cfg.SourceMap.ResourcePolicyRaw
+	default:
+		return ""
 	}
 }
 
+// statementJSON extracts a matched statement from the submitted policy and pretty-prints it
+// The injected tracking Sid is swapped back for the original Sid (or dropped) so it reads as written
+func statementJSON(stmt types.Statement, policyJSON string, source *PolicySource) string {
+	var parsed map[string]any
+	if err := json.Unmarshal([]byte(extractStatementFromPolicy(policyJSON, stmt.StartPosition, stmt.EndPosition)), &parsed); err != nil {
+		return ""
+	}
+	if sid, _ := parsed["Sid"].(string); strings.Contains(sid, "#stmt:") {
+		delete(parsed, "Sid")
+	}
+	if source != nil && source.Sid != "" {
+		parsed["Sid"] = source.Sid
+	}
+	return ToJSONPretty(parsed)
+}
+
+// statementLayer labels a boundary statement with its layer when SCPs and a permissions boundary are in play
+func statementLayer(stmt types.Statement, cfg SimulatorConfig) string {
+	if cfg.SourceMap == nil || !strings.HasPrefix(AwsString(stmt.SourcePolicyId), "PermissionsBoundaryPolicyInputList") {
+		return ""
+	}
+	return cfg.SourceMap.BoundaryLayer
+}
+
+// sortKey returns the fields used to order resolved statements deterministically
+func (r resolvedStatement) sortKey() (string, int, string, string) {
+	if r.source == nil {
+		return "", 0, "", AwsString(r.stmt.SourcePolicyId)
+	}
+	return r.source.FilePath, r.source.StartLine, r.source.Sid, AwsString(r.stmt.SourcePolicyId)
+}
+
+// sortResolvedStatements orders statements by source file, start line, Sid then SourcePolicyId
+func sortResolvedStatements(resolved []resolvedStatement) {
+	sort.SliceStable(resolved, func(i, j int) bool {
+		fi, li, si, pi := resolved[i].sortKey()
+		fj, lj, sj, pj := resolved[j].sortKey()
+		if fi != fj {
+			return fi < fj
+		}
+		if li != lj {
+			return li < lj
+		}
+		if si != sj {
+			return si < sj
+		}
+		return pi < pj
+	})
+}
+
+// dedupeResolvedStatements removes statements that resolve to the same source as an earlier one
+func dedupeResolvedStatements(resolved []resolvedStatement) []resolvedStatement {
+	seen := make(map[string]bool, len(resolved))
+	out := make([]resolvedStatement, 0, len(resolved))
+	for _, r := range resolved {
+		file, line, sid, policyID := r.sortKey()
+		key := fmt.Sprintf("%s|%s:%d|%s", policyID, file, line, sid)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, r)
+	}
+	return out
+}
+
 // displaySingleStatement displays a single matched statement with source information
 func displaySingleStatement(stmt types.Statement, cfg SimulatorConfig) {
 	if stmt.SourcePolicyId == nil {
 		return
 	}
+	printResolvedStatement(resolveStatement(stmt, cfg))
+}
 
-	sourcePolicyID := *stmt.SourcePolicyId
-	var source *PolicySource
+// resolveStatementSource determines which policy file and statement a matched statement came from
+// Returns false when the SourcePolicyId does not correspond to a known policy input
+func resolveStatementSource(stmt types.Statement, cfg SimulatorConfig) (*PolicySource, bool) {
+	sourcePolicyID := AwsString(stmt.SourcePolicyId)
 
-	// Determine which policy this statement came from
 	switch {
 	case strings.HasPrefix(sourcePolicyID, "PolicyInputList"):
-		// Look up specific identity policy statement by extracting Sid
-		policyJSON := cfg.SourceMap.IdentityPolicyRaw
-		if stmt.StartPosition != nil && stmt.EndPosition != nil && policyJSON != "" {
-			stmtJSON := extractStatementFromPolicy(policyJSON, stmt.StartPosition, stmt.EndPosition)
-			if trackingSid := extractSidFromJSON(stmtJSON); trackingSid != "" {
-				if src, ok := cfg.SourceMap.Identity[trackingSid]; ok {
-					source = src
-				}
+		if additional, ok := additionalPolicySource(sourcePolicyID, cfg.SourceMap); ok {
+			if src := lookupTrackedSource(stmt, additional.Raw, additional.Statements); src != nil {
+				return src, true
 			}
+			return additional.Source, true
 		}
+		// Look up specific identity policy statement by extracting Sid
+		return lookupTrackedSource(stmt, cfg.SourceMap.IdentityPolicyRaw, cfg.SourceMap.Identity), true
 	case strings.HasPrefix(sourcePolicyID, "PermissionsBoundaryPolicyInputList"):
 		// Look up specific SCP statement by extracting Sid
-		policyJSON := cfg.SourceMap.PermissionsBoundaryRaw
-		if stmt.StartPosition != nil && stmt.EndPosition != nil && policyJSON != "" {
-			stmtJSON := extractStatementFromPolicy(policyJSON, stmt.StartPosition, stmt.EndPosition)
-			if trackingSid := extractSidFromJSON(stmtJSON); trackingSid != "" {
-				if src, ok := cfg.SourceMap.PermissionsBoundary[trackingSid]; ok {
-					source = src
-				}
-			}
-		}
+		return lookupTrackedSource(stmt, cfg.SourceMap.PermissionsBoundaryRaw, cfg.SourceMap.PermissionsBoundary), true
 	case strings.HasPrefix(sourcePolicyID, "ResourcePolicy"):
-		source = cfg.SourceMap.ResourcePolicy
+		// Look up specific resource policy statement, falling back to the file-level source
+		if src := lookupTrackedSource(stmt, cfg.SourceMap.ResourcePolicyRaw, cfg.SourceMap.Resource); src != nil {
+			return src, true
+		}
+		return cfg.SourceMap.ResourcePolicy, true
 	default:
+		return nil, false
+	}
+}
+
+// additionalPolicySource maps a PolicyInputList.N id to a policy_paths entry
+// Returns false when the id refers to the main identity policy (or can't be parsed)
+func additionalPolicySource(sourcePolicyID string, sourceMap *PolicySourceMap) (*TrackedPolicy, bool) {
+	_, suffix, found := strings.Cut(sourcePolicyID, ".")
+	if !found {
+		return nil, false
+	}
+	n, err := strconv.Atoi(suffix)
+	if err != nil || n < 1 {
+		return nil, false
+	}
+	idx := n - 1 // PolicyInputList ids are 1-based
+	if sourceMap.IdentityPolicyRaw != "" {
+		idx-- // the main identity policy is always first
+	}
+	if idx < 0 || idx >= len(sourceMap.AdditionalPolicies) {
+		return nil, false
+	}
+	return sourceMap.AdditionalPolicies[idx], true
+}
+
+// lookupTrackedSource extracts the tracking Sid at the statement's position and looks it up in sources
+// AWS omits positions for some policy shapes; a policy with a single statement still resolves to it
+func lookupTrackedSource(stmt types.Statement, policyJSON string, sources map[string]*PolicySource) *PolicySource {
+	if policyJSON == "" {
+		return nil
+	}
+	if stmt.StartPosition == nil || stmt.EndPosition == nil {
+		return onlyStatementSource(policyJSON, sources)
+	}
+	stmtJSON := extractStatementFromPolicy(policyJSON, stmt.StartPosition, stmt.EndPosition)
+	if trackingSid := extractSidFromJSON(stmtJSON); trackingSid != "" {
+		if src, ok := sources[trackingSid]; ok {
+			return src
+		}
+	}
+	// Without tracking Sids, fall back to the statement's index in the submitted document
+	if index := statementIndexAt(policyJSON, stmt.StartPosition); index >= 0 {
+		return sources[statementPositionKey(index)]
+	}
+	return nil
+}
+
+// onlyStatementSource returns the source of a policy's statement when it has exactly one, else nil
+func onlyStatementSource(policyJSON string, sources map[string]*PolicySource) *PolicySource {
+	var policy struct {
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
+		return nil
+	}
+	stmtJSON := bytes.TrimSpace(policy.Statement)
+	if len(stmtJSON) > 0 && stmtJSON[0] == '[' {
+		var statements []json.RawMessage
+		if err := json.Unmarshal(stmtJSON, &statements); err != nil || len(statements) != 1 {
+			return nil
+		}
+		stmtJSON = statements[0]
+	}
+	if src, ok := sources[extractSidFromJSON(string(stmtJSON))]; ok {
+		return src
+	}
+	return sources[statementPositionKey(0)]
+}
+
+// statementIndexAt returns the index of the Statement element containing a position, or -1
+func statementIndexAt(policyJSON string, pos *types.Position) int {
+	offset := positionOffset(policyJSON, pos)
+	if offset < 0 {
+		return -1
+	}
+
+	var policy map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(policyJSON), &policy); err != nil {
+		return -1
+	}
+	raw, ok := policy["Statement"]
+	if !ok {
+		return -1
+	}
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) == 0 || trimmed[0] != '[' {
+		return 0 // a single statement object
+	}
+
+	// Walk the Statement array: element i spans the input between the previous and current offsets
+	dec := json.NewDecoder(strings.NewReader(policyJSON))
+	if !seekStatementArray(dec) {
+		return -1
+	}
+	for i := 0; dec.More(); i++ {
+		begin := dec.InputOffset()
+		var elem json.RawMessage
+		if err := dec.Decode(&elem); err != nil {
+			return -1
+		}
+		if int64(offset) >= begin && int64(offset) < dec.InputOffset() {
+			return i
+		}
+	}
+	return -1
+}
+
+// seekStatementArray advances dec past the opening bracket of the top-level Statement array
+func seekStatementArray(dec *json.Decoder) bool {
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return false
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		if key == "Statement" {
+			tok, err := dec.Token()
+			return err == nil && tok == json.Delim('[')
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// positionOffset converts a 1-based AWS line/column position into a byte offset, or -1
+func positionOffset(policyJSON string, pos *types.Position) int {
+	if pos == nil || pos.Line < 1 || pos.Column < 1 {
+		return -1
+	}
+	lines := strings.SplitAfter(policyJSON, "\n")
+	line := int(pos.Line) - 1
+	if line >= len(lines) {
+		return -1
+	}
+	offset := 0
+	for _, l := range lines[:line] {
+		offset += len(l)
+	}
+	return offset + int(pos.Column) - 1
+}
+
+// printResolvedStatement prints a matched statement header, source location and source lines
+func printResolvedStatement(r resolvedStatement) {
+	sourcePolicyID := AwsString(r.stmt.SourcePolicyId)
+	source := r.source
+	if r.layer != "" {
+		sourcePolicyID += " [" + r.layer + "]"
+	}
+
+	if !r.known {
 		// Unknown source
-		fmt.Printf("    • %s (unknown source)\n", sourcePolicyID)
+		fmt.Fprintf(Stdout, "    • %s (unknown source)\n", sourcePolicyID)
 		return
 	}
 
 	// Display header with Sid if available
 	if source != nil && source.Sid != "" {
-		fmt.Printf("    • %s (Sid: %s)\n", sourcePolicyID, source.Sid)
+		fmt.Fprintf(Stdout, "    • %s (Sid: %s)\n", sourcePolicyID, source.Sid)
 	} else {
-		fmt.Printf("    • %s\n", sourcePolicyID)
+		fmt.Fprintf(Stdout, "    • %s\n", sourcePolicyID)
+	}
+	if source == nil && (r.stmt.StartPosition == nil || r.stmt.EndPosition == nil) {
+		fmt.Fprintf(Stdout, "      Source: unavailable (AWS returned no statement position)\n")
 	}
 
 	// Display source file path with line numbers
 	if source != nil && source.FilePath != "" {
 		if source.StartLine > 0 && source.EndLine > 0 {
-			fmt.Printf("      Source: %s:%d-%d\n", source.FilePath, source.StartLine, source.EndLine)
+			fmt.Fprintf(Stdout, "      Source: %s:%d-%d\n", source.FilePath, source.StartLine, source.EndLine)
 		} else {
-			fmt.Printf("      Source: %s\n", source.FilePath)
+			fmt.Fprintf(Stdout, "      Source: %s\n", source.FilePath)
 		}
 
 		// Display statement with context from source file
 		displayStatementWithContext(source)
 	}
+
+	if r.showJSON {
+		if r.json == "" {
+			fmt.Fprintf(Stdout, "      Statement JSON: (could not be extracted from the submitted policy)\n")
+			return
+		}
+		fmt.Fprintf(Stdout, "      Statement JSON:\n")
+		for _, line := range strings.Split(r.json, "\n") {
+			fmt.Fprintf(Stdout, "        %s\n", line)
+		}
+	}
 }
 
 // displayStatementWithContext reads the source file and displays the statement lines
@@ -478,11 +1933,11 @@ func displayStatementWithContext(source *PolicySource) {
 		return
 	}
 
-	fmt.Println()
+	fmt.Fprintln(Stdout)
 	// Display only the statement lines (StartLine to EndLine)
 	for i := source.StartLine - 1; i < source.EndLine; i++ { // -1 for 0-based array indexing
 		if i >= 0 && i < len(lines) {
-			fmt.Printf("      %d: %s\n", i+1, lines[i])
+			fmt.Fprintf(Stdout, "      %d: %s\n", i+1, lines[i])
 		}
 	}
 }
@@ -557,9 +2012,40 @@ func extractSidFromJSON(stmtJSON string) string {
 	return ""
 }
 
-// printTestSummary prints the final test summary
-func printTestSummary(passCount, failCount int) {
-	fmt.Printf("========================================\n")
-	fmt.Printf("Test Results: %d passed, %d failed\n", passCount, failCount)
-	fmt.Printf("========================================\n")
+// printCoverageSummary prints the distinct actions and resources exercised by a run
+func printCoverageSummary(results []testResult) {
+	actionCounts := map[string]int{}
+	resourceCounts := map[string]int{}
+	for _, r := range results {
+		actionCounts[r.Action]++
+		if len(r.Resources) == 0 {
+			resourceCounts["*"]++
+		}
+		for _, res := range r.Resources {
+			resourceCounts[res]++
+		}
+	}
+
+	fmt.Fprintf(Stdout, "\nCoverage:\n")
+	printCountedSet("actions", actionCounts)
+	printCountedSet("resources", resourceCounts)
+}
+
+// printCountedSet prints a sorted list of unique values with the number of tests using each
+func printCountedSet(label string, counts map[string]int) {
+	keys := sortedKeys(counts)
+	fmt.Fprintf(Stdout, "  Unique %s tested: %d\n", label, len(keys))
+	for _, k := range keys {
+		fmt.Fprintf(Stdout, "    - %s (%d test(s))\n", k, counts[k])
+	}
+}
+
+// printTestSummary prints the final test summary, noting tests skipped by --max-failures
+func printTestSummary(w io.Writer, passCount, failCount, skipped int) {
+	fmt.Fprintf(w, "========================================\n")
+	fmt.Fprintf(w, "Test Results: %d passed, %d failed\n", passCount, failCount)
+	fmt.Fprintf(w, "========================================\n")
+	if skipped > 0 {
+		fmt.Fprintf(w, "Stopped early after %d failure(s) (--max-failures); %d test(s) not run\n", failCount, skipped)
+	}
 }
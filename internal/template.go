@@ -7,21 +7,70 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
 )
 
 var (
 	// Pattern for ${VAR_NAME} style variables (shell/environment variable style with braces)
+	// AWS policy variables always contain ':' or are a single special character (${aws:username}, ${*}),
+	// so they never match and pass through to IAM as written
 	dollarBraceVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
 	// Pattern for $VAR_NAME style variables (environment variable style without braces)
 	dollarVarPattern = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)`)
 	// Pattern for <VAR_NAME> style variables (custom variable style)
 	angleVarPattern = regexp.MustCompile(`<([A-Za-z_][A-Za-z0-9_]*)>`)
+	// Pattern for simple {{.VAR_NAME}} references after preprocessing
+	simpleVarRefPattern = regexp.MustCompile(`\{\{-?\s*\.([A-Za-z_][A-Za-z0-9_]*)\s*-?\}\}`)
 )
 
+// timeNow is the clock used by the now/dateAdd template helpers; replaceable for testing
+var timeNow = time.Now
+
+// templateFuncs are the helpers available to every policy, scenario and context template
+var templateFuncs = template.FuncMap{
+	"now":     templateNow,
+	"dateAdd": templateDateAdd,
+}
+
+// templateNow returns the current UTC time as RFC3339, e.g. for aws:CurrentTime
+func templateNow() string {
+	return timeNow().UTC().Format(time.RFC3339)
+}
+
+// templateDateAdd offsets an RFC3339 timestamp by a duration such as "-1h", "90m" or "-7d"
+func templateDateAdd(base string, offset string) (string, error) {
+	t, err := time.Parse(time.RFC3339, base)
+	if err != nil {
+		return "", fmt.Errorf("dateAdd: invalid RFC3339 time %q", base)
+	}
+	d, err := parseRelativeDuration(offset)
+	if err != nil {
+		return "", err
+	}
+	return t.Add(d).UTC().Format(time.RFC3339), nil
+}
+
+// parseRelativeDuration extends time.ParseDuration with a day unit ("7d", "-1d")
+func parseRelativeDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("dateAdd: invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("dateAdd: invalid duration %q", s)
+	}
+	return d, nil
+}
+
 // PreprocessTemplate converts ${VAR}, $VAR and <VAR> patterns to {{.VAR}} for Go template compatibility
 func PreprocessTemplate(s string) string {
 	// Replace <VAR> with {{.VAR}}
@@ -42,31 +91,159 @@ func RenderStringSlice(in []string, vars map[string]any) []string {
 	return out
 }
 
+// ExpandTemplateString renders s once per combination of the list-valued variables it references
+// Exits on error; use ExpandTemplateText to handle errors
+func ExpandTemplateString(s string, vars map[string]any) []string {
+	out, err := ExpandTemplateText(s, vars)
+	Check(err)
+	return out
+}
+
+// ExpandTemplateText renders s once per combination of the list-valued variables it references
+// Multiple list variables produce the cartesian product, ordered by first reference in s
+func ExpandTemplateText(s string, vars map[string]any) ([]string, error) {
+	listNames, listValues := referencedListVars(s, vars)
+	if len(listNames) == 0 {
+		rendered, err := RenderTemplateText(s, vars)
+		if err != nil {
+			return nil, err
+		}
+		return []string{rendered}, nil
+	}
+
+	var out []string
+	indices := make([]int, len(listNames))
+	for {
+		combo := make(map[string]any, len(vars))
+		for k, v := range vars {
+			combo[k] = v
+		}
+		for i, name := range listNames {
+			combo[name] = listValues[i][indices[i]]
+		}
+		rendered, err := RenderTemplateText(s, combo)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rendered)
+
+		// Advance indices like an odometer (rightmost variable changes fastest)
+		pos := len(indices) - 1
+		for pos >= 0 {
+			indices[pos]++
+			if indices[pos] < len(listValues[pos]) {
+				break
+			}
+			indices[pos] = 0
+			pos--
+		}
+		if pos < 0 {
+			return out, nil
+		}
+	}
+}
+
+// referencedListVars returns the names and values of list-valued variables referenced in s
+func referencedListVars(s string, vars map[string]any) ([]string, [][]any) {
+	var names []string
+	var values [][]any
+	seen := map[string]bool{}
+	for _, m := range simpleVarRefPattern.FindAllStringSubmatch(PreprocessTemplate(s), -1) {
+		name := m[1]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		var items []any
+		switch v := vars[name].(type) {
+		case []any:
+			items = v
+		case []string:
+			for _, item := range v {
+				items = append(items, item)
+			}
+		default:
+			continue
+		}
+		if len(items) == 0 {
+			continue
+		}
+		names = append(names, name)
+		values = append(values, items)
+	}
+	return names, values
+}
+
 // RenderTemplateFileJSON reads a template file, renders it, and returns pretty-printed JSON
+// Exits on error; use RenderTemplateFile to handle errors
 func RenderTemplateFileJSON(path string, vars map[string]any) string {
-	tplText, err := os.ReadFile(path)
+	out, err := RenderTemplateFile(path, vars)
 	Check(err)
+	return out
+}
+
+// RenderTemplateFile reads a template file, renders it, and returns pretty-printed JSON
+func RenderTemplateFile(path string, vars map[string]any) (string, error) {
+	tplText, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
 	// Preprocess to convert $VAR and <VAR> to {{.VAR}}
 	preprocessed := PreprocessTemplate(string(tplText))
-	tpl := template.Must(template.New(filepath.Base(path)).Option("missingkey=error").Parse(preprocessed))
+	tpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Option("missingkey=error").Parse(preprocessed)
+	if err != nil {
+		return "", err
+	}
 	var buf bytes.Buffer
-	Check(tpl.Execute(&buf, vars))
+	if err := tpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
 	// Validate and format JSON
 	var jsonData any
 	if err := json.Unmarshal(buf.Bytes(), &jsonData); err != nil {
-		Die("invalid JSON in template %s: %v", path, err)
+		return "", &PolicyValidationError{Kind: "template", Path: path, Err: err}
 	}
-	return ToJSONPretty(jsonData)
+	return ToJSONPretty(jsonData), nil
+}
+
+// RenderJSONPlaceholders renders {{ ... }} expressions in a JSON file that isn't declared as a template
+// Only Go template syntax is rendered ($VAR and <VAR> are left alone), and files without "{{" are returned as-is
+func RenderJSONPlaceholders(path string, content []byte, vars map[string]any) ([]byte, error) {
+	if !bytes.Contains(content, []byte("{{")) {
+		return content, nil
+	}
+	tpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, vars); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 // RenderTemplateString renders a template string with the given variables
+// Exits on error; use RenderTemplateText to handle errors
 func RenderTemplateString(s string, vars map[string]any) string {
+	out, err := RenderTemplateText(s, vars)
+	Check(err)
+	return out
+}
+
+// RenderTemplateText renders a template string with the given variables
+func RenderTemplateText(s string, vars map[string]any) (string, error) {
 	// Preprocess to convert $VAR and <VAR> to {{.VAR}}
 	preprocessed := PreprocessTemplate(s)
-	tpl := template.Must(template.New("inline").Option("missingkey=error").Parse(preprocessed))
+	tpl, err := template.New("inline").Funcs(templateFuncs).Option("missingkey=error").Parse(preprocessed)
+	if err != nil {
+		return "", err
+	}
 	var buf bytes.Buffer
-	Check(tpl.Execute(&buf, vars))
-	return buf.String()
+	if err := tpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
 }
 
 // RenderString is an alias for RenderTemplateString
@@ -74,18 +251,57 @@ func RenderString(s string, vars map[string]any) string {
 	return RenderTemplateString(s, vars)
 }
 
+// ParseContextFlag parses a "key=value[:type]" context entry from the command line
+// The type suffix is only recognised if it is a valid context type, so values containing
+// colons (e.g. ARNs) don't need one; list types take comma-separated values
+func ParseContextFlag(s string) (ContextEntryYml, error) {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return ContextEntryYml{}, fmt.Errorf("invalid context %q: expected key=value[:type]", s)
+	}
+	ctxType := "string"
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		if _, err := ParseContextType(value[i+1:]); err == nil {
+			ctxType = strings.TrimSpace(value[i+1:])
+			value = value[:i]
+		}
+	}
+	values := []string{value}
+	if strings.HasSuffix(strings.ToLower(ctxType), "list") {
+		values = strings.Split(value, ",")
+	}
+	return ContextEntryYml{ContextKeyName: strings.TrimSpace(key), ContextKeyType: ctxType, ContextKeyValues: values}, nil
+}
+
 // RenderContext converts YAML context entries to IAM context entries with rendering
+// List types send each value separately so ForAllValues/ForAnyValue conditions see a set;
+// a list-valued variable in a list-typed entry expands into one value per element
 func RenderContext(in []ContextEntryYml, vars map[string]any) ([]iamtypes.ContextEntry, error) {
 	out := make([]iamtypes.ContextEntry, 0, len(in))
 	for _, e := range in {
-		values := make([]string, 0, len(e.ContextKeyValues))
-		for _, v := range e.ContextKeyValues {
-			values = append(values, RenderTemplateString(v, vars))
-		}
 		ctxType, err := ParseContextType(e.ContextKeyType)
 		if err != nil {
 			return nil, err
 		}
+		isList := strings.HasSuffix(string(ctxType), "List")
+		values := make([]string, 0, len(e.ContextKeyValues))
+		for _, v := range e.ContextKeyValues {
+			var rendered []string
+			if isList {
+				rendered, err = ExpandTemplateText(v, vars)
+			} else {
+				var value string
+				value, err = RenderTemplateText(v, vars)
+				rendered = []string{value}
+			}
+			if err != nil {
+				return nil, newScenarioError("context key %s: %v", e.ContextKeyName, err)
+			}
+			values = append(values, rendered...)
+		}
+		if !isList && len(values) > 1 {
+			return nil, fmt.Errorf("context key %s has %d values but type %s takes one; use %sList for multi-valued keys (required for ForAllValues/ForAnyValue conditions)", e.ContextKeyName, len(values), ctxType, ctxType)
+		}
 		out = append(out, iamtypes.ContextEntry{
 			ContextKeyName:   StrPtr(e.ContextKeyName),
 			ContextKeyType:   ctxType,
@@ -111,7 +327,15 @@ func ParseContextType(t string) (iamtypes.ContextKeyTypeEnum, error) {
 		return iamtypes.ContextKeyTypeEnumBoolean, nil
 	case "booleanlist":
 		return iamtypes.ContextKeyTypeEnumBooleanList, nil
+	case "date":
+		return iamtypes.ContextKeyTypeEnumDate, nil
+	case "datelist":
+		return iamtypes.ContextKeyTypeEnumDateList, nil
+	case "ip":
+		return iamtypes.ContextKeyTypeEnumIp, nil
+	case "iplist":
+		return iamtypes.ContextKeyTypeEnumIpList, nil
 	default:
-		return "", fmt.Errorf("unsupported context type '%s': must be one of: string, stringList, numeric, numericList, boolean, booleanList", t)
+		return "", fmt.Errorf("unsupported context type '%s': must be one of: string, stringList, numeric, numericList, boolean, booleanList, date, dateList, ip, ipList", t)
 	}
 }
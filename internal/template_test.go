@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/iam/types"
 )
@@ -89,6 +91,30 @@ func TestParseContextType(t *testing.T) {
 			want:    types.ContextKeyTypeEnumBooleanList,
 			wantErr: false,
 		},
+		{
+			name:    "ip",
+			input:   "ip",
+			want:    types.ContextKeyTypeEnumIp,
+			wantErr: false,
+		},
+		{
+			name:    "ipList",
+			input:   "ipList",
+			want:    types.ContextKeyTypeEnumIpList,
+			wantErr: false,
+		},
+		{
+			name:    "date",
+			input:   "date",
+			want:    types.ContextKeyTypeEnumDate,
+			wantErr: false,
+		},
+		{
+			name:    "dateList",
+			input:   "dateList",
+			want:    types.ContextKeyTypeEnumDateList,
+			wantErr: false,
+		},
 		{
 			name:    "unknown type should error",
 			input:   "unknownType",
@@ -117,6 +143,36 @@ func TestParseContextType(t *testing.T) {
 	}
 }
 
+func TestRenderRelativeDates(t *testing.T) {
+	original := timeNow
+	defer func() { timeNow = original }()
+	timeNow = func() time.Time { return time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{`{{ now }}`, "2024-03-10T12:00:00Z"},
+		{`{{ dateAdd now "-1h" }}`, "2024-03-10T11:00:00Z"},
+		{`{{ dateAdd now "90m" }}`, "2024-03-10T13:30:00Z"},
+		{`{{ dateAdd now "-7d" }}`, "2024-03-03T12:00:00Z"},
+		{`{{ dateAdd .issued "1h" }}`, "2024-01-01T01:00:00Z"},
+	}
+	vars := map[string]any{"issued": "2024-01-01T00:00:00Z"}
+	for _, tt := range tests {
+		if got := RenderString(tt.template, vars); got != tt.want {
+			t.Errorf("RenderString(%s) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+
+	if _, err := templateDateAdd("2024-01-01T00:00:00Z", "soon"); err == nil {
+		t.Error("Expected error for an invalid duration")
+	}
+	if _, err := templateDateAdd("yesterday", "1h"); err == nil {
+		t.Error("Expected error for a non-RFC3339 time")
+	}
+}
+
 func TestRenderStringSlice(t *testing.T) {
 	vars := map[string]any{
 		"bucket": "my-bucket",
@@ -194,6 +250,28 @@ func TestRenderContext(t *testing.T) {
 	}
 }
 
+func TestRenderContextListValues(t *testing.T) {
+	vars := map[string]any{"teams": []any{"red", "blue"}, "env": "prod"}
+
+	result, err := RenderContext([]ContextEntryYml{
+		{ContextKeyName: "aws:PrincipalTag/Team", ContextKeyType: "stringList", ContextKeyValues: []string{"{{.teams}}", "{{.env}}"}},
+	}, vars)
+	if err != nil {
+		t.Fatalf("RenderContext() unexpected error: %v", err)
+	}
+	// A list variable expands into separate values rather than one "[red blue]" string
+	if got := strings.Join(result[0].ContextKeyValues, "|"); got != "red|blue|prod" {
+		t.Errorf("Expected values red|blue|prod, got %s", got)
+	}
+
+	_, err = RenderContext([]ContextEntryYml{
+		{ContextKeyName: "aws:RequestedRegion", ContextKeyType: "string", ContextKeyValues: []string{"us-east-1", "us-west-2"}},
+	}, vars)
+	if err == nil || !strings.Contains(err.Error(), "use stringList") {
+		t.Errorf("Expected error suggesting stringList for multiple string values, got %v", err)
+	}
+}
+
 func TestRenderTemplateFileJSON(t *testing.T) {
 	tmpDir := t.TempDir()
 	templateFile := filepath.Join(tmpDir, "policy.json.tpl")
@@ -228,6 +306,72 @@ func TestRenderTemplateFileJSON(t *testing.T) {
 	}
 }
 
+func TestRenderPreservesIAMPolicyVariables(t *testing.T) {
+	tmpDir := t.TempDir()
+	vars := map[string]any{"bucket": "test-bucket", "team_bucket": "team-data"}
+	iamVars := []string{"${aws:username}", "${aws:PrincipalTag/team}", "${s3:prefix}", "${*}", "${?}", "${$}"}
+	policy := `{
+		"Version": "2012-10-17",
+		"Statement": [{
+			"Effect": "Allow",
+			"Action": "s3:*",
+			"Resource": [
+				"arn:aws:s3:::{{.bucket}}/home/${aws:username}/*",
+				"arn:aws:s3:::${team_bucket}/${aws:PrincipalTag/team}/*"
+			],
+			"Condition": {"StringLike": {"s3:prefix": ["${s3:prefix}", "${*}${?}${$}"]}}
+		}]
+	}`
+	path := filepath.Join(tmpDir, "policy.json")
+	if err := os.WriteFile(path, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(name, got string) {
+		t.Helper()
+		for _, want := range append([]string{"test-bucket"}, iamVars...) {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: expected %q in output:\n%s", name, want, got)
+			}
+		}
+		if strings.Contains(got, "{{") {
+			t.Errorf("%s: politest variable left unrendered:\n%s", name, got)
+		}
+	}
+
+	// policy_template: every politest syntax is rendered, ${team_bucket} included
+	rendered := RenderTemplateFileJSON(path, vars)
+	check("RenderTemplateFileJSON", rendered)
+	if !strings.Contains(rendered, "arn:aws:s3:::team-data/${aws:PrincipalTag/team}/*") {
+		t.Errorf("Expected ${team_bucket} rendered next to an IAM variable:\n%s", rendered)
+	}
+
+	// Non-template JSON files: only {{ }} is rendered
+	placeholders, err := RenderJSONPlaceholders(path, []byte(policy), vars)
+	if err != nil {
+		t.Fatalf("RenderJSONPlaceholders() error = %v", err)
+	}
+	check("RenderJSONPlaceholders", string(placeholders))
+
+	// Test fields such as resources
+	check("RenderTemplateString", RenderTemplateString("arn:aws:s3:::{{.bucket}}/"+strings.Join(iamVars, "/"), vars))
+
+	// Templated scenario files
+	if err := os.WriteFile(filepath.Join(tmpDir, "vars.yml"), []byte("bucket: test-bucket\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scenario := ScenarioTemplateMarker + "\nvars_file: vars.yml\ntests:\n  - action: s3:GetObject\n    resource: 'arn:aws:s3:::{{.bucket}}/" + strings.Join(iamVars, "/") + "'\n"
+	scenarioPath := filepath.Join(tmpDir, "scenario.yml")
+	if err := os.WriteFile(scenarioPath, []byte(scenario), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var s Scenario
+	if err := loadScenarioFile(scenarioPath, &s); err != nil {
+		t.Fatalf("loadScenarioFile() error = %v", err)
+	}
+	check("templated scenario", s.Tests[0].Resource)
+}
+
 func TestParseContextTypeAllTypes(t *testing.T) {
 	allTypes := []string{
 		"string", "String", "STRING",
@@ -236,6 +380,7 @@ func TestParseContextTypeAllTypes(t *testing.T) {
 		"numericList", "NumericList", "NUMERICLIST",
 		"boolean", "Boolean", "BOOLEAN",
 		"booleanList", "BooleanList", "BOOLEANLIST",
+		"date", "dateList",
 	}
 
 	for _, typeName := range allTypes {
@@ -375,6 +520,11 @@ func TestPreprocessTemplate(t *testing.T) {
 			input: "{{.existing}}",
 			want:  "{{.existing}}",
 		},
+		{
+			name:  "AWS policy variables left intact",
+			input: "arn:aws:s3:::$BUCKET/${aws:username}/${aws:PrincipalTag/team}/${*}${?}${$}",
+			want:  "arn:aws:s3:::{{.BUCKET}}/${aws:username}/${aws:PrincipalTag/team}/${*}${?}${$}",
+		},
 		{
 			name:  "all three formats",
 			input: "$ENV_VAR and <CUSTOM_VAR> and {{.go_var}}",
@@ -588,3 +738,113 @@ func TestRenderTemplateFileJSONInvalidJSON(t *testing.T) {
 		t.Errorf("RenderTemplateFileJSON() called Exit with code %d, want 1", mockExit.exitCode)
 	}
 }
+
+func TestExpandTemplateString(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		vars     map[string]any
+		want     []string
+	}{
+		{
+			name:     "scalar variables render once",
+			template: "arn:aws:s3:::{{.bucket}}/*",
+			vars:     map[string]any{"bucket": "my-bucket"},
+			want:     []string{"arn:aws:s3:::my-bucket/*"},
+		},
+		{
+			name:     "list variable expands per element",
+			template: "arn:aws:s3:::{{.bucket}}/*",
+			vars:     map[string]any{"bucket": []any{"logs", "data"}},
+			want:     []string{"arn:aws:s3:::logs/*", "arn:aws:s3:::data/*"},
+		},
+		{
+			name:     "string slice with dollar syntax",
+			template: "arn:aws:s3:::${bucket}/*",
+			vars:     map[string]any{"bucket": []string{"a", "b"}},
+			want:     []string{"arn:aws:s3:::a/*", "arn:aws:s3:::b/*"},
+		},
+		{
+			name:     "multiple list variables produce cartesian product",
+			template: "arn:aws:s3:::{{.bucket}}-{{.region}}/*",
+			vars: map[string]any{
+				"bucket": []any{"logs", "data"},
+				"region": []any{"eu-west-2", "us-east-1"},
+			},
+			want: []string{
+				"arn:aws:s3:::logs-eu-west-2/*",
+				"arn:aws:s3:::logs-us-east-1/*",
+				"arn:aws:s3:::data-eu-west-2/*",
+				"arn:aws:s3:::data-us-east-1/*",
+			},
+		},
+		{
+			name:     "repeated list variable uses the same element",
+			template: "arn:aws:s3:::{{.bucket}}/{{.bucket}}",
+			vars:     map[string]any{"bucket": []any{"x", "y"}},
+			want:     []string{"arn:aws:s3:::x/x", "arn:aws:s3:::y/y"},
+		},
+		{
+			name:     "mixed list and scalar",
+			template: "arn:aws:s3:::{{.prefix}}-{{.bucket}}",
+			vars:     map[string]any{"prefix": "acme", "bucket": []any{"one", "two"}},
+			want:     []string{"arn:aws:s3:::acme-one", "arn:aws:s3:::acme-two"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExpandTemplateString(tt.template, tt.vars)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ExpandTemplateString() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ExpandTemplateString()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseContextFlag(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    ContextEntryYml
+		wantErr bool
+	}{
+		{
+			input: "aws:MultiFactorAuthPresent=true:boolean",
+			want:  ContextEntryYml{ContextKeyName: "aws:MultiFactorAuthPresent", ContextKeyType: "boolean", ContextKeyValues: []string{"true"}},
+		},
+		{
+			input: "aws:RequestedRegion=eu-west-1",
+			want:  ContextEntryYml{ContextKeyName: "aws:RequestedRegion", ContextKeyType: "string", ContextKeyValues: []string{"eu-west-1"}},
+		},
+		{
+			input: "aws:SourceArn=arn:aws:s3:::bucket",
+			want:  ContextEntryYml{ContextKeyName: "aws:SourceArn", ContextKeyType: "string", ContextKeyValues: []string{"arn:aws:s3:::bucket"}},
+		},
+		{
+			input: "aws:TagKeys=Team,Env:stringList",
+			want:  ContextEntryYml{ContextKeyName: "aws:TagKeys", ContextKeyType: "stringList", ContextKeyValues: []string{"Team", "Env"}},
+		},
+		{input: "novalue", wantErr: true},
+		{input: "=value", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseContextFlag(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseContextFlag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.ContextKeyName != tt.want.ContextKeyName || got.ContextKeyType != tt.want.ContextKeyType || strings.Join(got.ContextKeyValues, "|") != strings.Join(tt.want.ContextKeyValues, "|") {
+				t.Errorf("ParseContextFlag() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
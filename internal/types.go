@@ -1,36 +1,112 @@
 package internal
 
+import "time"
+
 // Scenario represents a complete test scenario loaded from YAML
 type Scenario struct {
-	Extends                string            `yaml:"extends"`                  // optional
-	VarsFile               string            `yaml:"vars_file"`                // optional
-	Vars                   map[string]any    `yaml:"vars"`                     // optional
-	PolicyTemplate         string            `yaml:"policy_template"`          // OR
-	PolicyJSON             string            `yaml:"policy_json"`              // mutually exclusive
-	ResourcePolicyTemplate string            `yaml:"resource_policy_template"` // optional resource-based policy template
-	ResourcePolicyJSON     string            `yaml:"resource_policy_json"`     // optional resource-based policy
-	CallerArn              string            `yaml:"caller_arn"`               // optional IAM principal ARN to simulate as
-	ResourceOwner          string            `yaml:"resource_owner"`           // optional account ARN that owns resources
-	ResourceHandlingOption string            `yaml:"resource_handling_option"` // optional EC2 scenario (EC2-VPC-InstanceStore, etc)
-	SCPPaths               []string          `yaml:"scp_paths"`                // optional
-	Context                []ContextEntryYml `yaml:"context"`                  // optional
-	Tests                  []TestCase        `yaml:"tests"`                    // required - array of test cases
+	Extends                string               `yaml:"extends"`                  // optional
+	Disabled               bool                 `yaml:"disabled"`                 // optional - skip this scenario file (not inherited via extends)
+	VarsFile               string               `yaml:"vars_file"`                // optional
+	Vars                   map[string]any       `yaml:"vars"`                     // optional
+	Matrix                 map[string][]any     `yaml:"matrix"`                   // optional: run all tests once per combination of these vars
+	PolicyTemplate         string               `yaml:"policy_template"`          // OR
+	PolicyJSON             string               `yaml:"policy_json"`              // mutually exclusive
+	PolicyPaths            []string             `yaml:"policy_paths"`             // optional additional identity policies: JSON files/globs or managed policy ARNs
+	ResourcePolicyTemplate string               `yaml:"resource_policy_template"` // optional resource-based policy template
+	ResourcePolicyJSON     string               `yaml:"resource_policy_json"`     // optional resource-based policy
+	CallerArn              string               `yaml:"caller_arn"`               // optional IAM principal ARN to simulate as
+	ResourceOwner          string               `yaml:"resource_owner"`           // optional account ARN that owns resources
+	ResourceHandlingOption string               `yaml:"resource_handling_option"` // optional EC2 scenario (EC2-VPC-InstanceStore, etc)
+	ServicePrincipal       string               `yaml:"service_principal"`        // optional service principal (e.g. lambda.amazonaws.com) making the request
+	Region                 string               `yaml:"region"`                   // optional region the request is made in, injected as aws:RequestedRegion
+	BoundaryOnly           bool                 `yaml:"boundary_only"`            // optional: use an Allow * identity policy so results reflect only scp_paths
+	SCPPaths               []string             `yaml:"scp_paths"`                // optional
+	PermissionsBoundary    string               `yaml:"permissions_boundary"`     // optional: permissions boundary policy file, simulated separately from scp_paths
+	Context                []ContextEntryYml    `yaml:"context"`                  // optional
+	ContextMerge           string               `yaml:"context_merge"`            // optional: ContextMergeReplace (default) or ContextMergeAppend, how context combines with the extends parent's
+	ResourceSets           map[string][]string  `yaml:"resource_sets"`            // optional named resource lists that tests reference with resource_set
+	Groups                 map[string]TestGroup `yaml:"groups"`                   // optional named caller/context bundles that tests reference with group
+	Actions                []string             `yaml:"actions"`                  // optional legacy block: one test per action, run before tests
+	Resources              []string             `yaml:"resources"`                // optional legacy block: resources for every legacy action
+	AllowedActionsExactly  []string             `yaml:"allowed_actions_exactly"`  // optional: of these and candidate_actions, only these may be allowed
+	CandidateActions       []string             `yaml:"candidate_actions"`        // optional: extra actions that allowed_actions_exactly checks are denied
+	ExpectationsFile       string               `yaml:"expectations_file"`        // optional YAML map of test name -> decision, overriding each named test's expect
+	Expect                 map[string]string    `yaml:"expect"`                   // optional legacy action -> decision map used when a test has no expect
+	DefaultExpect          string               `yaml:"default_expect"`           // optional decision for tests with no expect of their own (after the expect map); unset keeps them unasserted
+	Metadata               ScenarioMetadata     `yaml:"metadata"`                 // optional flat key/values (owner, ticket, ...) echoed in output; no effect on simulation
+	Tests                  []TestCase           `yaml:"tests"`                    // required - array of test cases
+
+	origins map[string]string // field (or "vars.<key>" for map entries) -> file that set it, for --explain-merge
+	chain   []string          // extends chain, root parent first
 }
 
 // TestCase represents a single test case in the new collection format
 type TestCase struct {
-	Name                   string            `yaml:"name"`                     // descriptive test name
-	Action                 string            `yaml:"action"`                   // single action to test (use this OR actions, not both)
-	Actions                []string          `yaml:"actions"`                  // multiple actions to test with same resource/context (use this OR action, not both)
-	Resource               string            `yaml:"resource"`                 // single resource ARN (optional, can use Resources for multiple)
-	Resources              []string          `yaml:"resources"`                // multiple resources (alternative to Resource)
-	Context                []ContextEntryYml `yaml:"context"`                  // optional context for this specific test
-	ResourcePolicyTemplate string            `yaml:"resource_policy_template"` // optional resource policy template for this test
-	ResourcePolicyJSON     string            `yaml:"resource_policy_json"`     // optional resource policy for this test
-	CallerArn              string            `yaml:"caller_arn"`               // optional caller ARN override for this test
-	ResourceOwner          string            `yaml:"resource_owner"`           // optional resource owner override for this test
-	ResourceHandlingOption string            `yaml:"resource_handling_option"` // optional EC2 scenario override for this test
-	Expect                 string            `yaml:"expect"`                   // expected decision: allowed, explicitDeny, implicitDeny
+	Name                     string            `yaml:"name"`                        // descriptive test name
+	Action                   string            `yaml:"action"`                      // single action to test (use this OR actions, not both)
+	Actions                  []string          `yaml:"actions"`                     // multiple actions to test with same resource/context (use this OR action, not both)
+	ActionPrefix             string            `yaml:"action_prefix"`               // every catalog action under a namespace, e.g. "iam:" (requires ActionCatalog)
+	Resource                 string            `yaml:"resource"`                    // single resource ARN (optional, can use Resources for multiple)
+	Resources                []string          `yaml:"resources"`                   // multiple resources (alternative to Resource)
+	ResourceSet              string            `yaml:"resource_set"`                // name of a scenario resource_sets entry (alternative to Resource/Resources)
+	Group                    string            `yaml:"group"`                       // name of a scenario groups entry supplying caller, context and resource owner defaults
+	Context                  []ContextEntryYml `yaml:"context"`                     // optional context for this specific test
+	ResourcePolicyTemplate   string            `yaml:"resource_policy_template"`    // optional resource policy template for this test
+	ResourcePolicyJSON       string            `yaml:"resource_policy_json"`        // optional resource policy for this test
+	CallerArn                string            `yaml:"caller_arn"`                  // optional caller ARN override for this test
+	CallerArns               []string          `yaml:"caller_arns"`                 // optional: run the test once per caller ARN (use this OR caller_arn)
+	ResourceOwner            string            `yaml:"resource_owner"`              // optional resource owner override for this test
+	ResourceHandlingOption   string            `yaml:"resource_handling_option"`    // optional EC2 scenario override for this test
+	ServicePrincipal         string            `yaml:"service_principal"`           // optional service principal override for this test
+	Region                   string            `yaml:"region"`                      // optional region override for this test (aws:RequestedRegion)
+	CrossAccount             *CrossAccount     `yaml:"cross_account"`               // optional: caller and resource in different accounts (sets resource owner, caller and account context)
+	RequestTags              map[string]string `yaml:"request_tags"`                // optional tags expanded to aws:RequestTag/<key> (and aws:TagKeys) context
+	ResourceTags             map[string]string `yaml:"resource_tags"`               // optional tags expanded to aws:ResourceTag/<key> context
+	SecureTransport          *bool             `yaml:"secure_transport"`            // optional shortcut for aws:SecureTransport context
+	MFA                      *bool             `yaml:"mfa"`                         // optional shortcut for aws:MultiFactorAuthPresent context
+	SourceIP                 string            `yaml:"source_ip"`                   // optional shortcut for aws:SourceIp context
+	MFAAge                   *int              `yaml:"mfa_age"`                     // optional shortcut for aws:MultiFactorAuthAge context (seconds since MFA)
+	TokenIssueTime           string            `yaml:"token_issue_time"`            // optional shortcut for aws:TokenIssueTime context (RFC 3339)
+	Expect                   string            `yaml:"expect"`                      // expected decision: allowed, explicitDeny, implicitDeny
+	ExpectIf                 []ExpectIf        `yaml:"expect_if"`                   // optional: the first entry whose vars match replaces expect
+	ExpectDetails            map[string]string `yaml:"expect_details"`              // optional per-source decisions: IdentityPolicy, PermissionsBoundary, ResourcePolicy
+	ExpectReason             string            `yaml:"expect_reason"`               // optional rationale for the expectation, printed on failure
+	FailureMessage           string            `yaml:"failure_message"`             // optional text/template printed instead of the failure details (see failureMessageData)
+	ExpectMatchedSid         string            `yaml:"expect_matched_sid"`          // optional: the matched statements must resolve to exactly this source Sid
+	ExpectMatchedSidContains string            `yaml:"expect_matched_sid_contains"` // optional: this source Sid must be among the matched statements
+	ExpectMatchedSourceFile  string            `yaml:"expect_matched_source_file"`  // optional: a matched statement must come from this file (compared by base name)
+	TruthTable               []TruthTableRow   `yaml:"truth_table"`                 // optional: one simulation per row of context values, each with its own expect
+	Tags                     []string          `yaml:"tags"`                        // optional labels (e.g. concern or ticket) used by --group-by tag
+	Severity                 string            `yaml:"severity"`                    // optional: critical, high, medium or low, compared against --fail-on-severity
+
+	truthTable    string // truth table name, set on tests expanded from a truth_table row
+	truthTableRow string // the row's context values, e.g. "aws:MultiFactorAuthPresent=true"
+}
+
+// TestGroup is a named bundle of request settings shared by the tests that reference it
+// Each setting applies unless the test sets its own; group context overlays scenario context by key
+type TestGroup struct {
+	CallerArn     string            `yaml:"caller_arn"`     // caller ARN for the group's tests
+	Context       []ContextEntryYml `yaml:"context"`        // context entries for the group's tests
+	ResourceOwner string            `yaml:"resource_owner"` // resource owner for the group's tests
+}
+
+// ExpectIf is one expect_if entry: an expectation that applies when the active vars match
+type ExpectIf struct {
+	Vars   map[string]string `yaml:"vars"`   // var name -> value; every entry must equal the var (compared as text)
+	Expect string            `yaml:"expect"` // expected decision when the vars match
+}
+
+// CrossAccount describes a caller in one account accessing a resource owned by another
+type CrossAccount struct {
+	ResourceAccount string `yaml:"resource_account"` // 12-digit account ID that owns the resource
+	CallerAccount   string `yaml:"caller_account"`   // 12-digit account ID of the calling principal
+}
+
+// TruthTableRow is one row of a test's truth_table: context values and the decision they should produce
+type TruthTableRow struct {
+	Context map[string]string `yaml:"context"` // context key -> "value[:type]", the same syntax as --context
+	Expect  string            `yaml:"expect"`  // expected decision for this row (defaults to the test's expect)
 }
 
 // ContextEntryYml represents a context key-value pair from YAML
@@ -43,14 +119,44 @@ type ContextEntryYml struct {
 // SimulatorConfig holds configuration for running policy simulations
 type SimulatorConfig struct {
 	PolicyJSON          string
-	PermissionsBoundary string
+	AdditionalPolicies  []string // Additional identity policies (from policy_paths) sent after PolicyJSON
+	PermissionsBoundary string   // Merged SCP/RCP document
+	IdentityBoundary    string   // permissions_boundary policy; simulated in a separate pass when SCPs are also set
 	ResourcePolicyJSON  string
 	ScenarioPath        string // Only used by RunTestCollection
 	TestFilter          string
 	Variables           map[string]any
+	GlobalContext       []ContextEntryYml // Context from --context, applied to every test at the lowest precedence
 	SavePath            string
+	SaveFullPath        string // Save simulation inputs alongside responses
+	SaveDir             string // Save each test's raw response to its own file in this directory
 	NoAssert            bool
+	FailOnSeverity      string           // Only failures at or above this severity fail the run (empty: all do)
+	NoWarn              bool             // Suppress per-test warnings (e.g. wildcard actions)
 	ShowMatchedSuccess  bool             // Show matched statements for passing tests
+	RawMatchOrder       bool             // Preserve AWS ordering of matched statements instead of sorting
+	DedupeMatches       bool             // Collapse matched statements that resolve to the same source
+	DedupeNames         bool             // Suffix duplicate test names with their action instead of rejecting them
+	ExplainDeniesOnly   bool             // Show matched statements for passing tests only when the decision is a deny
+	ShowStatementJSON   bool             // Print each matched statement's JSON as submitted, alongside its source lines
+	StrictMatches       bool             // Fail allowed tests that have no matched statements
+	Coverage            bool             // Print the unique actions and resources exercised by the run
+	NoSummary           bool             // Don't print the "Test Results" summary (exit codes are unaffected)
+	SummaryStderr       bool             // Print the "Test Results" summary on Stderr instead of Stdout
+	Format              string           // Output format: FormatText (default), FormatJSONL or FormatConsole
+	Progress            bool             // Draw a progress bar on Stderr instead of per-test output; failures print after it
+	CompactOutput       bool             // One line per test; the detail block only for failures and requested matched detail
+	GroupBy             string           // Print per-test output under headers by GroupByAction, GroupByResource, GroupByDecision or GroupByTag
+	TemplateFile        string           // Render results through this text/template after the run (see ReportData)
+	MaxFailures         int              // Stop running tests after this many failures (0 = unlimited)
+	RetryOnDenyAttempts int              // Re-run tests expecting allowed that were denied, up to this many times (0 = off)
+	RetryOnDenyDelay    time.Duration    // Wait between RetryOnDenyAttempts
+	Shuffle             bool             // Run the expanded tests in a random order
+	ShuffleSeed         int64            // Seed for Shuffle, printed so an order can be reproduced
+	WebhookURL          string           // POST a JSON run summary here after the run (optional)
+	WebhookOn           string           // When to notify: WebhookOnFailure (default) or WebhookOnAlways
+	Redact              bool             // Mask account IDs and ARN resources in the webhook payload, as --redact does for output
+	Metrics             *RunMetrics      // Collects counts for --metrics-file (optional)
 	SourceMap           *PolicySourceMap // Tracks where statements came from
 }
 
@@ -58,12 +164,25 @@ type SimulatorConfig struct {
 type PolicySourceMap struct {
 	Identity               map[string]*PolicySource // Map of tracking Sid -> source for identity policy statements
 	PermissionsBoundary    map[string]*PolicySource // Map of tracking Sid -> source for SCP/RCP statements
-	ResourcePolicy         *PolicySource            // Resource policy source (scenario-level)
+	Resource               map[string]*PolicySource // Map of tracking Sid -> source for resource policy statements
+	ResourcePolicy         *PolicySource            // Resource policy source (scenario-level), used when a statement can't be tracked
+	AdditionalPolicies     []*TrackedPolicy         // policy_paths entries, in PolicyInputList order after the main policy
+	IdentityBoundary       map[string]*PolicySource // Map of tracking Sid -> source for permissions_boundary statements
 	PermissionsBoundaryRaw string                   // Raw merged JSON sent to AWS
+	IdentityBoundaryRaw    string                   // Raw permissions_boundary JSON sent to AWS
+	BoundaryLayer          string                   // Layer PermissionsBoundaryPolicyInputList refers to when a permissions boundary is set
 	IdentityPolicyRaw      string                   // Raw identity policy JSON sent to AWS
 	ResourcePolicyRaw      string                   // Raw resource policy JSON sent to AWS
 }
 
+// TrackedPolicy is an additional identity policy with its own, independent source map
+// Each policy_paths file is tracked separately so matches attribute to the right file and lines
+type TrackedPolicy struct {
+	Source     *PolicySource            // File path or managed policy ARN, used when a statement can't be tracked
+	Raw        string                   // Policy JSON sent to AWS (with tracking Sids for files)
+	Statements map[string]*PolicySource // Map of tracking Sid -> statement source (nil for managed policies)
+}
+
 // PolicySource tracks where a policy or statement originated
 type PolicySource struct {
 	FilePath  string // Original file path
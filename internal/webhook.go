@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Webhook triggers accepted by --webhook-on
+const (
+	WebhookOnFailure = "failure"
+	WebhookOnAlways  = "always"
+)
+
+// WebhookClient is the HTTP client used to post run summaries; replaceable for testing
+var WebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookPayload is the JSON summary POSTed to --webhook-url after a run
+type webhookPayload struct {
+	Scenario    string            `json:"scenario"`
+	Passed      int               `json:"passed"`
+	Failed      int               `json:"failed"`
+	Skipped     int               `json:"skipped"`
+	FailedTests []string          `json:"failed_tests"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// notifyWebhookIfRequested posts a run summary to cfg.WebhookURL
+// Delivery problems are warnings only: they never change the run's outcome
+func notifyWebhookIfRequested(cfg SimulatorConfig, metadata map[string]string, results []testResult, skipped int) {
+	if cfg.WebhookURL == "" {
+		return
+	}
+
+	payload := webhookPayload{Scenario: cfg.ScenarioPath, Skipped: skipped, FailedTests: []string{}, Metadata: metadata}
+	for _, r := range results {
+		if r.Passed {
+			payload.Passed++
+		} else {
+			payload.Failed++
+			payload.FailedTests = append(payload.FailedTests, r.Name)
+		}
+	}
+	if payload.Failed == 0 && cfg.WebhookOn != WebhookOnAlways {
+		return
+	}
+	if cfg.Redact {
+		payload = payload.redacted()
+	}
+
+	if err := postWebhook(cfg.WebhookURL, payload); err != nil {
+		fmt.Fprintf(Stderr, "Warning: webhook notification failed: %v\n", err)
+	}
+}
+
+// redacted masks account IDs and ARN resources in the payload, matching --redact output
+func (p webhookPayload) redacted() webhookPayload {
+	p.Scenario = RedactText(p.Scenario)
+	failed := make([]string, 0, len(p.FailedTests))
+	for _, name := range p.FailedTests {
+		failed = append(failed, RedactText(name))
+	}
+	p.FailedTests = failed
+	if p.Metadata != nil {
+		metadata := make(map[string]string, len(p.Metadata))
+		for k, v := range p.Metadata {
+			metadata[k] = RedactText(v)
+		}
+		p.Metadata = metadata
+	}
+	return p
+}
+
+// postWebhook sends the payload as JSON and treats any non-2xx status as an error
+func postWebhook(url string, payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := WebhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNotifyWebhookIfRequested(t *testing.T) {
+	results := []testResult{
+		{Name: "read allowed", Passed: true},
+		{Name: "delete denied", Passed: false},
+	}
+
+	var received []webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected JSON content type, got %q", r.Header.Get("Content-Type"))
+		}
+		var p webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		received = append(received, p)
+	}))
+	defer server.Close()
+
+	cfg := SimulatorConfig{ScenarioPath: "/tmp/s3.yml", WebhookURL: server.URL, WebhookOn: WebhookOnFailure}
+	notifyWebhookIfRequested(cfg, nil, results, 1)
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 notification, got %d", len(received))
+	}
+	p := received[0]
+	if p.Scenario != "/tmp/s3.yml" || p.Passed != 1 || p.Failed != 1 || p.Skipped != 1 {
+		t.Errorf("Unexpected payload counts: %+v", p)
+	}
+	if len(p.FailedTests) != 1 || p.FailedTests[0] != "delete denied" {
+		t.Errorf("Expected failing test names, got %v", p.FailedTests)
+	}
+
+	// failure mode stays quiet when everything passed
+	received = nil
+	notifyWebhookIfRequested(cfg, nil, results[:1], 0)
+	if len(received) != 0 {
+		t.Errorf("Expected no notification for a passing run with --webhook-on failure")
+	}
+
+	cfg.WebhookOn = WebhookOnAlways
+	notifyWebhookIfRequested(cfg, nil, results[:1], 0)
+	if len(received) != 1 || received[0].FailedTests == nil {
+		t.Errorf("Expected notification with empty failed_tests for --webhook-on always, got %+v", received)
+	}
+
+	// --redact masks the payload before it leaves the machine
+	received = nil
+	cfg = SimulatorConfig{ScenarioPath: "/scenarios/123456789012/s3.yml", WebhookURL: server.URL, WebhookOn: WebhookOnFailure, Redact: true}
+	failing := []testResult{{Name: "s3:GetObject on arn:aws:s3:::payroll-bucket/*", Passed: false}}
+	notifyWebhookIfRequested(cfg, map[string]string{"owner": "arn:aws:iam::123456789012:role/team"}, failing, 0)
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 notification, got %d", len(received))
+	}
+	p = received[0]
+	if p.Scenario != "/scenarios/************/s3.yml" || p.FailedTests[0] != "s3:GetObject on arn:aws:s3:::***" || p.Metadata["owner"] != "arn:aws:iam::************:***" {
+		t.Errorf("Expected a redacted payload, got %+v", p)
+	}
+}
+
+func TestNotifyWebhookFailureWarns(t *testing.T) {
+	originalStderr := Stderr
+	defer func() { Stderr = originalStderr }()
+	var stderr strings.Builder
+	Stderr = &stderr
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	cfg := SimulatorConfig{WebhookURL: server.URL, WebhookOn: WebhookOnAlways}
+	notifyWebhookIfRequested(cfg, nil, []testResult{{Name: "t", Passed: true}}, 0)
+	if !strings.Contains(stderr.String(), "Warning: webhook notification failed") || !strings.Contains(stderr.String(), "500") {
+		t.Errorf("Expected webhook warning on stderr, got: %q", stderr.String())
+	}
+}
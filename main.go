@@ -2,19 +2,34 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"politest/internal"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer"
+	analyzertypes "github.com/aws/aws-sdk-go-v2/service/accessanalyzer/types"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
 // Build-time variables injected via -ldflags
@@ -33,20 +48,89 @@ func PrintVersion() {
 	fmt.Printf("  go version: %s\n", goVersion)
 }
 
+// versionInfo is the --version --json output
+type versionInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Built   string `json:"built"`
+	Go      string `json:"go"`
+}
+
+// PrintVersionJSON outputs version information to stdout as a single JSON object
+func PrintVersionJSON() {
+	b, _ := json.Marshal(versionInfo{Version: version, Commit: gitCommit, Built: buildDate, Go: goVersion})
+	fmt.Println(string(b))
+}
+
 // simulationPrep holds the prepared simulation data before AWS execution
 type simulationPrep struct {
 	scenario            *internal.Scenario
 	policyJSON          string
-	permissionsBoundary string
+	permissionsBoundary string // merged SCP/RCP document
+	identityBoundary    string // permissions_boundary document
+	boundaryARN         string // permissions_boundary managed policy ARN, fetched by resolveBoundaryPolicy
 	resourcePolicyJSON  string
 	variables           map[string]any
 	absScenarioPath     string
+	additionalPolicies  []additionalPolicy
+	policySizes         []policySize              // minified identity policy sizes, before tracking Sids
+	analyzerPolicies    []internal.AnalyzerPolicy // documents for --access-analyzer-validate and --lint, before tracking Sids
 	sourceMap           *internal.PolicySourceMap
+	disabled            bool // scenario has disabled: true and should be skipped
+}
+
+// policySize is the minified size of one identity policy document as written by the user
+type policySize struct {
+	source string // File path of the policy or template
+	bytes  int
+}
+
+// additionalPolicy is one policy_paths entry
+// Managed policy ARNs have an empty document until resolved against IAM in run()
+type additionalPolicy struct {
+	source     string // Absolute file path or managed policy ARN
+	document   string
+	size       int                               // minified size before tracking Sids (file entries only)
+	stripped   string                            // document before tracking Sids (file entries only)
+	statements map[string]*internal.PolicySource // per-statement sources for file entries
 }
 
 // prepareSimulation loads and prepares all data for simulation WITHOUT contacting AWS
 // This function is AWS-free and safe for unit testing
 func prepareSimulation(scenarioPath string, noWarn, debug, strictPolicy bool, debugWriter io.Writer) (*simulationPrep, error) {
+	return prepareSimulationWithInputs(scenarioPath, scenarioInputs{}, noWarn, debug, strictPolicy, debugWriter)
+}
+
+// scenarioInputs are inputs from outside the scenario files
+type scenarioInputs struct {
+	vars    map[string]any         // override vars_file and vars (a matrix cell)
+	scps    []internal.SCPDocument // merged after scp_paths (fetched with --from-org-account)
+	scpOnly string                 // --scp-only: use just this scp_paths file as the boundary
+}
+
+// prepareSimulationWithInputs is prepareSimulation with inputs from outside the scenario files
+func prepareSimulationWithInputs(scenarioPath string, inputs scenarioInputs, noWarn, debug, strictPolicy bool, debugWriter io.Writer) (*simulationPrep, error) {
+	prep, err := loadScenarioPoliciesWithInputs(scenarioPath, inputs, noWarn, debug, strictPolicy, debugWriter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate tests exist (either format counts)
+	scen := prep.scenario
+	if !prep.disabled && len(scen.Tests) == 0 && len(scen.Actions) == 0 && len(scen.AllowedActionsExactly) == 0 && len(scen.CandidateActions) == 0 {
+		return nil, fmt.Errorf("scenario must include 'tests' array with at least one test case (or a legacy 'actions' block, or allowed_actions_exactly)")
+	}
+	return prep, nil
+}
+
+// loadScenarioPolicies loads the scenario, variables and policies without requiring any tests
+// Used directly by --actions-from-policy, which bootstraps the tests
+func loadScenarioPolicies(scenarioPath string, noWarn, debug, strictPolicy bool, debugWriter io.Writer) (*simulationPrep, error) {
+	return loadScenarioPoliciesWithInputs(scenarioPath, scenarioInputs{}, noWarn, debug, strictPolicy, debugWriter)
+}
+
+// loadScenarioPoliciesWithInputs is loadScenarioPolicies with inputs from outside the scenario files
+func loadScenarioPoliciesWithInputs(scenarioPath string, inputs scenarioInputs, noWarn, debug, strictPolicy bool, debugWriter io.Writer) (*simulationPrep, error) {
 	if scenarioPath == "" {
 		return nil, fmt.Errorf("missing --scenario\nUsage: politest --scenario <path> [--save <path>] [--no-assert] [--no-warn] [--debug]")
 	}
@@ -69,23 +153,25 @@ func prepareSimulation(scenarioPath string, noWarn, debug, strictPolicy bool, de
 		fmt.Fprintf(debugWriter, "🔍 DEBUG: Scenario extends: %s\n", scen.Extends)
 	}
 
-	// Build vars: vars_file (if present), then inline vars override
-	allVars := map[string]any{}
-	if scen.VarsFile != "" {
-		base := filepath.Dir(absScenario)
-		vf := internal.MustAbsJoin(base, scen.VarsFile)
-		if debug {
-			fmt.Fprintf(debugWriter, "🔍 DEBUG: Loading variables from: %s\n", vf)
-		}
-		vmap := map[string]any{}
-		if err := internal.LoadYAML(vf, &vmap); err != nil {
+	// Disabled scenarios are skipped before any validation so WIP files don't need to be complete
+	if scen.Disabled {
+		return &simulationPrep{scenario: scen, absScenarioPath: absScenario, disabled: true}, nil
+	}
+
+	if scen.ExpectationsFile != "" {
+		if err := internal.ApplyExpectationsFile(scen, internal.MustAbsJoin(filepath.Dir(absScenario), scen.ExpectationsFile)); err != nil {
 			return nil, err
 		}
-		for k, v := range vmap {
-			allVars[k] = v
-		}
 	}
-	for k, v := range scen.Vars {
+
+	if debug && scen.VarsFile != "" {
+		fmt.Fprintf(debugWriter, "🔍 DEBUG: Loading variables from: %s\n", internal.MustAbsJoin(filepath.Dir(absScenario), scen.VarsFile))
+	}
+	allVars, err := scenarioVars(scen, absScenario)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range inputs.vars {
 		allVars[k] = v
 	}
 
@@ -96,6 +182,15 @@ func prepareSimulation(scenarioPath string, noWarn, debug, strictPolicy bool, de
 		}
 	}
 
+	if scen.BoundaryOnly {
+		if scen.PolicyJSON != "" || scen.PolicyTemplate != "" || len(scen.PolicyPaths) > 0 {
+			return nil, fmt.Errorf("boundary_only supplies its own identity policy; remove 'policy_json', 'policy_template' and 'policy_paths'")
+		}
+		if len(scen.SCPPaths) == 0 && len(inputs.scps) == 0 && scen.PermissionsBoundary == "" {
+			return nil, fmt.Errorf("boundary_only requires 'scp_paths', 'permissions_boundary' or --from-org-account: there is no boundary to test")
+		}
+	}
+
 	// Policy document: template or pre-rendered JSON
 	var policyJSON string
 	var identityPolicyPath string
@@ -115,7 +210,7 @@ func prepareSimulation(scenarioPath string, noWarn, debug, strictPolicy bool, de
 		}
 		var policyData any
 		if err := json.Unmarshal(b, &policyData); err != nil {
-			return nil, fmt.Errorf("invalid JSON in policy file %s: %v", p, err)
+			return nil, &internal.PolicyValidationError{Kind: "policy file", Path: p, Err: err}
 		}
 		policyJSON = internal.ToJSONPretty(policyData)
 	case scen.PolicyTemplate != "":
@@ -125,42 +220,95 @@ func prepareSimulation(scenarioPath string, noWarn, debug, strictPolicy bool, de
 		if debug {
 			fmt.Fprintf(debugWriter, "🔍 DEBUG: Loading policy template from: %s\n", tplPath)
 		}
-		policyJSON = internal.RenderTemplateFileJSON(tplPath, allVars)
+		if policyJSON, err = internal.RenderTemplateFile(tplPath, allVars); err != nil {
+			return nil, err
+		}
+	case len(scen.PolicyPaths) > 0:
+		// Identity policies come entirely from policy_paths
+	case scen.BoundaryOnly:
+		// Allow everything so results reflect only the SCPs/boundary; not source-tracked or size-checked
+		policyJSON = internal.BoundaryOnlyIdentityPolicy
 	default:
-		return nil, fmt.Errorf("scenario must include 'policy_json' or 'policy_template'")
+		return nil, fmt.Errorf("scenario must include 'policy_json', 'policy_template' or 'policy_paths'")
 	}
 
-	// Validate IAM fields if --strict-policy flag is set
-	if strictPolicy {
-		if err := internal.ValidateIAMFields(policyJSON); err != nil {
-			return nil, fmt.Errorf("identity policy validation failed:\n%v", err)
+	var identitySourceMap map[string]*internal.PolicySource
+	var sizes []policySize
+	var analyzerPolicies []internal.AnalyzerPolicy
+	if policyJSON != "" && !scen.BoundaryOnly {
+		// Validate IAM fields if --strict-policy flag is set
+		if strictPolicy {
+			if err := internal.ValidateIAMFields(policyJSON); err != nil {
+				return nil, fmt.Errorf("identity policy validation failed:\n%v", err)
+			}
 		}
-	}
 
-	// Always strip non-IAM fields before sending to AWS
-	policyJSON = internal.StripNonIAMFields(policyJSON)
+		// Always strip non-IAM fields before sending to AWS
+		if policyJSON, err = internal.StripNonIAMFields(policyJSON); err != nil {
+			return nil, &internal.PolicyValidationError{Kind: "policy", Path: identityPolicyPath, Err: err}
+		}
+		sizes = append(sizes, policySize{source: identityPolicyPath, bytes: len(internal.MinifyJSON([]byte(policyJSON)))})
+		analyzerPolicies = append(analyzerPolicies, internal.AnalyzerPolicy{Source: identityPolicyPath, Document: policyJSON, Type: analyzertypes.PolicyTypeIdentityPolicy})
 
-	if debug {
-		fmt.Fprintf(debugWriter, "🔍 DEBUG: Rendered policy (pretty-printed):\n%s\n", policyJSON)
+		if debug {
+			fmt.Fprintf(debugWriter, "🔍 DEBUG: Rendered policy (pretty-printed):\n%s\n", policyJSON)
+		}
+
+		// Process identity policy with source tracking (inject tracking Sids)
+		if policyJSON, identitySourceMap, err = internal.ProcessIdentityPolicyWithSourceMap(policyJSON, identityPolicyPath); err != nil {
+			return nil, err
+		}
 	}
 
-	// Process identity policy with source tracking (inject tracking Sids)
-	policyJSONWithTracking, identitySourceMap := internal.ProcessIdentityPolicyWithSourceMap(policyJSON, identityPolicyPath)
-	policyJSON = policyJSONWithTracking
+	additional, err := loadAdditionalPolicies(scen.PolicyPaths, filepath.Dir(absScenario), allVars, strictPolicy, debug, debugWriter)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range additional {
+		if p.size > 0 {
+			sizes = append(sizes, policySize{source: p.source, bytes: p.size})
+		}
+		if p.stripped != "" {
+			analyzerPolicies = append(analyzerPolicies, internal.AnalyzerPolicy{Source: p.source, Document: p.stripped, Type: analyzertypes.PolicyTypeIdentityPolicy})
+		}
+	}
 
 	// Merge SCPs (permissions boundary) with source tracking
 	var pbJSON string
 	var scpSourceMap map[string]*internal.PolicySource
-	if len(scen.SCPPaths) > 0 {
+	if inputs.scpOnly != "" && len(scen.SCPPaths) == 0 {
+		return nil, fmt.Errorf("--scp-only %s: the scenario has no scp_paths", inputs.scpOnly)
+	}
+	if len(scen.SCPPaths) > 0 || len(inputs.scps) > 0 {
 		files := internal.ExpandGlobsRelative(filepath.Dir(absScenario), scen.SCPPaths)
-		if debug {
-			fmt.Fprintf(debugWriter, "🔍 DEBUG: Loading SCP/RCP files:\n")
-			for _, f := range files {
-				fmt.Fprintf(debugWriter, "  - %s\n", f)
+		var merged map[string]any
+		if inputs.scpOnly != "" {
+			file, err := selectSCPFile(files, inputs.scpOnly)
+			if err != nil {
+				return nil, err
+			}
+			if debug {
+				fmt.Fprintf(debugWriter, "🔍 DEBUG: Loading only SCP/RCP file (--scp-only): %s\n", file)
+			}
+			if merged, scpSourceMap, err = internal.MergeSCPFilesWithSourceMap([]string{file}); err != nil {
+				return nil, err
+			}
+		} else {
+			docs, err := internal.LoadSCPDocuments(files)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, inputs.scps...)
+			if debug {
+				fmt.Fprintf(debugWriter, "🔍 DEBUG: Loading SCP/RCP files:\n")
+				for _, d := range docs {
+					fmt.Fprintf(debugWriter, "  - %s\n", d.Name)
+				}
+			}
+			if merged, scpSourceMap, err = internal.MergeSCPDocumentsWithSourceMap(docs); err != nil {
+				return nil, err
 			}
 		}
-		merged, sourceMap := internal.MergeSCPFilesWithSourceMap(files)
-		scpSourceMap = sourceMap
 		pbJSON = internal.ToJSONPretty(merged)
 
 		// Validate IAM fields if --strict-policy flag is set
@@ -171,7 +319,10 @@ func prepareSimulation(scenarioPath string, noWarn, debug, strictPolicy bool, de
 		}
 
 		// Always strip non-IAM fields before sending to AWS
-		pbJSON = internal.StripNonIAMFields(pbJSON)
+		if pbJSON, err = internal.StripNonIAMFields(pbJSON); err != nil {
+			return nil, &internal.PolicyValidationError{Kind: "SCP", Path: "merged SCP/RCP document", Err: err}
+		}
+		analyzerPolicies = append(analyzerPolicies, internal.AnalyzerPolicy{Source: "merged SCP/RCP document", Document: pbJSON, Type: analyzertypes.PolicyTypeServiceControlPolicy})
 
 		// Warn that SCP simulation is an approximation (unless suppressed)
 		if !noWarn {
@@ -179,14 +330,60 @@ func prepareSimulation(scenarioPath string, noWarn, debug, strictPolicy bool, de
 		}
 	}
 
+	// Permissions boundary, kept apart from the SCPs so the simulator can run each as its own layer
+	// A managed policy ARN is fetched at run time, so the boundary tested is the one actually attached
+	var boundaryJSON, boundaryPath, boundaryARN string
+	var boundarySourceMap map[string]*internal.PolicySource
+	boundaryRef, err := internal.RenderTemplateText(scen.PermissionsBoundary, allVars)
+	if err != nil {
+		return nil, fmt.Errorf("permissions_boundary: %v", err)
+	}
+	if internal.IsManagedPolicyARN(boundaryRef) {
+		if debug {
+			fmt.Fprintf(debugWriter, "🔍 DEBUG: Managed permissions boundary to resolve: %s\n", boundaryRef)
+		}
+		boundaryARN = boundaryRef
+	} else if boundaryRef != "" {
+		boundaryPath = internal.MustAbsJoin(filepath.Dir(absScenario), boundaryRef)
+		if debug {
+			fmt.Fprintf(debugWriter, "🔍 DEBUG: Loading permissions boundary from: %s\n", boundaryPath)
+		}
+		b, err := os.ReadFile(boundaryPath)
+		if err != nil {
+			return nil, err
+		}
+		if b, err = internal.RenderJSONPlaceholders(boundaryPath, b, allVars); err != nil {
+			return nil, err
+		}
+		var boundaryData any
+		if err := json.Unmarshal(b, &boundaryData); err != nil {
+			return nil, &internal.PolicyValidationError{Kind: "permissions boundary file", Path: boundaryPath, Err: err}
+		}
+		boundaryJSON = internal.ToJSONPretty(boundaryData)
+		if strictPolicy {
+			if err := internal.ValidateIAMFields(boundaryJSON); err != nil {
+				return nil, fmt.Errorf("permissions boundary validation failed:\n%v", err)
+			}
+		}
+		if boundaryJSON, err = internal.StripNonIAMFields(boundaryJSON); err != nil {
+			return nil, &internal.PolicyValidationError{Kind: "permissions boundary file", Path: boundaryPath, Err: err}
+		}
+		analyzerPolicies = append(analyzerPolicies, internal.AnalyzerPolicy{Source: boundaryPath, Document: boundaryJSON, Type: analyzertypes.PolicyTypeIdentityPolicy})
+		if boundaryJSON, boundarySourceMap, err = internal.ProcessBoundaryPolicyWithSourceMap(boundaryJSON, boundaryPath); err != nil {
+			return nil, err
+		}
+	}
+
 	// Resource policy: template or pre-rendered JSON
 	var resourcePolicyJSON string
+	var resourcePolicyPath string
 	switch {
 	case scen.ResourcePolicyJSON != "" && scen.ResourcePolicyTemplate != "":
 		return nil, fmt.Errorf("provide only one of 'resource_policy_json' or 'resource_policy_template'")
 	case scen.ResourcePolicyJSON != "":
 		base := filepath.Dir(absScenario)
 		p := internal.MustAbsJoin(base, scen.ResourcePolicyJSON)
+		resourcePolicyPath = p
 		if debug {
 			fmt.Fprintf(debugWriter, "🔍 DEBUG: Loading resource policy from: %s\n", p)
 		}
@@ -194,18 +391,24 @@ func prepareSimulation(scenarioPath string, noWarn, debug, strictPolicy bool, de
 		if err != nil {
 			return nil, err
 		}
+		if b, err = internal.RenderJSONPlaceholders(p, b, allVars); err != nil {
+			return nil, err
+		}
 		var resourcePolicyData any
 		if err := json.Unmarshal(b, &resourcePolicyData); err != nil {
-			return nil, fmt.Errorf("invalid JSON in resource policy file %s: %v", p, err)
+			return nil, &internal.PolicyValidationError{Kind: "resource policy file", Path: p, Err: err}
 		}
 		resourcePolicyJSON = internal.ToJSONPretty(resourcePolicyData)
 	case scen.ResourcePolicyTemplate != "":
 		base := filepath.Dir(absScenario)
 		tplPath := internal.MustAbsJoin(base, scen.ResourcePolicyTemplate)
+		resourcePolicyPath = tplPath
 		if debug {
 			fmt.Fprintf(debugWriter, "🔍 DEBUG: Loading resource policy template from: %s\n", tplPath)
 		}
-		resourcePolicyJSON = internal.RenderTemplateFileJSON(tplPath, allVars)
+		if resourcePolicyJSON, err = internal.RenderTemplateFile(tplPath, allVars); err != nil {
+			return nil, err
+		}
 	}
 
 	// Validate and strip resource policy if present
@@ -218,16 +421,22 @@ func prepareSimulation(scenarioPath string, noWarn, debug, strictPolicy bool, de
 		}
 
 		// Always strip non-IAM fields before sending to AWS
-		resourcePolicyJSON = internal.StripNonIAMFields(resourcePolicyJSON)
+		if resourcePolicyJSON, err = internal.StripNonIAMFields(resourcePolicyJSON); err != nil {
+			return nil, &internal.PolicyValidationError{Kind: "resource policy", Path: resourcePolicyPath, Err: err}
+		}
+		analyzerPolicies = append(analyzerPolicies, internal.AnalyzerPolicy{Source: resourcePolicyPath, Document: resourcePolicyJSON, Type: analyzertypes.PolicyTypeResourcePolicy})
 	}
 
 	if debug && resourcePolicyJSON != "" {
 		fmt.Fprintf(debugWriter, "🔍 DEBUG: Rendered resource policy (pretty-printed):\n%s\n", resourcePolicyJSON)
 	}
 
-	// Validate tests exist
-	if len(scen.Tests) == 0 {
-		return nil, fmt.Errorf("scenario must include 'tests' array with at least one test case")
+	// Process resource policy with source tracking (inject tracking Sids)
+	var resourceSourceMap map[string]*internal.PolicySource
+	if resourcePolicyJSON != "" {
+		if resourcePolicyJSON, resourceSourceMap, err = internal.ProcessResourcePolicyWithSourceMap(resourcePolicyJSON, resourcePolicyPath); err != nil {
+			return nil, err
+		}
 	}
 
 	// Build source map for tracking policy origins
@@ -240,23 +449,18 @@ func prepareSimulation(scenarioPath string, noWarn, debug, strictPolicy bool, de
 	sourceMap := &internal.PolicySourceMap{
 		Identity:               identitySourceMap,
 		PermissionsBoundary:    scpSourceMap,
+		Resource:               resourceSourceMap,
+		IdentityBoundary:       boundarySourceMap,
 		PermissionsBoundaryRaw: pbJSON,
+		IdentityBoundaryRaw:    boundaryJSON,
 		IdentityPolicyRaw:      policyJSON,
 		ResourcePolicyRaw:      resourcePolicyJSON,
 	}
 
 	// Track resource policy source if available
-	if scen.ResourcePolicyJSON != "" {
-		base := filepath.Dir(absScenario)
-		policyPath := internal.MustAbsJoin(base, scen.ResourcePolicyJSON)
-		sourceMap.ResourcePolicy = &internal.PolicySource{
-			FilePath: policyPath,
-		}
-	} else if scen.ResourcePolicyTemplate != "" {
-		base := filepath.Dir(absScenario)
-		policyPath := internal.MustAbsJoin(base, scen.ResourcePolicyTemplate)
+	if resourcePolicyPath != "" {
 		sourceMap.ResourcePolicy = &internal.PolicySource{
-			FilePath: policyPath,
+			FilePath: resourcePolicyPath,
 		}
 	}
 
@@ -264,124 +468,1544 @@ func prepareSimulation(scenarioPath string, noWarn, debug, strictPolicy bool, de
 		scenario:            scen,
 		policyJSON:          policyJSON,
 		permissionsBoundary: pbJSON,
+		identityBoundary:    boundaryJSON,
+		boundaryARN:         boundaryARN,
 		resourcePolicyJSON:  resourcePolicyJSON,
 		variables:           allVars,
 		absScenarioPath:     absScenario,
+		additionalPolicies:  additional,
+		policySizes:         sizes,
+		analyzerPolicies:    analyzerPolicies,
 		sourceMap:           sourceMap,
 	}, nil
 }
 
+// scenarioVars builds the template variables: vars_file (if present), then inline vars override
+func scenarioVars(scen *internal.Scenario, absScenario string) (map[string]any, error) {
+	allVars := map[string]any{}
+	if scen.VarsFile != "" {
+		vmap := map[string]any{}
+		if err := internal.LoadYAML(internal.MustAbsJoin(filepath.Dir(absScenario), scen.VarsFile), &vmap); err != nil {
+			return nil, err
+		}
+		for k, v := range vmap {
+			allVars[k] = v
+		}
+	}
+	for k, v := range scen.Vars {
+		allVars[k] = v
+	}
+	return allVars, nil
+}
+
+// loadAdditionalPolicies reads the policy_paths entries in order
+// File entries (globs allowed) are loaded now; managed policy ARNs are left for resolveAdditionalPolicies
+func loadAdditionalPolicies(refs []string, baseDir string, vars map[string]any, strictPolicy, debug bool, debugWriter io.Writer) ([]additionalPolicy, error) {
+	var out []additionalPolicy
+	for _, ref := range refs {
+		rendered, err := internal.RenderTemplateText(ref, vars)
+		if err != nil {
+			return nil, fmt.Errorf("policy_paths entry %q: %v", ref, err)
+		}
+		ref = rendered
+		if internal.IsManagedPolicyARN(ref) {
+			if debug {
+				fmt.Fprintf(debugWriter, "🔍 DEBUG: Managed policy to resolve: %s\n", ref)
+			}
+			out = append(out, additionalPolicy{source: ref})
+			continue
+		}
+		files := internal.ExpandGlobsRelative(baseDir, []string{ref})
+		if len(files) == 0 {
+			return nil, fmt.Errorf("policy_paths entry %q matched no files", ref)
+		}
+		for _, p := range files {
+			if debug {
+				fmt.Fprintf(debugWriter, "🔍 DEBUG: Loading additional policy from: %s\n", p)
+			}
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return nil, err
+			}
+			var policyData any
+			if err := json.Unmarshal(b, &policyData); err != nil {
+				return nil, &internal.PolicyValidationError{Kind: "policy file", Path: p, Err: err}
+			}
+			doc := internal.ToJSONPretty(policyData)
+			if strictPolicy {
+				if err := internal.ValidateIAMFields(doc); err != nil {
+					return nil, fmt.Errorf("policy %s validation failed:\n%v", p, err)
+				}
+			}
+			// Each file gets its own source map so matches resolve to the right file and lines
+			stripped, err := internal.StripNonIAMFields(doc)
+			if err != nil {
+				return nil, &internal.PolicyValidationError{Kind: "policy file", Path: p, Err: err}
+			}
+			tracked, statements, err := internal.ProcessIdentityPolicyWithSourceMap(stripped, p)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, additionalPolicy{source: p, document: tracked, size: len(internal.MinifyJSON([]byte(stripped))), stripped: stripped, statements: statements})
+		}
+	}
+	return out, nil
+}
+
+// resolveAdditionalPolicies fetches any managed policy ARNs and returns the documents with their source maps
+func resolveAdditionalPolicies(ctx context.Context, fetcher *internal.ManagedPolicyFetcher, policies []additionalPolicy) ([]string, []*internal.TrackedPolicy, error) {
+	docs := make([]string, 0, len(policies))
+	tracked := make([]*internal.TrackedPolicy, 0, len(policies))
+	for _, p := range policies {
+		doc := p.document
+		if doc == "" {
+			fetched, err := fetcher.Fetch(ctx, p.source)
+			if err != nil {
+				return nil, nil, err
+			}
+			doc = fetched
+		}
+		docs = append(docs, doc)
+		tracked = append(tracked, &internal.TrackedPolicy{
+			Source:     &internal.PolicySource{FilePath: p.source},
+			Raw:        doc,
+			Statements: p.statements,
+		})
+	}
+	return docs, tracked, nil
+}
+
+// resolveBoundaryPolicy fetches a permissions_boundary given as a managed policy ARN
+// The document is tracked like a boundary file, with matched statements attributed to the ARN
+func resolveBoundaryPolicy(ctx context.Context, fetcher *internal.ManagedPolicyFetcher, prep *simulationPrep) error {
+	if prep.boundaryARN == "" {
+		return nil
+	}
+	doc, err := fetcher.Fetch(ctx, prep.boundaryARN)
+	if err != nil {
+		return fmt.Errorf("permissions_boundary: %v", err)
+	}
+	if doc, err = internal.StripNonIAMFields(doc); err != nil {
+		return &internal.PolicyValidationError{Kind: "permissions boundary", Path: prep.boundaryARN, Err: err}
+	}
+	prep.identityBoundary, prep.sourceMap.IdentityBoundary, err = internal.ProcessBoundaryDocumentWithSourceMap(doc, prep.boundaryARN)
+	if err != nil {
+		return err
+	}
+	prep.sourceMap.IdentityBoundaryRaw = prep.identityBoundary
+	return nil
+}
+
 // run contains the main application logic and returns an error instead of calling Die()
-func run(scenarioPath, savePath string, noAssert, noWarn, debug, strictPolicy, showMatchedSuccess bool, testFilter string, debugWriter io.Writer) error {
-	// Prepare simulation data (AWS-free)
-	prep, err := prepareSimulation(scenarioPath, noWarn, debug, strictPolicy, debugWriter)
+func run(flags *cliFlags, debugWriter io.Writer) error {
+	// --fail-on-warnings counts only this scenario's warnings, as --scenarios-dir and matrix cells run it repeatedly
+	warningsBefore := internal.WarningCount()
+	if flags.listScenarios {
+		return listScenarios(flags.scenariosDir)
+	}
+	if flags.scenariosDir != "" {
+		return runScenariosDir(flags, debugWriter)
+	}
+	if flags.explainMerge {
+		return explainMerge(flags.scenarioPath)
+	}
+
+	if flags.actionsFromPolicy != "" {
+		prep, err := loadScenarioPolicies(flags.scenarioPath, flags.noWarn, flags.debug, flags.strictPolicy, debugWriter)
+		if err != nil {
+			return err
+		}
+		if prep.disabled {
+			fmt.Fprintf(internal.Stdout, "SKIP: scenario %s is disabled\n", prep.absScenarioPath)
+			return nil
+		}
+		return generateTestsFromPolicy(prep, flags.actionsFromPolicy)
+	}
+
+	if flags.matrixCell == nil {
+		cells, err := scenarioMatrix(flags)
+		if err != nil {
+			return err
+		}
+		if len(cells) > 0 {
+			return runMatrix(flags, cells, debugWriter)
+		}
+	}
+
+	inputs := scenarioInputs{vars: flags.matrixCell.Vars(), scpOnly: flags.scpOnly}
+	if flags.fromOrgAccount != "" {
+		scps, err := fetchOrgSCPs(flags)
+		if err != nil {
+			return err
+		}
+		inputs.scps = scps
+	}
+
+	// Prepare simulation data (AWS-free apart from the SCPs fetched above)
+	prep, err := prepareSimulationWithInputs(flags.scenarioPath, inputs, flags.noWarn, flags.debug, flags.strictPolicy, debugWriter)
 	if err != nil {
 		return err
 	}
+	if prep.disabled {
+		fmt.Fprintf(internal.Stdout, "SKIP: scenario %s is disabled\n", prep.absScenarioPath)
+		return nil
+	}
+	if err := checkPolicySizes(prep.policySizes, flags.maxPolicyBytes); err != nil {
+		return err
+	}
+	if flags.dumpMergedSCP != "" {
+		if err := dumpMergedSCP(flags.dumpMergedSCP, prep.sourceMap); err != nil {
+			return err
+		}
+	}
+	if flags.lint {
+		if err := lintPolicies(prep, flags.lintDisable); err != nil {
+			return err
+		}
+	}
 
 	// AWS client setup
-	awsCfg, err := config.LoadDefaultConfig(context.Background())
+	awsCfg, err := config.LoadDefaultConfig(context.Background(), awsConfigOptions(flags.profile)...)
 	if err != nil {
 		return err
 	}
 	client := iam.NewFromConfig(awsCfg)
 
+	if flags.accessAnalyzerValidate {
+		if reason := analyzerSkipReason(context.Background(), awsCfg); reason != "" {
+			internal.Warn("Warning: skipping --access-analyzer-validate: %s\n", reason)
+		} else if err := internal.ValidatePoliciesWithAnalyzer(context.Background(), accessanalyzer.NewFromConfig(awsCfg), prep.analyzerPolicies); err != nil {
+			return err
+		}
+	}
+
+	fetcher := internal.NewManagedPolicyFetcher(client)
+	additionalDocs, additionalTracked, err := resolveAdditionalPolicies(context.Background(), fetcher, prep.additionalPolicies)
+	if err != nil {
+		return err
+	}
+	prep.sourceMap.AdditionalPolicies = additionalTracked
+	if err := resolveBoundaryPolicy(context.Background(), fetcher, prep); err != nil {
+		return err
+	}
+
+	globalContext := make([]internal.ContextEntryYml, 0, len(flags.contexts))
+	for _, c := range flags.contexts {
+		entry, err := internal.ParseContextFlag(c)
+		if err != nil {
+			return err
+		}
+		globalContext = append(globalContext, entry)
+	}
+
 	// Build simulator configuration
 	simCfg := internal.SimulatorConfig{
 		PolicyJSON:          prep.policyJSON,
+		AdditionalPolicies:  additionalDocs,
 		PermissionsBoundary: prep.permissionsBoundary,
+		IdentityBoundary:    prep.identityBoundary,
 		ResourcePolicyJSON:  prep.resourcePolicyJSON,
 		ScenarioPath:        prep.absScenarioPath,
 		Variables:           prep.variables,
-		SavePath:            savePath,
-		NoAssert:            noAssert,
-		ShowMatchedSuccess:  showMatchedSuccess,
+		GlobalContext:       globalContext,
+		SavePath:            flags.savePath,
+		SaveFullPath:        flags.saveFullPath,
+		SaveDir:             flags.saveDir,
+		NoAssert:            flags.noAssert,
+		FailOnSeverity:      flags.failOnSeverity,
+		NoWarn:              flags.noWarn,
+		ShowMatchedSuccess:  flags.showMatchedSuccess,
+		RawMatchOrder:       flags.rawMatchOrder,
+		DedupeMatches:       flags.dedupeMatches,
+		DedupeNames:         flags.dedupeNames,
+		ShowStatementJSON:   flags.showStatementJSON,
+		StrictMatches:       flags.strictMatches,
+		ExplainDeniesOnly:   flags.explainDeniesOnly,
+		Coverage:            flags.coverage,
+		NoSummary:           flags.noSummary,
+		SummaryStderr:       flags.summaryStderr,
+		Format:              flags.format,
+		GroupBy:             flags.groupBy,
+		Progress:            flags.progress && !flags.debug && isTerminal(os.Stderr),
+		CompactOutput:       flags.compactOutput,
+		TemplateFile:        flags.templateFile,
+		MaxFailures:         flags.maxFailures,
+		RetryOnDenyAttempts: flags.retryOnDeny.attempts,
+		RetryOnDenyDelay:    flags.retryOnDeny.delay,
+		Shuffle:             flags.shuffle.enabled,
+		ShuffleSeed:         shuffleSeed(flags.shuffle),
+		WebhookURL:          flags.webhookURL,
+		WebhookOn:           flags.webhookOn,
+		Redact:              flags.redact,
+		Metrics:             flags.metrics,
 		SourceMap:           prep.sourceMap,
-		TestFilter:          testFilter,
+		TestFilter:          flags.tests,
 	}
 
 	// Run tests
-	internal.RunTestCollection(client, prep.scenario, simCfg)
+	if err := internal.RunTests(client, prep.scenario, simCfg); err != nil {
+		return err
+	}
+	if warnings := internal.WarningCount() - warningsBefore; flags.failOnWarnings && warnings > 0 {
+		return fmt.Errorf("%d warning(s) emitted and --fail-on-warnings is set", warnings)
+	}
 	return nil
 }
 
-// cliFlags holds the parsed command-line flags
-type cliFlags struct {
-	scenarioPath       string
-	savePath           string
-	noAssert           bool
-	noWarn             bool
-	showVersion        bool
-	debug              bool
-	strictPolicy       bool
-	showMatchedSuccess bool
-	tests              string // comma-separated list of test names to run
+// lintPolicies runs the --lint rules over each identity policy document and the scenario's test resources
+// and reports findings as warnings
+func lintPolicies(prep *simulationPrep, disable []string) error {
+	disabled := map[string]bool{}
+	for _, rule := range disable {
+		disabled[rule] = true
+	}
+	var findings []internal.LintFinding
+	for _, p := range prep.analyzerPolicies {
+		if p.Type != analyzertypes.PolicyTypeIdentityPolicy {
+			continue
+		}
+		policyFindings, err := internal.LintPolicy(p.Document, p.Source, disabled)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, policyFindings...)
+	}
+	resourceFindings, err := internal.LintTestResources(prep.scenario, prep.variables, prep.analyzerPolicies, disabled)
+	if err != nil {
+		return err
+	}
+	for _, f := range append(findings, resourceFindings...) {
+		internal.Warn("Lint [%s] %s\n", f.Rule, f.Message)
+	}
+	return nil
 }
 
-// parseFlags parses command-line arguments and returns flags or error
-func parseFlags(args []string) (*cliFlags, []string, error) {
-	fs := flag.NewFlagSet("politest", flag.ContinueOnError)
-
-	flags := &cliFlags{}
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
-	fs.StringVar(&flags.scenarioPath, "scenario", "", "Path to scenario YAML")
-	fs.StringVar(&flags.savePath, "save", "", "Path to save raw JSON response")
-	fs.BoolVar(&flags.noAssert, "no-assert", false, "Do not fail on expectation mismatches")
-	fs.BoolVar(&flags.noWarn, "no-warn", false, "Suppress SCP/RCP simulation approximation warning")
-	fs.BoolVar(&flags.debug, "debug", false, "Show debug output (files loaded, variables, rendered policies)")
-	fs.BoolVar(&flags.showMatchedSuccess, "show-matched-success", false, "Show matched statements for passing tests")
-	fs.BoolVar(&flags.showVersion, "version", false, "Show version information and exit")
-	fs.StringVar(&flags.tests, "test", "", "Comma-separated list of test names to run (runs all if empty)")
-	fs.BoolVar(&flags.strictPolicy, "strict-policy", false, "Fail if policies contain non-IAM fields")
+// selectSCPFile picks the --scp-only file from the scenario's expanded scp_paths
+// The name matches a file's path (relative to the working directory) or, if unambiguous, its base name
+func selectSCPFile(files []string, name string) (string, error) {
+	if abs, err := filepath.Abs(name); err == nil && slices.Contains(files, abs) {
+		return abs, nil
+	}
+	var matches []string
+	for _, f := range files {
+		if filepath.Base(f) == name {
+			matches = append(matches, f)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return "", fmt.Errorf("--scp-only %s: not one of the scenario's scp_paths files:\n  %s", name, strings.Join(files, "\n  "))
+	default:
+		return "", fmt.Errorf("--scp-only %s: matches more than one scp_paths file; give the path instead:\n  %s", name, strings.Join(matches, "\n  "))
+	}
+}
 
-	if err := fs.Parse(args); err != nil {
-		return nil, nil, err
+// summaryWriter is where the --scenarios-dir and matrix summaries go under --no-summary / --summary-stderr
+func summaryWriter(flags *cliFlags) io.Writer {
+	switch {
+	case flags.noSummary:
+		return io.Discard
+	case flags.summaryStderr:
+		return internal.Stderr
+	default:
+		return internal.Stdout
 	}
+}
 
-	return flags, fs.Args(), nil
+// fetchOrgSCPs pulls the SCPs that apply to --from-org-account from AWS Organizations
+func fetchOrgSCPs(flags *cliFlags) ([]internal.SCPDocument, error) {
+	ctx := context.Background()
+	awsCfg, err := config.LoadDefaultConfig(ctx, awsConfigOptions(flags.profile)...)
+	if err != nil {
+		return nil, err
+	}
+	scps, err := internal.FetchAccountSCPs(ctx, organizations.NewFromConfig(awsCfg), flags.fromOrgAccount)
+	if err != nil {
+		return nil, fmt.Errorf("--from-org-account %s: %w", flags.fromOrgAccount, err)
+	}
+	if len(scps) == 0 {
+		return nil, fmt.Errorf("--from-org-account %s: no SCPs are attached to the account or its OUs (are SCPs enabled for the organization?)", flags.fromOrgAccount)
+	}
+	return scps, nil
 }
 
-// validateArgs checks for unknown positional arguments
-func validateArgs(args []string) error {
-	if len(args) > 0 {
-		return fmt.Errorf("unknown arguments: %v\nUse -h or --help for usage information", args)
+// analyzerSkipReason explains why Access Analyzer validation can't run, or returns "" if it can
+// Access Analyzer is a regional service, so a region is required as well as credentials
+func analyzerSkipReason(ctx context.Context, awsCfg aws.Config) string {
+	if awsCfg.Credentials == nil {
+		return "no AWS credentials configured"
 	}
-	return nil
+	if _, err := awsCfg.Credentials.Retrieve(ctx); err != nil {
+		return fmt.Sprintf("no AWS credentials available (%v)", err)
+	}
+	if awsCfg.Region == "" {
+		return "no AWS region configured"
+	}
+	return ""
 }
 
-// realMain contains the full main logic and returns an exit code
-// This allows testing without calling os.Exit
-func realMain(args []string) int {
-	flags, remainingArgs, err := parseFlags(args)
+// runScenariosDir runs every scenario file in --scenarios-dir in path order
+// Test failures never stop the run; scenario errors do unless --keep-going is set
+func runScenariosDir(flags *cliFlags, debugWriter io.Writer) error {
+	files, err := findScenarioFiles(flags.scenariosDir)
 	if err != nil {
-		if err == flag.ErrHelp {
-			return 0
-		}
-		fmt.Fprintf(os.Stderr, "Error parsing flags: %v\n", err)
-		return 1
+		return err
 	}
-
-	// Handle --version flag
-	if flags.showVersion {
-		PrintVersion()
-		return 0
+	if len(files) == 0 {
+		return fmt.Errorf("no scenario files (*.yml, *.yaml with tests or actions) found in %s", flags.scenariosDir)
 	}
 
-	// Validate no unknown arguments
-	if err := validateArgs(remainingArgs); err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		return 1
+	var outcomes []scenarioProcess
+	if flags.parallelScenarios > 1 {
+		if outcomes, err = runScenarioProcesses(flags, files); err != nil {
+			return err
+		}
+	}
+
+	var passed, failed, errored []string
+	failedTests := 0
+	for i, f := range files {
+		name := f
+		if rel, err := filepath.Rel(flags.scenariosDir, f); err == nil {
+			name = rel
+		}
+		fmt.Fprintf(internal.Stdout, "=== %s ===\n", name)
+
+		var err error
+		if outcomes != nil {
+			err = outcomes[i].replay()
+		} else {
+			scenarioFlags := *flags
+			scenarioFlags.scenariosDir = ""
+			scenarioFlags.scenarioPath = f
+			err = run(&scenarioFlags, debugWriter)
+		}
+
+		var failure *internal.TestFailureError
+		switch {
+		case err == nil:
+			passed = append(passed, name)
+		case errors.As(err, &failure):
+			failed = append(failed, name)
+			failedTests += failure.Failed
+		case !flags.keepGoing:
+			return fmt.Errorf("%s: %w", name, err)
+		default:
+			internal.PrintError(internal.Stderr, fmt.Errorf("%s: %w", name, err))
+			errored = append(errored, fmt.Sprintf("%s: %v", name, err))
+		}
+		fmt.Fprintln(internal.Stdout)
+	}
+
+	summaryOut := summaryWriter(flags)
+	fmt.Fprintf(summaryOut, "Scenarios: %d ran (%d passed, %d failed), %d errored\n", len(passed)+len(failed), len(passed), len(failed), len(errored))
+	for _, group := range []struct {
+		title string
+		names []string
+	}{{"Errored", errored}, {"Failed", failed}} {
+		if len(group.names) == 0 {
+			continue
+		}
+		fmt.Fprintf(summaryOut, "%s:\n", group.title)
+		for _, n := range group.names {
+			fmt.Fprintf(summaryOut, "  - %s\n", n)
+		}
+	}
+
+	if len(errored) > 0 {
+		return fmt.Errorf("%d scenario(s) errored", len(errored))
+	}
+	if len(failed) > 0 {
+		return &internal.TestFailureError{Failed: failedTests}
+	}
+	return nil
+}
+
+// scenarioProcess is the captured run of one scenario file under --parallel-scenarios
+type scenarioProcess struct {
+	stdout, stderr bytes.Buffer
+	metricsPath    string
+	runErr         error // from exec, an *exec.ExitError for a non-zero exit
+	err            error // the outcome as run would have returned it
+}
+
+// replay writes the scenario's captured output and returns its outcome as run would have
+func (p *scenarioProcess) replay() error {
+	internal.Stdout.Write(p.stdout.Bytes())
+	internal.Stderr.Write(p.stderr.Bytes())
+	return p.err
+}
+
+// scenarioExecutable returns the binary that --parallel-scenarios starts for each scenario file
+var scenarioExecutable = os.Executable
+
+// runScenarioProcesses runs each scenario file in its own politest process, at most --parallel-scenarios at a time
+// Separate processes keep the package-level output writers and exit handling of each scenario apart, so a worker
+// can't interleave output with another or exit the whole run; results are returned in path order.
+// Without --keep-going no new scenario starts after one errors, matching the serial run that stops there
+func runScenarioProcesses(flags *cliFlags, files []string) ([]scenarioProcess, error) {
+	exe, err := scenarioExecutable()
+	if err != nil {
+		return nil, fmt.Errorf("--parallel-scenarios: %v", err)
+	}
+	metricsDir, err := os.MkdirTemp("", "politest-scenarios-")
+	if err != nil {
+		return nil, fmt.Errorf("--parallel-scenarios: %v", err)
+	}
+	defer os.RemoveAll(metricsDir)
+
+	outcomes := make([]scenarioProcess, len(files))
+	slots := make(chan struct{}, flags.parallelScenarios)
+	var stopped atomic.Bool
+	var wg sync.WaitGroup
+	for i, f := range files {
+		slots <- struct{}{}
+		if stopped.Load() {
+			<-slots
+			break
+		}
+		p := &outcomes[i]
+		p.metricsPath = filepath.Join(metricsDir, fmt.Sprintf("%d.prom", i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			args := append(append([]string{noConfigArg}, flags.childArgs...), "--scenario="+f, "--metrics-file="+p.metricsPath)
+			cmd := exec.Command(exe, args...)
+			cmd.Stdout, cmd.Stderr = &p.stdout, &p.stderr
+			p.runErr = cmd.Run()
+			var exitErr *exec.ExitError
+			if p.runErr != nil && (!errors.As(p.runErr, &exitErr) || exitErr.ExitCode() != internal.ExitCodeFailure) && !flags.keepGoing {
+				stopped.Store(true)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Outcomes are settled after every worker is done, in path order, so metrics merge deterministically
+	for i := range outcomes {
+		if p := &outcomes[i]; p.metricsPath != "" {
+			p.err = p.outcome(flags.metrics)
+		}
+	}
+	return outcomes, nil
+}
+
+// outcome maps the finished process to the error run would have returned, merging its metrics into m
+// The exit code decides whether the run failed, as --exit-code-on-failure is forwarded; the child's
+// metrics file supplies the failed-test count
+func (p *scenarioProcess) outcome(m *internal.RunMetrics) error {
+	var exitErr *exec.ExitError
+	if p.runErr != nil && !errors.As(p.runErr, &exitErr) {
+		return p.runErr
+	}
+	exitCode := 0
+	if exitErr != nil {
+		exitCode = exitErr.ExitCode()
+	}
+	_, failedTests, metricsErr := m.MergeFile(p.metricsPath)
+	switch {
+	case failedTests > 0 && exitCode == internal.ExitCodeFailure:
+		return &internal.TestFailureError{Failed: failedTests}
+	case p.runErr == nil:
+		// Includes failed tests that didn't fail the run, e.g. under --no-assert
+		return nil
+	case metricsErr == nil && exitCode == internal.ExitCodeFailure:
+		// e.g. allowed_actions_exactly, which fails without a failed test in the metrics
+		return &internal.TestFailureError{Failed: 1}
+	}
+	lines := strings.Split(strings.TrimSpace(p.stderr.String()), "\n")
+	last := lines[len(lines)-1]
+	// Under --error-format json the child's last line is its error report, passed on rather than re-encoded
+	var report internal.ErrorReport
+	if json.Unmarshal([]byte(last), &report) == nil && report.Kind != "" {
+		return &internal.ReportedError{Report: report}
+	}
+	return fmt.Errorf("%s", internal.IfEmpty(last, fmt.Sprintf("exited with code %d", exitCode)))
+}
+
+// scenarioChildArgs returns the flags given on the command line (or by --config) to forward to each
+// scenario process, leaving out the ones that only apply to the --scenarios-dir run itself
+// Config values are forwarded as flags because the child doesn't load the config file (see noConfigArg)
+func scenarioChildArgs(fs *flag.FlagSet) []string {
+	var args []string
+	fs.Visit(func(f *flag.Flag) {
+		switch value := f.Value.(type) {
+		case *stringListFlag:
+			for _, v := range *value {
+				args = append(args, "--"+f.Name+"="+v)
+			}
+		case *shuffleFlag:
+			// An unseeded --shuffle lets each scenario pick its own seed, as in a serial run
+			args = append(args, "--shuffle="+internal.IfEmpty(value.String(), strconv.FormatBool(value.enabled)))
+		default:
+			switch f.Name {
+			case "scenarios-dir", "parallel-scenarios", "keep-going", "list-scenarios", "metrics-file", "config":
+				return
+			}
+			args = append(args, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+	return args
+}
+
+// dumpMergedSCP writes the merged SCP document and its source map for --dump-merged-scp
+func dumpMergedSCP(path string, sourceMap *internal.PolicySourceMap) error {
+	if sourceMap.PermissionsBoundaryRaw == "" {
+		return fmt.Errorf("--dump-merged-scp %s: the scenario has no SCPs to merge", path)
+	}
+	if err := internal.DumpMergedSCP(path, sourceMap.PermissionsBoundaryRaw, sourceMap.PermissionsBoundary); err != nil {
+		return err
+	}
+	fmt.Fprintf(internal.Stdout, "Saved merged SCP → %s (sources: %s)\n\n", path, internal.MergedSCPSourcesPath(path))
+	return nil
+}
+
+// listScenarios prints the files --scenarios-dir would run with their test counts and disabled status (--list-scenarios)
+// Files that fail to load are listed with the error rather than stopping the listing
+func listScenarios(dir string) error {
+	files, err := findScenarioFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no scenario files (*.yml, *.yaml with tests or actions) found in %s", dir)
+	}
+
+	disabled, errored := 0, 0
+	for _, f := range files {
+		name := f
+		if rel, err := filepath.Rel(dir, f); err == nil {
+			name = rel
+		}
+		scen, err := internal.LoadScenarioWithExtends(f)
+		switch {
+		case err != nil:
+			errored++
+			fmt.Fprintf(internal.Stdout, "%s  error: %v\n", name, err)
+		case scen.Disabled:
+			disabled++
+			fmt.Fprintf(internal.Stdout, "%s  %d test(s)  disabled\n", name, scen.TestCount())
+		case scen.TestCount() == 0:
+			fmt.Fprintf(internal.Stdout, "%s  no tests\n", name)
+		default:
+			fmt.Fprintf(internal.Stdout, "%s  %d test(s)\n", name, scen.TestCount())
+		}
+	}
+	fmt.Fprintf(internal.Stdout, "Scenarios: %d found (%d disabled, %d unreadable)\n", len(files), disabled, errored)
+	return nil
+}
+
+// scenarioMatrix returns the matrix cells for the scenario: its matrix block with --matrix axes added or replaced
+func scenarioMatrix(flags *cliFlags) ([]internal.MatrixCell, error) {
+	if flags.scenarioPath == "" {
+		return nil, nil
+	}
+	absScenario, err := filepath.Abs(flags.scenarioPath)
+	if err != nil {
+		return nil, err
+	}
+	scen, err := internal.LoadScenarioWithExtends(absScenario)
+	if err != nil {
+		return nil, err
+	}
+	if scen.Disabled {
+		return nil, nil
+	}
+	matrix := make(map[string][]any, len(scen.Matrix)+len(flags.matrix))
+	for k, v := range scen.Matrix {
+		matrix[k] = v
+	}
+	for _, m := range flags.matrix {
+		name, values, err := internal.ParseMatrixFlag(m)
+		if err != nil {
+			return nil, err
+		}
+		matrix[name] = values
+	}
+	return internal.MatrixCells(matrix)
+}
+
+// runMatrix runs the scenario once per matrix cell, then prints an aggregate summary across cells
+func runMatrix(flags *cliFlags, cells []internal.MatrixCell, debugWriter io.Writer) error {
+	if flags.savePath != "" || flags.saveFullPath != "" || flags.saveDir != "" || flags.dumpMergedSCP != "" {
+		return fmt.Errorf("--save, --save-full, --save-dir and --dump-merged-scp cannot be used with a matrix (each cell would overwrite the files)")
+	}
+
+	var failed []string
+	failedTests := 0
+	for _, cell := range cells {
+		fmt.Fprintf(internal.Stdout, "=== matrix: %s ===\n", cell.Label())
+
+		cellFlags := *flags
+		cellFlags.matrixCell = cell
+		err := run(&cellFlags, debugWriter)
+
+		var failure *internal.TestFailureError
+		switch {
+		case err == nil:
+		case errors.As(err, &failure):
+			failed = append(failed, cell.Label())
+			failedTests += failure.Failed
+		default:
+			return fmt.Errorf("matrix %s: %w", cell.Label(), err)
+		}
+		fmt.Fprintln(internal.Stdout)
+	}
+
+	summaryOut := summaryWriter(flags)
+	fmt.Fprintf(summaryOut, "Matrix: %d cell(s) (%d passed, %d failed)\n", len(cells), len(cells)-len(failed), len(failed))
+	if len(failed) > 0 {
+		fmt.Fprintf(summaryOut, "Failed:\n")
+		for _, label := range failed {
+			fmt.Fprintf(summaryOut, "  - %s\n", label)
+		}
+		return &internal.TestFailureError{Failed: failedTests}
+	}
+	return nil
+}
+
+// findScenarioFiles returns the *.yml/*.yaml scenario files under dir, sorted by path
+// Files starting with "_" (e.g. _common.yml) are shared bases for extends and are not run, and
+// files without a tests or actions block (vars and policy fragments) are not scenarios
+func findScenarioFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), "_") {
+			return nil
+		}
+		if ext := filepath.Ext(path); (ext == ".yml" || ext == ".yaml") && internal.IsScenarioFile(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// explainMerge prints the scenario after extends are resolved, annotated with the file that set each field
+func explainMerge(scenarioPath string) error {
+	if scenarioPath == "" {
+		return fmt.Errorf("--explain-merge requires --scenario")
+	}
+	absScenario, err := filepath.Abs(scenarioPath)
+	if err != nil {
+		return err
+	}
+	scen, err := internal.LoadScenarioWithExtends(absScenario)
+	if err != nil {
+		return err
+	}
+	internal.PrintMergeExplanation(internal.Stdout, scen)
+	return nil
+}
+
+// shuffleSeed returns the seed given with --shuffle=<seed>, or a fresh one from the clock
+func shuffleSeed(s shuffleFlag) int64 {
+	if s.seedSet {
+		return s.seed
+	}
+	return time.Now().UnixNano()
+}
+
+// checkPolicySizes fails if any identity policy's minified size exceeds the --max-policy-bytes budget
+// All oversized policies are reported together; a budget of 0 disables the check
+func checkPolicySizes(sizes []policySize, budget int) error {
+	if budget <= 0 {
+		return nil
+	}
+	var over []string
+	for _, s := range sizes {
+		if s.bytes > budget {
+			over = append(over, fmt.Sprintf("  %s: %d bytes (budget %d, over by %d)", s.source, s.bytes, budget, s.bytes-budget))
+		}
+	}
+	if len(over) > 0 {
+		return fmt.Errorf("policy size budget exceeded (--max-policy-bytes, minified):\n%s", strings.Join(over, "\n"))
+	}
+	return nil
+}
+
+// generateTestsFromPolicy writes one allowed test per action in the scenario's identity policies
+// Managed policy ARNs in policy_paths are skipped, as generation does not contact AWS
+func generateTestsFromPolicy(prep *simulationPrep, outPath string) error {
+	var policies []string
+	if prep.policyJSON != "" {
+		policies = append(policies, prep.policyJSON)
+	}
+	for _, p := range prep.additionalPolicies {
+		if p.document != "" {
+			policies = append(policies, p.document)
+		}
+	}
+
+	tests, wildcards, err := internal.ActionsFromPolicy(policies...)
+	if err != nil {
+		return err
+	}
+
+	if outPath == "-" {
+		internal.WriteGeneratedTests(internal.Stdout, prep.absScenarioPath, tests, wildcards)
+		return nil
+	}
+	var buf bytes.Buffer
+	internal.WriteGeneratedTests(&buf, prep.absScenarioPath, tests, wildcards)
+	if err := os.WriteFile(outPath, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(internal.Stdout, "Generated %d test(s) → %s\n", len(tests), outPath)
+	return nil
+}
+
+// cliFlags holds the parsed command-line flags
+type cliFlags struct {
+	scenarioPath           string
+	savePath               string
+	saveFullPath           string
+	saveDir                string
+	noAssert               bool
+	failOnSeverity         string
+	noWarn                 bool
+	failOnWarnings         bool
+	accessAnalyzerValidate bool
+	explainMerge           bool
+	scenariosDir           string
+	keepGoing              bool
+	listScenarios          bool
+	parallelScenarios      int
+	childArgs              []string // flags forwarded to each scenario process under --parallel-scenarios
+	templateFile           string
+	showVersion            bool
+	versionJSON            bool
+	debug                  bool
+	strictPolicy           bool
+	strictYAML             bool
+	renderScenario         bool
+	noTrackingSids         bool
+	showMatchedSuccess     bool
+	rawMatchOrder          bool
+	dedupeMatches          bool
+	dedupeNames            bool
+	showStatementJSON      bool
+	strictMatches          bool
+	explainDeniesOnly      bool
+	redact                 bool
+	coverage               bool
+	format                 string
+	groupBy                string
+	progress               bool
+	lint                   bool
+	lintDisable            stringListFlag
+	maxFailures            int
+	maxPolicyBytes         int
+	webhookURL             string
+	profile                string
+	fromOrgAccount         string
+	scpOnly                string
+	dumpMergedSCP          string
+	noSummary              bool
+	errorFormat            string
+	compactOutput          bool
+	summaryStderr          bool
+	webhookOn              string
+	metricsFile            string
+	actionsFromPolicy      string // write generated tests here ("-" for stdout) instead of running
+	exitCodeOnFailure      int
+	exitCodeOnError        int
+	tests                  string // comma-separated list of test names to run
+	contexts               stringListFlag
+	matrix                 stringListFlag
+	matrixCell             internal.MatrixCell  // set while running one cell of a matrix
+	metrics                *internal.RunMetrics // set when --metrics-file is given; shared by every scenario in the run
+	shuffle                shuffleFlag
+	retryOnDeny            retryFlag
+	configPath             string
+}
+
+// stringListFlag collects the values of a repeatable flag
+type stringListFlag []string
+
+func (s *stringListFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *stringListFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// shuffleFlag is --shuffle (random seed) or --shuffle=<seed> (reproduce a previous order)
+type shuffleFlag struct {
+	enabled bool
+	seed    int64
+	seedSet bool
+}
+
+func (s *shuffleFlag) String() string {
+	if s == nil || !s.seedSet {
+		return ""
+	}
+	return strconv.FormatInt(s.seed, 10)
+}
+
+func (s *shuffleFlag) Set(v string) error {
+	if enabled, err := strconv.ParseBool(v); err == nil {
+		s.enabled = enabled
+		return nil
+	}
+	seed, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("expected true, false or an integer seed, got %q", v)
+	}
+	s.enabled, s.seed, s.seedSet = true, seed, true
+	return nil
+}
+
+// IsBoolFlag lets --shuffle be given without a value
+func (s *shuffleFlag) IsBoolFlag() bool { return true }
+
+// retryFlag is --retry-on-deny <attempts,delay>, e.g. 3,5s
+type retryFlag struct {
+	attempts int
+	delay    time.Duration
+}
+
+func (r *retryFlag) String() string {
+	if r == nil || r.attempts == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d,%s", r.attempts, r.delay)
+}
+
+func (r *retryFlag) Set(v string) error {
+	attemptsStr, delayStr, ok := strings.Cut(v, ",")
+	if !ok {
+		return fmt.Errorf("expected <attempts,delay> such as 3,5s, got %q", v)
+	}
+	attempts, err := strconv.Atoi(strings.TrimSpace(attemptsStr))
+	if err != nil || attempts < 1 {
+		return fmt.Errorf("attempts must be a positive integer, got %q", attemptsStr)
+	}
+	delay, err := time.ParseDuration(strings.TrimSpace(delayStr))
+	if err != nil || delay < 0 {
+		return fmt.Errorf("delay must be a duration such as 5s, got %q", delayStr)
+	}
+	r.attempts, r.delay = attempts, delay
+	return nil
+}
+
+// defaultConfigFile is discovered in the current directory when --config is not given
+const defaultConfigFile = ".politest.yml"
+
+// noConfigArg turns off config file loading in --parallel-scenarios child processes, which receive the
+// parent's resolved config as explicit flags; it isn't registered, so usage doesn't list it
+const noConfigArg = "--no-config-discovery"
+
+// parseFlags parses command-line arguments and returns flags or error
+func parseFlags(args []string) (*cliFlags, []string, error) {
+	fs := flag.NewFlagSet("politest", flag.ContinueOnError)
+
+	flags := &cliFlags{}
+	noConfig := slices.Contains(args, noConfigArg)
+	args = slices.DeleteFunc(slices.Clone(args), func(a string) bool { return a == noConfigArg })
+
+	fs.StringVar(&flags.scenarioPath, "scenario", "", "Path to scenario YAML")
+	fs.StringVar(&flags.scenariosDir, "scenarios-dir", "", "Run every *.yml/*.yaml scenario under this directory (files starting with _ and files without tests or actions are skipped)")
+	fs.BoolVar(&flags.keepGoing, "keep-going", false, "With --scenarios-dir, record scenario errors and continue with the remaining files")
+	fs.BoolVar(&flags.listScenarios, "list-scenarios", false, "With --scenarios-dir, list the scenario files with test counts and disabled status, then exit without running")
+	fs.IntVar(&flags.parallelScenarios, "parallel-scenarios", 0, "With --scenarios-dir, run up to N scenario files at once, each in its own process; output and summary stay in path order")
+	fs.StringVar(&flags.savePath, "save", "", "Path to save raw JSON response")
+	fs.StringVar(&flags.saveDir, "save-dir", "", "Directory to save each test's raw response as <NNN>-<test-name>.json")
+	fs.StringVar(&flags.saveFullPath, "save-full", "", "Path to save simulation inputs and responses as {input, output} pairs")
+	fs.BoolVar(&flags.noAssert, "no-assert", false, "Do not fail on expectation mismatches")
+	fs.StringVar(&flags.failOnSeverity, "fail-on-severity", "", "Only fail the run for failing tests at or above this severity: critical, high, medium or low (tests without a severity always count)")
+	fs.BoolVar(&flags.noWarn, "no-warn", false, "Suppress warnings (SCP/RCP simulation approximation, wildcard actions)")
+	fs.BoolVar(&flags.failOnWarnings, "fail-on-warnings", false, "Exit with the error code if any warnings were emitted (warnings hidden by --no-warn are not counted)")
+	fs.BoolVar(&flags.debug, "debug", false, "Show debug output (files loaded, variables, rendered policies)")
+	fs.BoolVar(&flags.showMatchedSuccess, "show-matched-success", false, "Show matched statements for passing tests")
+	fs.BoolVar(&flags.rawMatchOrder, "raw-match-order", false, "Show matched statements in AWS order instead of sorting by source")
+	fs.BoolVar(&flags.dedupeMatches, "dedupe-matches", false, "Collapse matched statements that resolve to the same source")
+	fs.BoolVar(&flags.dedupeNames, "dedupe-names", false, "Suffix duplicate test names with their action instead of failing the scenario")
+	fs.BoolVar(&flags.strictMatches, "strict-matches", false, "Fail any test whose decision is allowed but has no matched statements")
+	fs.BoolVar(&flags.showStatementJSON, "show-statement-json", false, "Print each matched statement's JSON, as sent to AWS, below its source lines")
+	fs.BoolVar(&flags.explainDeniesOnly, "explain-denies-only", false, "Show matched statements for passing tests only when the decision is a deny")
+	fs.BoolVar(&flags.explainMerge, "explain-merge", false, "Print the resolved scenario with the file that set each field (after extends) and exit")
+	fs.BoolVar(&flags.showVersion, "version", false, "Show version information and exit")
+	fs.BoolVar(&flags.versionJSON, "json", false, "With --version, print version information as JSON")
+	fs.StringVar(&flags.tests, "test", "", "Comma-separated list of test names to run (runs all if empty)")
+	fs.Var(&flags.shuffle, "shuffle", "Run tests in random order; prints the seed, pass --shuffle=<seed> to reproduce")
+	fs.Var(&flags.matrix, "matrix", "Matrix variable name=v1,v2: run the tests once per combination of values (repeatable)")
+	fs.Var(&flags.contexts, "context", "Context entry key=value[:type] applied to every test below scenario/test context (repeatable)")
+	fs.BoolVar(&flags.strictPolicy, "strict-policy", false, "Fail if policies contain non-IAM fields")
+	fs.BoolVar(&flags.accessAnalyzerValidate, "access-analyzer-validate", false, "Validate each policy with IAM Access Analyzer before running tests (ERROR findings fail the run)")
+	fs.BoolVar(&flags.strictYAML, "strict-yaml", false, "Fail if scenario or vars files contain unknown fields")
+	fs.BoolVar(&flags.renderScenario, "render-scenario", false, "Render scenario files through text/template with their vars_file before parsing")
+	fs.BoolVar(&flags.noTrackingSids, "no-tracking-sids", false, "Send policies without injected tracking Sids (matched statements are resolved by position only)")
+	fs.BoolVar(&flags.redact, "redact", false, "Mask account IDs and ARN resources in printed output and webhook payloads (--save files are not redacted)")
+	fs.BoolVar(&flags.coverage, "coverage", false, "Print the unique actions and resources tested after the run")
+	fs.StringVar(&flags.format, "format", internal.FormatText, "Output format: text, jsonl (one JSON object per test on stdout) or console-style (IAM console simulator table)")
+	fs.BoolVar(&flags.lint, "lint", false, "Statically check identity policies for likely mistakes before simulating (findings are warnings)")
+	fs.Var(&flags.lintDisable, "lint-disable", "Lint rule to skip, e.g. allow-deny-conflict (repeatable or comma-separated)")
+	fs.StringVar(&flags.errorFormat, "error-format", internal.ErrorFormatText, "Error output format: text (default) or json, one {\"error\",\"kind\",...} object on stderr")
+	fs.BoolVar(&flags.noSummary, "no-summary", false, "Don't print the test, scenario or matrix results summary (exit codes are unchanged)")
+	fs.BoolVar(&flags.summaryStderr, "summary-stderr", false, "Print the results summary on stderr so stdout carries only the per-test results")
+	fs.BoolVar(&flags.compactOutput, "compact-output", false, "Print one line per test; the detail block is kept for failures and --show-matched-success")
+	fs.BoolVar(&flags.progress, "progress", false, "Show a progress bar instead of per-test output when stderr is a terminal; failures print after it")
+	fs.StringVar(&flags.groupBy, "group-by", "", "Print test output under headers by action, resource, decision or tag, with per-group summaries")
+	fs.StringVar(&flags.templateFile, "template-file", "", "Render the results through this Go text/template on stdout (test output moves to stderr)")
+	fs.IntVar(&flags.maxFailures, "max-failures", 0, "Stop running tests after N failures (0 = unlimited)")
+	fs.Var(&flags.retryOnDeny, "retry-on-deny", "Re-run tests expecting allowed that were denied: <attempts,delay>, e.g. 3,5s (masks IAM propagation lag only)")
+	fs.IntVar(&flags.maxPolicyBytes, "max-policy-bytes", 0, "Fail before simulating if an identity policy's minified size exceeds N bytes (0 = no budget)")
+	fs.StringVar(&flags.dumpMergedSCP, "dump-merged-scp", "", "Write the merged SCP document sent to AWS (with tracking Sids) to this path, and its source map to <name>.sources.json")
+	fs.StringVar(&flags.scpOnly, "scp-only", "", "Use only this scp_paths file (path or base name) as the SCP boundary, ignoring the scenario's other SCPs")
+	fs.StringVar(&flags.fromOrgAccount, "from-org-account", "", "Fetch the SCPs attached to this account and its OUs from AWS Organizations and merge them after scp_paths")
+	fs.StringVar(&flags.profile, "profile", "", "Named AWS profile from the shared config/credentials files (overrides AWS_PROFILE)")
+	fs.StringVar(&flags.webhookURL, "webhook-url", "", "POST a JSON summary (counts, failing tests, scenario) to this URL after the run")
+	fs.StringVar(&flags.webhookOn, "webhook-on", internal.WebhookOnFailure, "When to call --webhook-url: failure or always")
+	fs.StringVar(&flags.metricsFile, "metrics-file", "", "Write Prometheus textfile metrics (tests total/passed/failed per scenario) to this path after the run")
+	fs.StringVar(&flags.actionsFromPolicy, "actions-from-policy", "", "Write a tests: YAML block with one allowed test per policy action to this path ('-' for stdout) instead of running")
+	fs.IntVar(&flags.exitCodeOnFailure, "exit-code-on-failure", 2, "Exit code when expectations fail")
+	fs.IntVar(&flags.exitCodeOnError, "exit-code-on-error", 1, "Exit code for errors (invalid scenario, AWS error, etc.)")
+	fs.StringVar(&flags.configPath, "config", "", "Path to config file with default flag values (default: ./"+defaultConfigFile+" if present)")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if !noConfig {
+		if err := applyConfigFile(fs, flags.configPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if flags.errorFormat != internal.ErrorFormatText && flags.errorFormat != internal.ErrorFormatJSON {
+		return nil, nil, fmt.Errorf("--error-format must be %s or %s, got %q", internal.ErrorFormatText, internal.ErrorFormatJSON, flags.errorFormat)
+	}
+	for name, code := range map[string]int{"exit-code-on-failure": flags.exitCodeOnFailure, "exit-code-on-error": flags.exitCodeOnError} {
+		if code < 0 || code > 255 {
+			return nil, nil, fmt.Errorf("--%s must be between 0 and 255, got %d", name, code)
+		}
+	}
+
+	// Later errors return the parsed flags too, so realMain can report them with the requested
+	// --error-format and --exit-code-on-error
+	for _, c := range flags.contexts {
+		if _, err := internal.ParseContextFlag(c); err != nil {
+			return flags, nil, err
+		}
+	}
+
+	if flags.versionJSON && !flags.showVersion {
+		return flags, nil, fmt.Errorf("--json requires --version")
+	}
+
+	if flags.scenariosDir != "" {
+		for _, conflict := range []struct {
+			name string
+			set  bool
+		}{
+			{"scenario", flags.scenarioPath != ""},
+			{"save", flags.savePath != ""},
+			{"save-full", flags.saveFullPath != ""},
+			{"save-dir", flags.saveDir != ""},
+			{"dump-merged-scp", flags.dumpMergedSCP != ""},
+			{"actions-from-policy", flags.actionsFromPolicy != ""},
+			{"explain-merge", flags.explainMerge},
+		} {
+			if conflict.set {
+				return flags, nil, fmt.Errorf("--scenarios-dir cannot be combined with --%s", conflict.name)
+			}
+		}
+	} else if flags.keepGoing {
+		return flags, nil, fmt.Errorf("--keep-going requires --scenarios-dir")
+	} else if flags.listScenarios {
+		return flags, nil, fmt.Errorf("--list-scenarios requires --scenarios-dir")
+	} else if flags.parallelScenarios != 0 {
+		return flags, nil, fmt.Errorf("--parallel-scenarios requires --scenarios-dir")
+	}
+
+	if flags.parallelScenarios < 0 {
+		return flags, nil, fmt.Errorf("--parallel-scenarios must be 0 or greater, got %d", flags.parallelScenarios)
+	}
+	flags.childArgs = scenarioChildArgs(fs)
+
+	if a := flags.fromOrgAccount; a != "" && (len(a) != 12 || strings.Trim(a, "0123456789") != "") {
+		return flags, nil, fmt.Errorf("--from-org-account must be a 12-digit account ID, got %q", a)
+	}
+
+	if flags.noSummary && flags.summaryStderr {
+		return flags, nil, fmt.Errorf("--no-summary and --summary-stderr are mutually exclusive")
+	}
+
+	if flags.scpOnly != "" && flags.fromOrgAccount != "" {
+		return flags, nil, fmt.Errorf("--scp-only cannot be combined with --from-org-account")
+	}
+
+	if flags.maxPolicyBytes < 0 {
+		return flags, nil, fmt.Errorf("--max-policy-bytes must be 0 or greater, got %d", flags.maxPolicyBytes)
+	}
+
+	if flags.failOnSeverity != "" && !slices.Contains(internal.Severities, flags.failOnSeverity) {
+		return flags, nil, fmt.Errorf("--fail-on-severity must be one of %s, got %q", strings.Join(internal.Severities, ", "), flags.failOnSeverity)
+	}
+
+	if flags.maxFailures < 0 {
+		return flags, nil, fmt.Errorf("--max-failures must be 0 or greater, got %d", flags.maxFailures)
+	}
+
+	var lintDisable stringListFlag
+	for _, rules := range flags.lintDisable {
+		for _, rule := range strings.Split(rules, ",") {
+			rule = strings.TrimSpace(rule)
+			if !slices.Contains(internal.LintRules, rule) {
+				return flags, nil, fmt.Errorf("--lint-disable: unknown rule %q (rules: %s)", rule, strings.Join(internal.LintRules, ", "))
+			}
+			lintDisable = append(lintDisable, rule)
+		}
+	}
+	flags.lintDisable = lintDisable
+
+	if flags.groupBy != "" && !slices.Contains(internal.GroupByValues, flags.groupBy) {
+		return flags, nil, fmt.Errorf("--group-by must be one of %s, got %q", strings.Join(internal.GroupByValues, ", "), flags.groupBy)
+	}
+
+	if flags.format != internal.FormatText && flags.format != internal.FormatJSONL && flags.format != internal.FormatConsole {
+		return flags, nil, fmt.Errorf("--format must be %q, %q or %q, got %q", internal.FormatText, internal.FormatJSONL, internal.FormatConsole, flags.format)
+	}
+
+	if flags.templateFile != "" && flags.format != internal.FormatText {
+		return flags, nil, fmt.Errorf("--template-file cannot be combined with --format %s", flags.format)
+	}
+
+	if flags.webhookOn != internal.WebhookOnFailure && flags.webhookOn != internal.WebhookOnAlways {
+		return flags, nil, fmt.Errorf("--webhook-on must be %q or %q, got %q", internal.WebhookOnFailure, internal.WebhookOnAlways, flags.webhookOn)
+	}
+
+	return flags, fs.Args(), nil
+}
+
+// applyConfigFile sets flag defaults from a YAML config file
+// Precedence: explicit flag > config file > built-in default
+func applyConfigFile(fs *flag.FlagSet, configPath string) error {
+	if configPath == "" {
+		if _, err := os.Stat(defaultConfigFile); err != nil {
+			return nil // no config file to apply
+		}
+		configPath = defaultConfigFile
+	}
+
+	values := map[string]any{}
+	if err := internal.LoadYAML(configPath, &values); err != nil {
+		return fmt.Errorf("failed to load config file %s: %v", configPath, err)
+	}
+
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("config file %s: unknown flag '%s'", configPath, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		items, ok := values[name].([]any)
+		if !ok {
+			items = []any{values[name]}
+		}
+		for _, item := range items {
+			if err := fs.Set(name, fmt.Sprint(item)); err != nil {
+				return fmt.Errorf("config file %s: invalid value for '%s': %v", configPath, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateArgs checks for unknown positional arguments
+func validateArgs(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unknown arguments: %v\nUse -h or --help for usage information", args)
+	}
+	return nil
+}
+
+// realMain contains the full main logic and returns an exit code
+// This allows testing without calling os.Exit
+func realMain(args []string) int {
+	if len(args) > 0 && args[0] == "doctor" {
+		return runDoctor(args[1:])
+	}
+	if len(args) > 0 && args[0] == "deps" {
+		return runDeps(args[1:])
+	}
+	if len(args) > 0 && args[0] == "compare" {
+		return runCompare(args[1:])
+	}
+	if len(args) > 0 && args[0] == "selftest" {
+		return runSelfTest(args[1:])
+	}
+
+	flags, remainingArgs, err := parseFlags(args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		internal.ErrorFormat = internal.ErrorFormatText
+		code := 1
+		if flags != nil {
+			internal.ErrorFormat = flags.errorFormat
+			code = flags.exitCodeOnError
+		}
+		internal.PrintError(os.Stderr, fmt.Errorf("parsing flags: %w", err))
+		return code
+	}
+
+	internal.ExitCodeError = flags.exitCodeOnError
+	internal.ExitCodeFailure = flags.exitCodeOnFailure
+	internal.StrictYAML = flags.strictYAML
+	internal.RenderScenarios = flags.renderScenario
+	internal.TrackingSids = !flags.noTrackingSids
+	internal.ErrorFormat = flags.errorFormat
+	internal.ResetWarnings()
+
+	// Route all printed output through the redaction filter if requested
+	internal.Stdout, internal.Stderr = os.Stdout, os.Stderr
+	if flags.redact {
+		internal.Stdout = internal.RedactingWriter{W: os.Stdout}
+		internal.Stderr = internal.RedactingWriter{W: os.Stderr}
+	}
+
+	// Handle --version flag
+	if flags.showVersion {
+		if flags.versionJSON {
+			PrintVersionJSON()
+		} else {
+			PrintVersion()
+		}
+		return 0
+	}
+
+	// Validate no unknown arguments
+	if err := validateArgs(remainingArgs); err != nil {
+		internal.PrintError(internal.Stderr, err)
+		return internal.ExitCodeError
+	}
+
+	if flags.metricsFile != "" {
+		flags.metrics = internal.NewRunMetrics()
 	}
 
 	// Run main logic
-	if err := run(flags.scenarioPath, flags.savePath, flags.noAssert, flags.noWarn, flags.debug, flags.strictPolicy, flags.showMatchedSuccess, flags.tests, os.Stdout); err != nil {
+	err = run(flags, internal.Stdout)
+	if flags.metrics != nil {
+		// Written even when scenarios errored, so dashboards still see the ones that ran
+		if writeErr := flags.metrics.WriteFile(flags.metricsFile); writeErr != nil {
+			internal.PrintError(internal.Stderr, writeErr)
+			return internal.ExitCodeError
+		}
+	}
+	if err != nil {
+		// Failed expectations were already reported in the test output and summary
+		var failure *internal.TestFailureError
+		if !errors.As(err, &failure) {
+			internal.PrintError(internal.Stderr, err)
+		}
+		return internal.ExitCodeFor(err)
+	}
+
+	return 0
+}
+
+// awsConfigOptions returns the options for config.LoadDefaultConfig
+// An empty profile leaves the SDK's default resolution (AWS_PROFILE, then "default") in place
+func awsConfigOptions(profile string) []func(*config.LoadOptions) error {
+	if profile == "" {
+		return nil
+	}
+	return []func(*config.LoadOptions) error{config.WithSharedConfigProfile(profile)}
+}
+
+// runDoctor checks the environment politest depends on and returns an exit code
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("politest doctor", flag.ContinueOnError)
+	profile := fs.String("profile", "", "Named AWS profile from the shared config/credentials files")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if err := validateArgs(fs.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	awsCfg, err := config.LoadDefaultConfig(ctx, awsConfigOptions(*profile)...)
+	if err != nil {
+		internal.PrintDoctorReport(os.Stdout, []internal.DoctorResult{{
+			Name:     "AWS configuration",
+			Critical: true,
+			Detail:   err.Error(),
+			Hint:     "check ~/.aws/config and AWS_* environment variables",
+		}})
+		return 1
+	}
+
+	results := []internal.DoctorResult{
+		internal.CheckCredentials(ctx, awsCfg),
+		internal.CheckRegion(awsCfg),
+	}
+	if results[0].OK {
+		results = append(results,
+			internal.CheckCallerIdentity(ctx, sts.NewFromConfig(awsCfg)),
+			internal.CheckSimulatePermission(ctx, iam.NewFromConfig(awsCfg)),
+		)
+	}
+
+	if !internal.PrintDoctorReport(os.Stdout, results) {
+		return 1
+	}
+	return 0
+}
+
+// runSelfTest implements `politest selftest`: run the embedded example scenario against a fake simulator
+// and check the engine end-to-end, without AWS credentials or network access
+func runSelfTest(args []string) int {
+	fs := flag.NewFlagSet("politest selftest", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if err := validateArgs(fs.Args()); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		return 1
 	}
 
+	dir, err := os.MkdirTemp("", "politest-selftest-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	if err := internal.WriteSelfTestFiles(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	prep, err := prepareSimulation(filepath.Join(dir, internal.SelfTestScenario), true, false, false, io.Discard)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: loading the example scenario: %v\n", err)
+		return 1
+	}
+
+	sim := &internal.SelfTestSimulator{}
+	var output strings.Builder
+	oldStdout := internal.Stdout
+	internal.Stdout = &output
+	runErr := internal.RunTests(sim, prep.scenario, internal.SimulatorConfig{
+		PolicyJSON:         prep.policyJSON,
+		ScenarioPath:       prep.absScenarioPath,
+		Variables:          prep.variables,
+		NoWarn:             true,
+		ShowMatchedSuccess: true,
+		SourceMap:          prep.sourceMap,
+	})
+	internal.Stdout = oldStdout
+
+	if !internal.PrintSelfTestReport(os.Stdout, internal.SelfTestChecks(sim, output.String(), runErr)) {
+		fmt.Fprintf(os.Stdout, "\nExample scenario output:\n%s", output.String())
+		return 1
+	}
 	return 0
 }
 
+// runDeps implements `politest deps`: print every file a scenario references, without running tests
+func runDeps(args []string) int {
+	fs := flag.NewFlagSet("politest deps", flag.ContinueOnError)
+	scenarioPath := fs.String("scenario", "", "Path to scenario YAML")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if err := validateArgs(fs.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if *scenarioPath == "" {
+		fmt.Fprintln(os.Stderr, "missing --scenario\nUsage: politest deps --scenario <path>")
+		return 1
+	}
+
+	files, err := scenarioDependencies(*scenarioPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	for _, f := range files {
+		fmt.Println(f)
+	}
+	return 0
+}
+
+// scenarioDependencies returns the sorted absolute paths of every file a scenario references:
+// the extends chain, vars_file, policies and templates, policy_paths and scp_paths (globs expanded)
+// and scenario- and test-level resource policies. Managed policy ARNs are not files and are skipped
+func scenarioDependencies(scenarioPath string) ([]string, error) {
+	absScenario, err := filepath.Abs(scenarioPath)
+	if err != nil {
+		return nil, err
+	}
+	scen, err := internal.LoadScenarioWithExtends(absScenario)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := scenarioVars(scen, absScenario)
+	if err != nil {
+		return nil, err
+	}
+
+	base := filepath.Dir(absScenario)
+	seen := map[string]bool{}
+	add := func(paths ...string) {
+		for _, p := range paths {
+			seen[p] = true
+		}
+	}
+	addRel := func(refs ...string) {
+		for _, ref := range refs {
+			if ref != "" {
+				add(internal.MustAbsJoin(base, ref))
+			}
+		}
+	}
+
+	add(scen.ExtendsChain()...)
+	boundaryRef, err := internal.RenderTemplateText(scen.PermissionsBoundary, vars)
+	if err != nil {
+		return nil, fmt.Errorf("permissions_boundary: %v", err)
+	}
+	if !internal.IsManagedPolicyARN(boundaryRef) {
+		addRel(boundaryRef)
+	}
+	addRel(scen.VarsFile, scen.ExpectationsFile, scen.PolicyJSON, scen.PolicyTemplate, scen.ResourcePolicyJSON, scen.ResourcePolicyTemplate)
+	for _, ref := range scen.PolicyPaths {
+		rendered, err := internal.RenderTemplateText(ref, vars)
+		if err != nil {
+			return nil, fmt.Errorf("policy_paths entry %q: %v", ref, err)
+		}
+		if !internal.IsManagedPolicyARN(rendered) {
+			add(internal.ExpandGlobsRelative(base, []string{rendered})...)
+		}
+	}
+	add(internal.ExpandGlobsRelative(base, scen.SCPPaths)...)
+	for _, t := range scen.Tests {
+		addRel(t.ResourcePolicyJSON, t.ResourcePolicyTemplate)
+	}
+
+	files := make([]string, 0, len(seen))
+	for p := range seen {
+		files = append(files, p)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// runCompare implements `politest compare`: simulate two identity policies against the same actions
+// Exits 0 when they allow the same actions, the failure code when they differ and 1 on errors
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("politest compare", flag.ContinueOnError)
+	policyA := fs.String("policy-a", "", "Path to the first identity policy JSON")
+	policyB := fs.String("policy-b", "", "Path to the second identity policy JSON")
+	actionsFile := fs.String("actions-file", "", "File with one \"action [resource]\" per line (resource defaults to *)")
+	profile := fs.String("profile", "", "Named AWS profile from the shared config/credentials files")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+	if err := validateArgs(fs.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if *policyA == "" || *policyB == "" || *actionsFile == "" {
+		fmt.Fprintln(os.Stderr, "Usage: politest compare --policy-a <a.json> --policy-b <b.json> --actions-file <actions.txt>")
+		return 1
+	}
+
+	docA, err := loadComparePolicy(*policyA)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	docB, err := loadComparePolicy(*policyB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	inputs, err := internal.ParseActionsFile(*actionsFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	awsCfg, err := config.LoadDefaultConfig(ctx, awsConfigOptions(*profile)...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	results, err := internal.ComparePolicies(ctx, iam.NewFromConfig(awsCfg), docA, docB, inputs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if internal.PrintComparison(os.Stdout, *policyA, *policyB, results) > 0 {
+		return internal.ExitCodeFailure
+	}
+	return 0
+}
+
+// loadComparePolicy reads a policy JSON file and strips non-IAM fields as a scenario run would
+func loadComparePolicy(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var policyData any
+	if err := json.Unmarshal(b, &policyData); err != nil {
+		return "", &internal.PolicyValidationError{Kind: "policy file", Path: path, Err: err}
+	}
+	stripped, err := internal.StripNonIAMFields(internal.ToJSONPretty(policyData))
+	if err != nil {
+		return "", &internal.PolicyValidationError{Kind: "policy file", Path: path, Err: err}
+	}
+	return stripped, nil
+}
+
 func main() {
 	os.Exit(realMain(os.Args[1:]))
 }
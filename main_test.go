@@ -2,12 +2,26 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"politest/internal"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
 )
 
 func TestPrintVersion(t *testing.T) {
@@ -381,6 +395,222 @@ func TestParseFlags(t *testing.T) {
 	}
 }
 
+func TestParseFlagsMatchOrdering(t *testing.T) {
+	flags, _, err := parseFlags([]string{"--scenario", "test.yml", "--raw-match-order", "--dedupe-matches"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !flags.rawMatchOrder {
+		t.Error("Expected rawMatchOrder to be true")
+	}
+	if !flags.dedupeMatches {
+		t.Error("Expected dedupeMatches to be true")
+	}
+}
+
+func TestRealMainStrictYAML(t *testing.T) {
+	defer func() { internal.StrictYAML = false }()
+
+	tmpDir := t.TempDir()
+	scenarioPath := filepath.Join(tmpDir, "scenario.yml")
+	scenarioContent := `policy_json: "policy.json"
+tets:
+  - action: "s3:GetObject"
+`
+	if err := os.WriteFile(scenarioPath, []byte(scenarioContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	code := realMain([]string{"--scenario", scenarioPath, "--strict-yaml"})
+	w.Close()
+	os.Stderr = oldStderr
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if code != 1 {
+		t.Errorf("realMain() = %d, want 1", code)
+	}
+	if !strings.Contains(buf.String(), "field tets not found") {
+		t.Errorf("Expected unknown field error, got: %s", buf.String())
+	}
+}
+
+func TestParseFlagsFormat(t *testing.T) {
+	flags, _, err := parseFlags([]string{"--scenario", "test.yml", "--format", "jsonl"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if flags.format != "jsonl" {
+		t.Errorf("Expected format jsonl, got %q", flags.format)
+	}
+
+	if flags, _, err := parseFlags([]string{"--format", "console-style"}); err != nil || flags.format != internal.FormatConsole {
+		t.Errorf("Expected --format console-style to be accepted, got %v", err)
+	}
+	if _, _, err := parseFlags([]string{"--format", "console-style", "--template-file", "report.tmpl"}); err == nil || !strings.Contains(err.Error(), "--template-file") {
+		t.Errorf("Expected --template-file to be rejected with console-style, got: %v", err)
+	}
+	if _, _, err := parseFlags([]string{"--format", "xml"}); err == nil || !strings.Contains(err.Error(), "--format") {
+		t.Errorf("Expected --format validation error, got: %v", err)
+	}
+}
+
+func TestRealMainActionsFromPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	policy := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject"],"Resource":"*"}]}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "policy.json"), []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// No tests yet: generation bootstraps them
+	scenarioPath := filepath.Join(tmpDir, "scenario.yml")
+	if err := os.WriteFile(scenarioPath, []byte("policy_json: \"policy.json\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outPath := filepath.Join(tmpDir, "tests.yml")
+	if code := realMain([]string{"--scenario", scenarioPath, "--actions-from-policy", outPath}); code != 0 {
+		t.Fatalf("realMain() = %d, want 0", code)
+	}
+
+	b, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`action: "s3:GetObject"`, `action: "s3:PutObject"`, `expect: "allowed"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("Expected %s in generated tests, got:\n%s", want, b)
+		}
+	}
+}
+
+func TestAWSConfigOptions(t *testing.T) {
+	if opts := awsConfigOptions(""); len(opts) != 0 {
+		t.Errorf("Expected no options without a profile, got %d", len(opts))
+	}
+
+	opts := awsConfigOptions("prod")
+	if len(opts) != 1 {
+		t.Fatalf("Expected 1 option for a profile, got %d", len(opts))
+	}
+	var lo config.LoadOptions
+	if err := opts[0](&lo); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lo.SharedConfigProfile != "prod" {
+		t.Errorf("Expected SharedConfigProfile prod, got %q", lo.SharedConfigProfile)
+	}
+}
+
+func TestRealMainVersionJSON(t *testing.T) {
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	exitCode := realMain([]string{"--version", "--json"})
+
+	w.Close()
+	os.Stdout = oldStdout
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", exitCode)
+	}
+	var info map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+		t.Fatalf("Expected JSON output, got %q: %v", buf.String(), err)
+	}
+	if info["version"] != "dev" || info["commit"] != "unknown" || info["built"] != "unknown" || info["go"] != runtime.Version() {
+		t.Errorf("Unexpected version JSON: %v", info)
+	}
+
+	if _, _, err := parseFlags([]string{"--json"}); err == nil {
+		t.Error("Expected --json without --version to be rejected")
+	}
+}
+
+func TestAnalyzerSkipReason(t *testing.T) {
+	ctx := context.Background()
+	working := aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	})
+	failing := aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return aws.Credentials{}, errors.New("no valid providers in chain")
+	})
+
+	tests := []struct {
+		name string
+		cfg  aws.Config
+		want string
+	}{
+		{"no provider", aws.Config{Region: "us-east-1"}, "no AWS credentials configured"},
+		{"retrieve fails", aws.Config{Region: "us-east-1", Credentials: failing}, "no valid providers in chain"},
+		{"no region", aws.Config{Credentials: working}, "no AWS region configured"},
+		{"ready", aws.Config{Region: "us-east-1", Credentials: working}, ""},
+	}
+	for _, tt := range tests {
+		got := analyzerSkipReason(ctx, tt.cfg)
+		if (tt.want == "") != (got == "") || !strings.Contains(got, tt.want) {
+			t.Errorf("%s: analyzerSkipReason() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseFlagsWebhook(t *testing.T) {
+	flags, _, err := parseFlags([]string{"--webhook-url", "https://hooks.example.com/x"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if flags.webhookURL != "https://hooks.example.com/x" || flags.webhookOn != "failure" {
+		t.Errorf("Unexpected webhook flags: url=%q on=%q", flags.webhookURL, flags.webhookOn)
+	}
+
+	if _, _, err := parseFlags([]string{"--webhook-on", "sometimes"}); err == nil || !strings.Contains(err.Error(), "--webhook-on") {
+		t.Errorf("Expected --webhook-on validation error, got: %v", err)
+	}
+}
+
+func TestParseFlagsShuffle(t *testing.T) {
+	flags, _, err := parseFlags([]string{"--shuffle"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !flags.shuffle.enabled || flags.shuffle.seedSet {
+		t.Errorf("Expected --shuffle without a seed, got %+v", flags.shuffle)
+	}
+
+	flags, _, err = parseFlags([]string{"--shuffle=1234", "--scenario", "s.yml"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !flags.shuffle.enabled || shuffleSeed(flags.shuffle) != 1234 || flags.scenarioPath != "s.yml" {
+		t.Errorf("Expected --shuffle=1234, got %+v", flags.shuffle)
+	}
+
+	if _, _, err := parseFlags([]string{"--shuffle=soon"}); err == nil {
+		t.Error("Expected error for a non-numeric seed")
+	}
+}
+
+func TestParseFlagsContext(t *testing.T) {
+	flags, _, err := parseFlags([]string{"--context", "aws:MultiFactorAuthPresent=true:boolean", "--context", "aws:RequestedRegion=eu-west-1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(flags.contexts) != 2 || flags.contexts[1] != "aws:RequestedRegion=eu-west-1" {
+		t.Errorf("Expected both --context values, got %v", flags.contexts)
+	}
+
+	if _, _, err := parseFlags([]string{"--context", "missing-equals"}); err == nil {
+		t.Error("Expected error for malformed --context")
+	}
+}
+
 func TestParseFlagsWithRemainingArgs(t *testing.T) {
 	flags, remaining, err := parseFlags([]string{"--scenario", "test.yml", "extra", "args"})
 	if err != nil {
@@ -794,6 +1024,116 @@ tests:
 	}
 }
 
+func TestPrepareSimulationPolicyPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(tmpDir, "extra"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.json", "b.json"} {
+		policy := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`
+		if err := os.WriteFile(filepath.Join(tmpDir, "extra", name), []byte(policy), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scenarioPath := filepath.Join(tmpDir, "scenario.yml")
+	scenarioContent := `vars:
+  policy_name: "ReadOnlyAccess"
+policy_paths:
+  - "extra/*.json"
+  - "arn:aws:iam::aws:policy/{{.policy_name}}"
+tests:
+  - action: "s3:GetObject"
+    resource: "*"
+    expect: "allowed"
+`
+	if err := os.WriteFile(scenarioPath, []byte(scenarioContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	prep, err := prepareSimulation(scenarioPath, false, false, false, os.Stdout)
+	if err != nil {
+		t.Fatalf("prepareSimulation() error = %v", err)
+	}
+	if prep.policyJSON != "" {
+		t.Errorf("policyJSON = %q, want empty when only policy_paths is set", prep.policyJSON)
+	}
+	if len(prep.additionalPolicies) != 3 {
+		t.Fatalf("additionalPolicies has %d entries, want 3", len(prep.additionalPolicies))
+	}
+	if filepath.Base(prep.additionalPolicies[0].source) != "a.json" || prep.additionalPolicies[0].document == "" {
+		t.Errorf("first entry = %+v, want loaded a.json", prep.additionalPolicies[0])
+	}
+	managed := prep.additionalPolicies[2]
+	if managed.source != "arn:aws:iam::aws:policy/ReadOnlyAccess" || managed.document != "" {
+		t.Errorf("managed entry = %+v, want unresolved rendered ARN", managed)
+	}
+}
+
+func TestPolicySizeBudget(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	policy := `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "Read",
+      "Effect": "Allow",
+      "Action": "s3:GetObject",
+      "Resource": "*"
+    }
+  ]
+}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "policy.json"), []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scenarioPath := filepath.Join(tmpDir, "scenario.yml")
+	if err := os.WriteFile(scenarioPath, []byte("policy_json: policy.json\ntests:\n  - action: s3:GetObject\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	prep, err := prepareSimulation(scenarioPath, false, false, false, os.Stdout)
+	if err != nil {
+		t.Fatalf("prepareSimulation() error = %v", err)
+	}
+	// Measured without whitespace or the injected tracking Sid
+	want := len(`{"Statement":[{"Action":"s3:GetObject","Effect":"Allow","Resource":"*","Sid":"Read"}],"Version":"2012-10-17"}`)
+	if len(prep.policySizes) != 1 || prep.policySizes[0].bytes != want {
+		t.Fatalf("policySizes = %+v, want one entry of %d bytes", prep.policySizes, want)
+	}
+
+	if err := checkPolicySizes(prep.policySizes, 0); err != nil {
+		t.Errorf("Expected no budget check when budget is 0, got %v", err)
+	}
+	if err := checkPolicySizes(prep.policySizes, want); err != nil {
+		t.Errorf("Expected policy at the budget to pass, got %v", err)
+	}
+	err = checkPolicySizes(prep.policySizes, want-10)
+	if err == nil || !strings.Contains(err.Error(), "policy.json: "+strconv.Itoa(want)+" bytes") || !strings.Contains(err.Error(), "over by 10") {
+		t.Errorf("Expected budget error naming the file and size, got: %v", err)
+	}
+}
+
+func TestPrepareSimulationPolicyPathsNoMatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	scenarioPath := filepath.Join(tmpDir, "scenario.yml")
+	scenarioContent := `policy_paths:
+  - "missing/*.json"
+tests:
+  - action: "s3:GetObject"
+    expect: "allowed"
+`
+	if err := os.WriteFile(scenarioPath, []byte(scenarioContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := prepareSimulation(scenarioPath, false, false, false, os.Stdout)
+	if err == nil || !strings.Contains(err.Error(), "matched no files") {
+		t.Errorf("expected 'matched no files' error, got: %v", err)
+	}
+}
+
 func TestPrepareSimulationInvalidResourcePolicyJSON(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -836,3 +1176,978 @@ tests:
 		t.Errorf("Expected 'invalid JSON in resource policy file' error, got: %v", err)
 	}
 }
+
+func TestParseFlagsWithConfigFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "politest.yml")
+	configContent := `no-warn: true
+show-matched-success: true
+save: /tmp/from-config.json
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	flags, _, err := parseFlags([]string{"--config", configPath, "--save", "explicit.json"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !flags.noWarn {
+		t.Error("Expected noWarn to be set from config file")
+	}
+	if !flags.showMatchedSuccess {
+		t.Error("Expected showMatchedSuccess to be set from config file")
+	}
+	if flags.savePath != "explicit.json" {
+		t.Errorf("Expected explicit flag to override config file, got %s", flags.savePath)
+	}
+}
+
+func TestParseFlagsDiscoversDefaultConfigFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, defaultConfigFile), []byte("debug: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmpDir)
+
+	flags, _, err := parseFlags([]string{"--scenario", "test.yml"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !flags.debug {
+		t.Error("Expected debug to be set from discovered config file")
+	}
+}
+
+func TestParseFlagsConfigFileErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "unknown flag", content: "region: eu-west-2\n", wantErr: "unknown flag 'region'"},
+		{name: "invalid value", content: "no-warn: maybe\n", wantErr: "invalid value for 'no-warn'"},
+		{name: "invalid yaml", content: "no-warn: [\n", wantErr: "failed to load config file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(tmpDir, strings.ReplaceAll(tt.name, " ", "-")+".yml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, _, err := parseFlags([]string{"--config", configPath})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if _, _, err := parseFlags([]string{"--config", filepath.Join(tmpDir, "missing.yml")}); err == nil {
+		t.Error("Expected error for missing explicit config file")
+	}
+}
+
+func TestRealMainDoctorUnknownArgs(t *testing.T) {
+	if code := realMain([]string{"doctor", "extra"}); code != 1 {
+		t.Errorf("Expected exit code 1 for unknown doctor arguments, got %d", code)
+	}
+}
+
+func TestRealMainSelfTest(t *testing.T) {
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	code := realMain([]string{"selftest"})
+	w.Close()
+	os.Stdout = oldStdout
+	var out bytes.Buffer
+	io.Copy(&out, r)
+
+	if code != 0 {
+		t.Fatalf("Expected selftest to pass, got exit %d:\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "Self-test passed.") || strings.Contains(out.String(), "✗") {
+		t.Errorf("Unexpected selftest report:\n%s", out.String())
+	}
+	if code := realMain([]string{"selftest", "extra"}); code != 1 {
+		t.Errorf("Expected exit code 1 for unknown selftest arguments, got %d", code)
+	}
+}
+
+func TestRealMainRedactsErrors(t *testing.T) {
+	// Capture stderr
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+
+	exitCode := realMain([]string{"--redact", "--scenario", "/nonexistent/123456789012/file.yml"})
+
+	w.Close()
+	os.Stderr = oldStderr
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	output := buf.String()
+
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1, got %d", exitCode)
+	}
+	if strings.Contains(output, "123456789012") {
+		t.Errorf("Expected account ID to be redacted, got: %s", output)
+	}
+	if !strings.Contains(output, "************") {
+		t.Errorf("Expected redaction mask in output, got: %s", output)
+	}
+}
+
+func TestRealMainErrorFormatJSON(t *testing.T) {
+	defer func() { internal.ErrorFormat = internal.ErrorFormatText }()
+	scenarioPath := filepath.Join(t.TempDir(), "broken.yml")
+	if err := os.WriteFile(scenarioPath, []byte("policy_json: policy.json\ntests: [\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	exitCode := realMain([]string{"--error-format", "json", "--scenario", scenarioPath})
+	w.Close()
+	os.Stderr = oldStderr
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1, got %d", exitCode)
+	}
+	var report internal.ErrorReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("Expected one JSON error object on stderr, got %q: %v", buf.String(), err)
+	}
+	if report.Kind != internal.ErrorKindYAML || report.File != scenarioPath || report.Line == 0 || report.Error == "" {
+		t.Errorf("Unexpected error report: %+v", report)
+	}
+
+	// A malformed SCP is a policy error with its file and line, not a bare decoder message
+	tmpDir := t.TempDir()
+	scpPath := filepath.Join(tmpDir, "deny.json")
+	files := map[string]string{
+		"policy.json":  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`,
+		"deny.json":    "{\n  \"Version\": \"2012-10-17\",\n  \"Statement\": [\n",
+		"scenario.yml": "policy_json: policy.json\nscp_paths: [deny.json]\ntests:\n  - action: s3:GetObject\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, w, _ = os.Pipe()
+	os.Stderr = w
+	exitCode = realMain([]string{"--error-format", "json", "--scenario", filepath.Join(tmpDir, "scenario.yml")})
+	w.Close()
+	os.Stderr = oldStderr
+	buf.Reset()
+	io.Copy(&buf, r)
+
+	report = internal.ErrorReport{}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("Expected one JSON error object on stderr, got %q: %v", buf.String(), err)
+	}
+	if exitCode != 1 || report.Kind != internal.ErrorKindPolicy || report.File != scpPath || report.Line != 3 || !strings.Contains(report.Error, "invalid JSON in SCP "+scpPath) {
+		t.Errorf("Unexpected error report for a malformed SCP (exit %d): %+v", exitCode, report)
+	}
+
+	// --keep-going reports each errored scenario as its own JSON object, keeping the kind and file
+	r, w, _ = os.Pipe()
+	os.Stderr = w
+	realMain([]string{"--error-format", "json", "--scenarios-dir", tmpDir, "--keep-going", "--no-summary"})
+	w.Close()
+	os.Stderr = oldStderr
+	buf.Reset()
+	io.Copy(&buf, r)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	report = internal.ErrorReport{}
+	if err := json.Unmarshal([]byte(lines[0]), &report); err != nil {
+		t.Fatalf("Expected a JSON error object per errored scenario, got %q: %v", buf.String(), err)
+	}
+	if report.Kind != internal.ErrorKindPolicy || report.File != scpPath || !strings.HasPrefix(report.Error, "scenario.yml: ") {
+		t.Errorf("Unexpected error report for an errored scenario under --keep-going: %+v", report)
+	}
+
+	// Flag errors are reported in the requested format too
+	r, w, _ = os.Pipe()
+	os.Stderr = w
+	realMain([]string{"--error-format", "json", "--keep-going"})
+	w.Close()
+	os.Stderr = oldStderr
+	buf.Reset()
+	io.Copy(&buf, r)
+
+	report = internal.ErrorReport{}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("Expected a JSON error object for a flag error, got %q: %v", buf.String(), err)
+	}
+	if !strings.Contains(report.Error, "--keep-going requires --scenarios-dir") {
+		t.Errorf("Unexpected error report for a flag error: %+v", report)
+	}
+
+	if _, _, err := parseFlags([]string{"--error-format", "xml"}); err == nil {
+		t.Error("Expected --error-format xml to be rejected")
+	}
+}
+
+func TestRealMainDisabledScenario(t *testing.T) {
+	// A disabled scenario is skipped before validation, so it may be incomplete
+	tmpDir := t.TempDir()
+	scenarioPath := filepath.Join(tmpDir, "wip.yml")
+	if err := os.WriteFile(scenarioPath, []byte("disabled: true\ntests: []\n"), 0600); err != nil {
+		t.Fatalf("Failed to create scenario file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	prep, err := prepareSimulation(scenarioPath, false, false, false, &buf)
+	if err != nil {
+		t.Fatalf("Expected no error for disabled scenario, got: %v", err)
+	}
+	if !prep.disabled {
+		t.Error("Expected prep to be marked disabled")
+	}
+
+	// Capture stdout
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	exitCode := realMain([]string{"--scenario", scenarioPath})
+
+	w.Close()
+	os.Stdout = oldStdout
+
+	var out bytes.Buffer
+	io.Copy(&out, r)
+
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0 for disabled scenario, got %d", exitCode)
+	}
+	if !strings.Contains(out.String(), "SKIP") {
+		t.Errorf("Expected SKIP notice, got: %s", out.String())
+	}
+}
+
+func TestRealMainCustomExitCodes(t *testing.T) {
+	defer func() { internal.ExitCodeError, internal.ExitCodeFailure = 1, 2 }()
+
+	// Capture stderr
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+
+	exitCode := realMain([]string{"--exit-code-on-error", "7", "--exit-code-on-failure", "9", "--scenario", "/nonexistent/file.yml"})
+
+	w.Close()
+	os.Stderr = oldStderr
+	io.Copy(io.Discard, r)
+
+	if exitCode != 7 {
+		t.Errorf("Expected custom error exit code 7, got %d", exitCode)
+	}
+	if internal.ExitCodeFailure != 9 {
+		t.Errorf("Expected failure exit code 9 to be applied, got %d", internal.ExitCodeFailure)
+	}
+
+	// A flag error after --exit-code-on-error has parsed uses the custom code too
+	r, w, _ = os.Pipe()
+	os.Stderr = w
+	exitCode = realMain([]string{"--exit-code-on-error", "7", "--keep-going"})
+	w.Close()
+	os.Stderr = oldStderr
+	io.Copy(io.Discard, r)
+
+	if exitCode != 7 {
+		t.Errorf("Expected custom error exit code 7 for a flag error, got %d", exitCode)
+	}
+}
+
+func TestParseFlagsInvalidExitCode(t *testing.T) {
+	for _, args := range [][]string{
+		{"--exit-code-on-failure", "256"},
+		{"--exit-code-on-error", "-1"},
+	} {
+		if _, _, err := parseFlags(args); err == nil || !strings.Contains(err.Error(), "between 0 and 255") {
+			t.Errorf("parseFlags(%v) expected range error, got %v", args, err)
+		}
+	}
+}
+
+func TestRealMainParallelScenarios(t *testing.T) {
+	tmpDir := t.TempDir()
+	scenariosDir := filepath.Join(tmpDir, "scenarios")
+	for _, name := range []string{"a-pass.yml", "b-fail.yml", "c-error.yml", "d-pass.yml"} {
+		path := filepath.Join(scenariosDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("tests: []\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Stand-in for the politest binary: reports through its metrics file and exit code like a real scenario run.
+	// The first scenario is the slowest, so output order can only come from the path order
+	stub := filepath.Join(tmpDir, "politest-stub")
+	if err := os.WriteFile(stub, []byte(`#!/bin/sh
+failure_code=2
+for a in "$@"; do
+  case "$a" in
+    --exit-code-on-failure=*) failure_code="${a#--exit-code-on-failure=}" ;;
+    --metrics-file=*) metrics="${a#--metrics-file=}" ;;
+    --scenario=*) scenario="${a#--scenario=}" ;;
+    --error-format=json) json=1 ;;
+  esac
+done
+echo "args: $*" | sed "s#$scenario#SCENARIO#; s#--metrics-file=[^ ]*#METRICS#"
+case "$scenario" in
+  *a-pass*) sleep 0.2; passed=2; failed=0 ;;
+  *fail*) passed=1; failed=2 ;;
+  *error*)
+    if [ -n "$json" ]; then echo '{"error":"policy file not found","kind":"file_not_found","file":"policy.json"}' >&2
+    else echo "policy file not found" >&2; fi
+    exit 1 ;;
+  *) passed=1; failed=0 ;;
+esac
+printf 'politest_tests_passed{scenario="%s"} %d\npolitest_tests_failed{scenario="%s"} %d\n' "$scenario" "$passed" "$scenario" "$failed" > "$metrics"
+[ "$failed" -eq 0 ] || exit "$failure_code"
+`), 0755); err != nil {
+		t.Fatal(err)
+	}
+	original := scenarioExecutable
+	defer func() { scenarioExecutable = original }()
+	scenarioExecutable = func() (string, error) { return stub, nil }
+
+	capture := func(args ...string) (int, string) {
+		oldStdout, oldStderr := os.Stdout, os.Stderr
+		r, w, _ := os.Pipe()
+		os.Stdout, os.Stderr = w, w
+		code := realMain(args)
+		w.Close()
+		os.Stdout, os.Stderr = oldStdout, oldStderr
+		var out bytes.Buffer
+		io.Copy(&out, r)
+		return code, out.String()
+	}
+
+	metricsPath := filepath.Join(tmpDir, "metrics.prom")
+	code, out := capture("--scenarios-dir", scenariosDir, "--parallel-scenarios", "4", "--keep-going", "--context", "aws:SourceIp=10.0.0.1:ip", "--context", "aws:SecureTransport=true:boolean", "--metrics-file", metricsPath)
+	if code != 1 {
+		t.Errorf("Expected exit code 1 when a scenario errored, got %d:\n%s", code, out)
+	}
+	for _, want := range []string{
+		"=== a-pass.yml ===\nargs: --no-config-discovery --context=aws:SourceIp=10.0.0.1:ip --context=aws:SecureTransport=true:boolean --scenario=SCENARIO METRICS\n",
+		"Scenarios: 3 ran (2 passed, 1 failed), 1 errored",
+		"Errored:\n  - c-error.yml: policy file not found",
+		"Failed:\n  - b-fail.yml",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+	if a, b := strings.Index(out, "=== a-pass.yml"), strings.Index(out, "=== b-fail.yml"); a < 0 || b < a {
+		t.Errorf("Expected scenarios reported in path order:\n%s", out)
+	}
+	metrics, err := os.ReadFile(metricsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `politest_tests_failed{scenario="` + filepath.Join(scenariosDir, "b-fail.yml") + `"} 2`; !strings.Contains(string(metrics), want) {
+		t.Errorf("Expected child metrics merged into --metrics-file (%s):\n%s", want, metrics)
+	}
+
+	// A remapped failure exit code still identifies the failed scenario
+	code, out = capture("--scenarios-dir", scenariosDir, "--parallel-scenarios", "4", "--keep-going", "--exit-code-on-failure", "0")
+	if code != 1 || !strings.Contains(out, "Scenarios: 3 ran (2 passed, 1 failed), 1 errored") {
+		t.Errorf("Expected a failure exit code of 0 to still count the failed scenario, got %d:\n%s", code, out)
+	}
+
+	// Without --keep-going nothing after the first error is reported
+	code, out = capture("--scenarios-dir", scenariosDir, "--parallel-scenarios", "2")
+	if code != 1 || strings.Contains(out, "d-pass.yml ===") || !strings.Contains(out, "c-error.yml: policy file not found") {
+		t.Errorf("Expected stop at first error with exit 1, got %d:\n%s", code, out)
+	}
+
+	// Under --error-format json a child's report keeps its kind and file instead of being encoded again
+	code, out = capture("--scenarios-dir", scenariosDir, "--parallel-scenarios", "2", "--keep-going", "--error-format", "json")
+	if want := `{"error":"c-error.yml: policy file not found","kind":"file_not_found","file":"policy.json"}`; code != 1 || !strings.Contains(out, want) {
+		t.Errorf("Expected the child's error report passed through (%s), got %d:\n%s", want, code, out)
+	}
+	internal.ErrorFormat = internal.ErrorFormatText
+
+	// --parallel-scenarios from .politest.yml: the children get the resolved config as flags and don't
+	// read the file again, which would combine its scenarios-dir with their --scenario
+	t.Chdir(tmpDir)
+	if err := os.WriteFile(defaultConfigFile, []byte("scenarios-dir: scenarios\nparallel-scenarios: 2\nkeep-going: true\nno-warn: true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	code, out = capture()
+	if code != 1 || !strings.Contains(out, "=== a-pass.yml ===\nargs: --no-config-discovery --no-warn=true --scenario=SCENARIO METRICS\n") {
+		t.Errorf("Expected config values forwarded as flags with discovery off, got %d:\n%s", code, out)
+	}
+	if _, _, err := parseFlags([]string{"--no-config-discovery", "--no-warn=true", "--scenario=" + filepath.Join(scenariosDir, "a-pass.yml")}); err != nil {
+		t.Errorf("Expected a child's flags to parse next to the parent's config file, got %v", err)
+	}
+}
+
+func TestParseFlagsFailOnSeverity(t *testing.T) {
+	flags, _, err := parseFlags([]string{"--fail-on-severity", "high"})
+	if err != nil || flags.failOnSeverity != "high" {
+		t.Errorf("Expected --fail-on-severity high to be accepted, got %v", err)
+	}
+	if _, _, err := parseFlags([]string{"--fail-on-severity", "urgent"}); err == nil || !strings.Contains(err.Error(), "--fail-on-severity must be one of") {
+		t.Errorf("Expected an unknown severity to be rejected, got %v", err)
+	}
+}
+
+func TestParseFlagsParallelScenarios(t *testing.T) {
+	if _, _, err := parseFlags([]string{"--parallel-scenarios", "4"}); err == nil || !strings.Contains(err.Error(), "requires --scenarios-dir") {
+		t.Errorf("Expected --parallel-scenarios to require --scenarios-dir, got %v", err)
+	}
+	if _, _, err := parseFlags([]string{"--scenarios-dir", "scenarios", "--parallel-scenarios", "-1"}); err == nil {
+		t.Error("Expected a negative --parallel-scenarios to be rejected")
+	}
+	flags, _, err := parseFlags([]string{"--scenarios-dir", "scenarios", "--parallel-scenarios", "4", "--keep-going", "--shuffle", "--no-warn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"--no-warn=true", "--shuffle=true"}; !slices.Equal(flags.childArgs, want) {
+		t.Errorf("childArgs = %q, want %q", flags.childArgs, want)
+	}
+}
+
+func TestRealMainScenariosDirKeepGoing(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"_common.yml":            "vars: {}\n",                             // shared base, not run
+		"a-wip.yml":              "disabled: true\ntests: []\n",            // runs (skipped) without AWS
+		"b-bad-policy.yml":       "policy_json: missing.json\ntests: []\n", // errors while loading
+		"b-bad-template.yml":     "policy_template: policies/bad.json.tmpl\ntests:\n  - action: s3:GetObject\n",
+		"b-bad-scp.yml":          "policy_json: policies/allow.json\nscp_paths: [policies/bad-scp.json]\ntests:\n  - action: s3:GetObject\n",
+		"b-bad-action.yml":       "policy_json: policies/allow.json\ntests:\n  - name: broken\n    action: \"s3:{{.missing}}\"\n",
+		"nested/c-no-policy.yml": "tests:\n  - action: s3:GetObject\n",
+		"vars/shared.yml":        "bucket: logs\n", // not a scenario
+		"policies/bad.json.tmpl": `{"Version": "2012-10-17", "Statement": [`,
+		"policies/bad-scp.json":  `{"Version": "2012-10-17", "Statement": [`,
+		"policies/allow.json":    `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	capture := func(args ...string) (int, string) {
+		oldStdout, oldStderr := os.Stdout, os.Stderr
+		r, w, _ := os.Pipe()
+		os.Stdout, os.Stderr = w, w
+		code := realMain(args)
+		w.Close()
+		os.Stdout, os.Stderr = oldStdout, oldStderr
+		var out bytes.Buffer
+		io.Copy(&out, r)
+		return code, out.String()
+	}
+
+	// Without --keep-going the first broken scenario stops the run
+	code, out := capture("--scenarios-dir", tmpDir)
+	if code != 1 || strings.Contains(out, "c-no-policy.yml ===") {
+		t.Errorf("Expected stop at first error with exit 1, got %d:\n%s", code, out)
+	}
+
+	code, out = capture("--scenarios-dir", tmpDir, "--keep-going")
+	if code != 1 {
+		t.Errorf("Expected exit code 1 when scenarios errored, got %d", code)
+	}
+	if strings.Contains(out, "_common.yml") {
+		t.Errorf("Files starting with _ should not run:\n%s", out)
+	}
+	if strings.Contains(out, "shared.yml") {
+		t.Errorf("Vars files without tests or actions should not run:\n%s", out)
+	}
+	for _, want := range []string{
+		"Scenarios: 1 ran (1 passed, 0 failed), 5 errored",
+		// A broken inline test template errors its scenario without exiting the run
+		"  - b-bad-action.yml: test 'broken': action: ",
+		"  - b-bad-policy.yml: ",
+		// Invalid JSON is reported per scenario, naming the file, instead of exiting the run
+		"  - b-bad-scp.yml: invalid JSON in SCP " + filepath.Join(tmpDir, "policies", "bad-scp.json"),
+		"  - b-bad-template.yml: invalid JSON in template " + filepath.Join(tmpDir, "policies", "bad.json.tmpl"),
+		"  - " + filepath.Join("nested", "c-no-policy.yml") + ": ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestScenarioMatrix(t *testing.T) {
+	tmpDir := t.TempDir()
+	scenario := filepath.Join(tmpDir, "matrix.yml")
+	content := "matrix:\n  env: [dev, prod]\n  region: [eu-west-2]\npolicy_template: policy.json.tmpl\ntests:\n  - action: s3:GetObject\n"
+	if err := os.WriteFile(scenario, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"arn:aws:s3:::{{.env}}-{{.region}}/*"}]}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "policy.json.tmpl"), []byte(tmpl), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// --matrix replaces the region axis and the scenario keeps env
+	flags := &cliFlags{scenarioPath: scenario, matrix: stringListFlag{"region=us-east-1,us-west-2"}}
+	cells, err := scenarioMatrix(flags)
+	if err != nil {
+		t.Fatalf("scenarioMatrix() error = %v", err)
+	}
+	if len(cells) != 4 || cells[3].Label() != "env=prod, region=us-west-2" {
+		t.Fatalf("Unexpected cells: %v", cells)
+	}
+
+	prep, err := prepareSimulationWithInputs(scenario, scenarioInputs{vars: cells[3].Vars()}, true, false, false, io.Discard)
+	if err != nil {
+		t.Fatalf("prepareSimulationWithInputs() error = %v", err)
+	}
+	if !strings.Contains(prep.policyJSON, "arn:aws:s3:::prod-us-west-2/*") {
+		t.Errorf("Expected matrix vars in rendered policy, got %s", prep.policyJSON)
+	}
+
+	flags.savePath = filepath.Join(tmpDir, "out.json")
+	if err := runMatrix(flags, cells, io.Discard); err == nil || !strings.Contains(err.Error(), "--save") {
+		t.Errorf("Expected --save to be rejected with a matrix, got %v", err)
+	}
+}
+
+func TestParseFlagsFromOrgAccount(t *testing.T) {
+	flags, _, err := parseFlags([]string{"--from-org-account", "111122223333"})
+	if err != nil || flags.fromOrgAccount != "111122223333" {
+		t.Errorf("Unexpected result: flags=%+v err=%v", flags, err)
+	}
+	for _, v := range []string{"1111", "ou-ab12-cd34ef56"} {
+		if _, _, err := parseFlags([]string{"--from-org-account", v}); err == nil || !strings.Contains(err.Error(), "12-digit") {
+			t.Errorf("Expected --from-org-account %q to be rejected, got %v", v, err)
+		}
+	}
+}
+
+func TestParseFlagsLintDisable(t *testing.T) {
+	flags, _, err := parseFlags([]string{"--lint", "--lint-disable", " allow-deny-conflict"})
+	if err != nil || !flags.lint || len(flags.lintDisable) != 1 || flags.lintDisable[0] != internal.LintRuleAllowDenyConflict {
+		t.Errorf("Unexpected result: flags=%+v err=%v", flags, err)
+	}
+	if _, _, err := parseFlags([]string{"--lint", "--lint-disable", "allow-deny-conflict,no-such-rule"}); err == nil || !strings.Contains(err.Error(), "no-such-rule") {
+		t.Errorf("Expected unknown rule to be rejected, got %v", err)
+	}
+}
+
+func TestPrepareSimulationInvalidPolicies(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"bad.json.tmpl":    `{"Version": "2012-10-17", "Statement": [{{ .missing_comma }}`,
+		"bad-scp.json":     `{"Version": "2012-10-17", "Statement": [`,
+		"policy.json":      `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`,
+		"bad-template.yml": "policy_template: bad.json.tmpl\nvars:\n  missing_comma: \"{}\"\ntests:\n  - action: s3:GetObject\n",
+		"bad-scp.yml":      "policy_json: policy.json\nscp_paths: [bad-scp.json]\ntests:\n  - action: s3:GetObject\n",
+		"bad-resource.yml": "policy_json: policy.json\nresource_policy_template: bad.json.tmpl\nvars:\n  missing_comma: \"{}\"\ntests:\n  - action: s3:GetObject\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The errors are returned rather than exiting, so an embedding program keeps running
+	for scenario, file := range map[string]string{"bad-template.yml": "bad.json.tmpl", "bad-scp.yml": "bad-scp.json", "bad-resource.yml": "bad.json.tmpl"} {
+		_, err := prepareSimulation(filepath.Join(tmpDir, scenario), true, false, false, io.Discard)
+		var policyErr *internal.PolicyValidationError
+		if !errors.As(err, &policyErr) || policyErr.Path != filepath.Join(tmpDir, file) {
+			t.Errorf("%s: expected a *PolicyValidationError for %s, got %v", scenario, file, err)
+		}
+	}
+}
+
+func TestPrepareSimulationBoundaryOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"scp.json":      `{"Version":"2012-10-17","Statement":[{"Effect":"Deny","Action":"iam:*","Resource":"*"}]}`,
+		"boundary.yml":  "boundary_only: true\nscp_paths: [scp.json]\ntests:\n  - action: iam:CreateUser\n",
+		"no-scp.yml":    "boundary_only: true\ntests:\n  - action: iam:CreateUser\n",
+		"with-pol.yml":  "boundary_only: true\npolicy_json: scp.json\nscp_paths: [scp.json]\ntests:\n  - action: iam:CreateUser\n",
+		"no-policy.yml": "scp_paths: [scp.json]\ntests:\n  - action: iam:CreateUser\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prep, err := prepareSimulation(filepath.Join(tmpDir, "boundary.yml"), true, false, false, io.Discard)
+	if err != nil {
+		t.Fatalf("prepareSimulation() error = %v", err)
+	}
+	if prep.policyJSON != internal.BoundaryOnlyIdentityPolicy || prep.permissionsBoundary == "" {
+		t.Errorf("Expected synthetic identity policy and the SCP boundary, got %q / %q", prep.policyJSON, prep.permissionsBoundary)
+	}
+
+	for name, want := range map[string]string{
+		"no-scp.yml":    "requires 'scp_paths'",
+		"with-pol.yml":  "remove 'policy_json'",
+		"no-policy.yml": "must include 'policy_json'",
+	} {
+		if _, err := prepareSimulation(filepath.Join(tmpDir, name), true, false, false, io.Discard); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", name, want, err)
+		}
+	}
+}
+
+// boundaryPolicyGetter serves one managed policy document, or fails GetPolicy with err
+type boundaryPolicyGetter struct {
+	document string
+	err      error
+	calls    int
+}
+
+func (g *boundaryPolicyGetter) GetPolicy(ctx context.Context, params *iam.GetPolicyInput, optFns ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+	g.calls++
+	if g.err != nil {
+		return nil, g.err
+	}
+	return &iam.GetPolicyOutput{Policy: &types.Policy{Arn: params.PolicyArn, DefaultVersionId: aws.String("v1")}}, nil
+}
+
+func (g *boundaryPolicyGetter) GetPolicyVersion(ctx context.Context, params *iam.GetPolicyVersionInput, optFns ...func(*iam.Options)) (*iam.GetPolicyVersionOutput, error) {
+	return &iam.GetPolicyVersionOutput{PolicyVersion: &types.PolicyVersion{Document: aws.String(g.document)}}, nil
+}
+
+func TestPrepareSimulationManagedBoundary(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"policy.json":  `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`,
+		"scenario.yml": "vars:\n  account_id: \"111122223333\"\npolicy_json: policy.json\npermissions_boundary: \"arn:aws:iam::{{.account_id}}:policy/DeveloperBoundary\"\ntests:\n  - action: s3:GetObject\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prep, err := prepareSimulation(filepath.Join(tmpDir, "scenario.yml"), true, false, false, io.Discard)
+	if err != nil {
+		t.Fatalf("prepareSimulation() error = %v", err)
+	}
+	const boundaryARN = "arn:aws:iam::111122223333:policy/DeveloperBoundary"
+	if prep.boundaryARN != boundaryARN || prep.identityBoundary != "" {
+		t.Fatalf("Expected the boundary to be left for run time, got ARN %q and document %q", prep.boundaryARN, prep.identityBoundary)
+	}
+
+	getter := &boundaryPolicyGetter{document: `{"Version":"2012-10-17","Statement":[{"Sid":"AllowS3","Effect":"Allow","Action":"s3:*","Resource":"*"}]}`}
+	fetcher := internal.NewManagedPolicyFetcher(getter)
+	if err := resolveBoundaryPolicy(context.Background(), fetcher, prep); err != nil {
+		t.Fatalf("resolveBoundaryPolicy() error = %v", err)
+	}
+	if !strings.Contains(prep.identityBoundary, `"boundary#stmt:0"`) || prep.sourceMap.IdentityBoundaryRaw != prep.identityBoundary {
+		t.Errorf("Expected the fetched boundary with tracking Sids, got %s", prep.identityBoundary)
+	}
+	if src := prep.sourceMap.IdentityBoundary["boundary#stmt:0"]; src == nil || src.FilePath != boundaryARN || src.Sid != "AllowS3" {
+		t.Errorf("Expected the boundary statement attributed to the ARN, got %+v", src)
+	}
+
+	// The fetch is cached for the run
+	if _, err := fetcher.Fetch(context.Background(), boundaryARN); err != nil || getter.calls != 1 {
+		t.Errorf("Expected one GetPolicy call per ARN, got %d (err %v)", getter.calls, err)
+	}
+
+	prep.boundaryARN = "arn:aws:iam::111122223333:policy/Missing"
+	err = resolveBoundaryPolicy(context.Background(), internal.NewManagedPolicyFetcher(&boundaryPolicyGetter{err: errors.New("NoSuchEntity")}), prep)
+	if err == nil || !strings.Contains(err.Error(), "permissions_boundary") || !strings.Contains(err.Error(), "iam:GetPolicy") {
+		t.Errorf("Expected a permissions_boundary error naming iam:GetPolicy, got %v", err)
+	}
+
+	deps, err := scenarioDependencies(filepath.Join(tmpDir, "scenario.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dep := range deps {
+		if strings.Contains(dep, "arn:") {
+			t.Errorf("Expected the boundary ARN to be skipped by --list-files, got %s", dep)
+		}
+	}
+}
+
+func TestDumpMergedSCP(t *testing.T) {
+	originalStdout := internal.Stdout
+	defer func() { internal.Stdout = originalStdout }()
+	internal.Stdout = io.Discard
+
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"scp/010-base.json": "{\n  \"Version\": \"2012-10-17\",\n  \"Statement\": [\n    {\"Sid\": \"DenyLeave\", \"Effect\": \"Deny\", \"Action\": \"organizations:LeaveOrganization\", \"Resource\": \"*\"}\n  ]\n}",
+		"scp/020-regions.json": `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Effect": "Allow",
+      "Action": "*",
+      "Resource": "*"
+    },
+    {
+      "Sid": "DenyRegions",
+      "Effect": "Deny",
+      "Action": "*",
+      "Resource": "*"
+    }
+  ]
+}`,
+		"scenario.yml": "boundary_only: true\nscp_paths: [\"scp/*.json\"]\ntests:\n  - action: iam:CreateUser\n",
+		"no-scps.yml":  "policy_json: scp/010-base.json\ntests:\n  - action: iam:CreateUser\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prep, err := prepareSimulation(filepath.Join(tmpDir, "scenario.yml"), true, false, false, io.Discard)
+	if err != nil {
+		t.Fatalf("prepareSimulation() error = %v", err)
+	}
+	dumpPath := filepath.Join(tmpDir, "merged.json")
+	if err := dumpMergedSCP(dumpPath, prep.sourceMap); err != nil {
+		t.Fatalf("dumpMergedSCP() error = %v", err)
+	}
+
+	b, err := os.ReadFile(dumpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := string(b)
+	for _, want := range []string{`"Sid": "scp:010-base.json#stmt:0"`, `"Sid": "scp:020-regions.json#stmt:1"`, "\n  \"Statement\": ["} {
+		if !strings.Contains(merged, want) {
+			t.Errorf("Expected %q in the pretty-printed merged SCP:\n%s", want, merged)
+		}
+	}
+
+	var sources map[string]struct {
+		File      string `json:"file"`
+		Sid       string `json:"sid"`
+		Index     int    `json:"index"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+	}
+	if b, err = os.ReadFile(filepath.Join(tmpDir, "merged.sources.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &sources); err != nil {
+		t.Fatal(err)
+	}
+	got := sources["scp:020-regions.json#stmt:1"]
+	if got.File != filepath.Join(tmpDir, "scp/020-regions.json") || got.Sid != "DenyRegions" || got.Index != 1 || got.StartLine != 9 || got.EndLine != 14 {
+		t.Errorf("Unexpected source for scp:020-regions.json#stmt:1: %+v", got)
+	}
+	if len(sources) != 3 {
+		t.Errorf("Expected one source per merged statement, got %d", len(sources))
+	}
+
+	prep, err = prepareSimulation(filepath.Join(tmpDir, "no-scps.yml"), true, false, false, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dumpMergedSCP(dumpPath, prep.sourceMap); err == nil || !strings.Contains(err.Error(), "no SCPs") {
+		t.Errorf("Expected an error for a scenario without SCPs, got %v", err)
+	}
+	if _, _, err := parseFlags([]string{"--scenarios-dir", "scenarios", "--dump-merged-scp", "merged.json"}); err == nil {
+		t.Error("Expected --dump-merged-scp to be rejected with --scenarios-dir")
+	}
+}
+
+func TestPrepareSimulationSCPOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"scp/deny-iam.json":   `{"Version":"2012-10-17","Statement":[{"Sid":"DenyIAM","Effect":"Deny","Action":"iam:*","Resource":"*"}]}`,
+		"scp/deny-s3.json":    `{"Version":"2012-10-17","Statement":[{"Sid":"DenyS3","Effect":"Deny","Action":"s3:*","Resource":"*"}]}`,
+		"other/deny-iam.json": `{"Version":"2012-10-17","Statement":[{"Sid":"Other","Effect":"Deny","Action":"iam:*","Resource":"*"}]}`,
+		"scenario.yml":        "boundary_only: true\nscp_paths: [\"scp/*.json\"]\ntests:\n  - action: iam:CreateUser\n",
+		"ambiguous.yml":       "boundary_only: true\nscp_paths: [\"scp/*.json\", other/deny-iam.json]\ntests:\n  - action: iam:CreateUser\n",
+		"no-scps.yml":         "policy_json: scp/deny-s3.json\ntests:\n  - action: iam:CreateUser\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prep, err := prepareSimulationWithInputs(filepath.Join(tmpDir, "scenario.yml"), scenarioInputs{scpOnly: "deny-s3.json"}, true, false, false, io.Discard)
+	if err != nil {
+		t.Fatalf("prepareSimulationWithInputs() error = %v", err)
+	}
+	if strings.Contains(prep.permissionsBoundary, "iam:*") || !strings.Contains(prep.permissionsBoundary, "s3:*") {
+		t.Errorf("Expected only the deny-s3 SCP in the boundary, got %s", prep.permissionsBoundary)
+	}
+	for _, src := range prep.sourceMap.PermissionsBoundary {
+		if src.FilePath != filepath.Join(tmpDir, "scp/deny-s3.json") || src.Sid != "DenyS3" {
+			t.Errorf("Expected statements attributed to deny-s3.json, got %+v", src)
+		}
+	}
+
+	for name, tc := range map[string]struct{ scenario, scpOnly, want string }{
+		"unknown":   {"scenario.yml", "nope.json", "not one of the scenario's scp_paths"},
+		"ambiguous": {"ambiguous.yml", "deny-iam.json", "matches more than one"},
+		"no scps":   {"no-scps.yml", "deny-s3.json", "has no scp_paths"},
+	} {
+		_, err := prepareSimulationWithInputs(filepath.Join(tmpDir, tc.scenario), scenarioInputs{scpOnly: tc.scpOnly}, true, false, false, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected error containing %q, got %v", name, tc.want, err)
+		}
+	}
+
+	if _, _, err := parseFlags([]string{"--scp-only", "a.json", "--from-org-account", "123456789012"}); err == nil {
+		t.Error("Expected --scp-only with --from-org-account to be rejected")
+	}
+}
+
+func TestParseFlagsSummaryOptions(t *testing.T) {
+	flags, _, err := parseFlags([]string{"--summary-stderr"})
+	if err != nil || !flags.summaryStderr || summaryWriter(flags) != internal.Stderr {
+		t.Errorf("Expected the summary on stderr, got flags=%+v err=%v", flags, err)
+	}
+	if _, _, err := parseFlags([]string{"--no-summary", "--summary-stderr"}); err == nil {
+		t.Error("Expected --no-summary with --summary-stderr to be rejected")
+	}
+}
+
+func TestParseFlagsRetryOnDeny(t *testing.T) {
+	flags, _, err := parseFlags([]string{"--retry-on-deny", "3,5s"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if flags.retryOnDeny.attempts != 3 || flags.retryOnDeny.delay != 5*time.Second {
+		t.Errorf("Unexpected retry settings: %+v", flags.retryOnDeny)
+	}
+	for _, v := range []string{"3", "0,5s", "3,soon"} {
+		if _, _, err := parseFlags([]string{"--retry-on-deny", v}); err == nil {
+			t.Errorf("Expected --retry-on-deny %q to be rejected", v)
+		}
+	}
+}
+
+func TestRealMainListScenarios(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"_common.yml":   "vars: {}\n",
+		"a.yml":         "extends: _common.yml\ntests:\n  - action: s3:GetObject\n  - action: s3:PutObject\n",
+		"b-wip.yml":     "disabled: true\nactions: [s3:GetObject]\n",
+		"c-vars.yml":    "vars: {bucket: x}\n", // not a scenario
+		"nested/d.yaml": "tests: [\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldStdout := internal.Stdout
+	defer func() { internal.Stdout = oldStdout }()
+	var out strings.Builder
+	internal.Stdout = &out
+	if err := listScenarios(tmpDir); err != nil {
+		t.Fatalf("listScenarios() error = %v", err)
+	}
+	for _, want := range []string{
+		"a.yml  2 test(s)\n",
+		"b-wip.yml  1 test(s)  disabled\n",
+		filepath.Join("nested", "d.yaml") + "  error: ",
+		"Scenarios: 3 found (1 disabled, 1 unreadable)\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in output:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "_common.yml") {
+		t.Errorf("Files starting with _ should not be listed:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "c-vars.yml") {
+		t.Errorf("Files without tests or actions should not be listed:\n%s", out.String())
+	}
+
+	if _, _, err := parseFlags([]string{"--list-scenarios"}); err == nil || !strings.Contains(err.Error(), "requires --scenarios-dir") {
+		t.Errorf("Expected --list-scenarios to require --scenarios-dir, got %v", err)
+	}
+}
+
+func TestParseFlagsScenariosDir(t *testing.T) {
+	if _, _, err := parseFlags([]string{"--keep-going"}); err == nil || !strings.Contains(err.Error(), "requires --scenarios-dir") {
+		t.Errorf("Expected --keep-going to require --scenarios-dir, got %v", err)
+	}
+	if _, _, err := parseFlags([]string{"--scenarios-dir", "scenarios", "--save", "out.json"}); err == nil || !strings.Contains(err.Error(), "--save") {
+		t.Errorf("Expected --save to be rejected with --scenarios-dir, got %v", err)
+	}
+	flags, _, err := parseFlags([]string{"--scenarios-dir", "scenarios", "--keep-going"})
+	if err != nil || !flags.keepGoing || flags.scenariosDir != "scenarios" {
+		t.Errorf("Unexpected result: flags=%+v err=%v", flags, err)
+	}
+}
+
+func TestScenarioDependencies(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"_base.yml":           "vars_file: vars.yml\nscp_paths: [\"scp/*.json\"]\n",
+		"vars.yml":            "extra: extra.json\n",
+		"app.yml":             "extends: _base.yml\npolicy_template: policy.json.tmpl\npolicy_paths:\n  - \"{{.extra}}\"\n  - arn:aws:iam::aws:policy/ReadOnlyAccess\ntests:\n  - action: s3:GetObject\n    resource_policy_json: bucket.json\n",
+		"policy.json.tmpl":    "{}",
+		"extra.json":          "{}",
+		"bucket.json":         "{}",
+		"scp/010-base.json":   "{}",
+		"scp/020-region.json": "{}",
+		"unreferenced.json":   "{}",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := scenarioDependencies(filepath.Join(tmpDir, "app.yml"))
+	if err != nil {
+		t.Fatalf("scenarioDependencies() error = %v", err)
+	}
+	var want []string
+	for _, name := range []string{"_base.yml", "app.yml", "bucket.json", "extra.json", "policy.json.tmpl", "scp/010-base.json", "scp/020-region.json", "vars.yml"} {
+		want = append(want, filepath.Join(tmpDir, name))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected dependencies:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if code := realMain([]string{"deps"}); code != 1 {
+		t.Errorf("Expected exit 1 without --scenario, got %d", code)
+	}
+}